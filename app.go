@@ -6,8 +6,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,13 +19,39 @@ import (
 	my "my-wails-app/pkg/my2sql/base"
 	"my-wails-app/pkg/my2sql/constvar"
 
-	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/go-mysql-org/go-mysql/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type App struct {
 	ctx context.Context
+
+	// 正在运行的解析任务, key 为任务 ID
+	jobs     map[string]*analyzeJob
+	jobsLock sync.Mutex
+}
+
+// analyzeJob 一次解析任务, 每个任务有独立的配置、channel、输出文件和表结构缓存
+type analyzeJob struct {
+	ID        string
+	Req       AnalyzeRequest
+	Cfg       *my.ConfCmd
+	StartTime time.Time
+	// 任务结束后关闭
+	done chan struct{}
+}
+
+// 停止任务后等待其退出的最长时间
+const jobStopTimeout = 30 * time.Second
+
+// JobInfo 返回给前端的任务信息
+type JobInfo struct {
+	ID        string `json:"id"`
+	Mode      string `json:"mode"`
+	WorkType  string `json:"workType"`
+	OutputDir string `json:"outputDir"`
+	StartTime string `json:"startTime"`
 }
 
 // 定义一个日志桥接器
@@ -43,7 +72,7 @@ func (lb *LogBridge) Write(p []byte) (n int, err error) {
 }
 
 func NewApp() *App {
-	return &App{}
+	return &App{jobs: map[string]*analyzeJob{}}
 }
 
 func (a *App) startup(ctx context.Context) {
@@ -166,10 +195,80 @@ type BinlogResult struct {
 	Timestamp string `json:"timestamp"`
 }
 
-// 增加全局取消函数
-
+// StopAnalyze 停止所有正在运行的解析任务
 func (a *App) StopAnalyze() {
-	my.GConfCmd.IsStopped = true
+	a.jobsLock.Lock()
+	defer a.jobsLock.Unlock()
+	for _, job := range a.jobs {
+		job.Cfg.Stop()
+	}
+}
+
+// StopJob 停止指定的解析任务, 等待任务退出后返回已处理到的 binlog 位置
+func (a *App) StopJob(jobID string) (string, error) {
+	a.jobsLock.Lock()
+	job, ok := a.jobs[jobID]
+	a.jobsLock.Unlock()
+	if !ok {
+		return "", fmt.Errorf("任务 %s 不存在或已结束", jobID)
+	}
+	job.Cfg.Stop()
+	select {
+	case <-job.done:
+	case <-time.After(jobStopTimeout):
+		return "", fmt.Errorf("任务 %s 未能在 %v 内停止", jobID, jobStopTimeout)
+	}
+	return progressString(job.Cfg), nil
+}
+
+// progressString 任务已处理到的 binlog 位置
+func progressString(cfg *my.ConfCmd) string {
+	pos := cfg.Progress()
+	if pos.Name == "" {
+		return "尚未处理任何 binlog 事件"
+	}
+	return pos.String()
+}
+
+// ListJobs 列出正在运行的解析任务
+func (a *App) ListJobs() []JobInfo {
+	a.jobsLock.Lock()
+	defer a.jobsLock.Unlock()
+	jobs := make([]JobInfo, 0, len(a.jobs))
+	for _, job := range a.jobs {
+		jobs = append(jobs, JobInfo{
+			ID:        job.ID,
+			Mode:      job.Cfg.Mode,
+			WorkType:  job.Cfg.WorkType,
+			OutputDir: job.Cfg.OutputDir,
+			StartTime: job.StartTime.Format(constvar.DATETIME_FORMAT),
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartTime < jobs[j].StartTime })
+	return jobs
+}
+
+// registerJob 登记任务, 同一个输出目录同时只能有一个任务, 否则结果文件会互相覆盖
+func (a *App) registerJob(job *analyzeJob) error {
+	a.jobsLock.Lock()
+	defer a.jobsLock.Unlock()
+	if _, ok := a.jobs[job.ID]; ok {
+		return fmt.Errorf("任务 %s 已在运行", job.ID)
+	}
+	outputDir := filepath.Clean(job.Cfg.OutputDir)
+	for _, running := range a.jobs {
+		if filepath.Clean(running.Cfg.OutputDir) == outputDir {
+			return fmt.Errorf("输出目录 %s 正被任务 %s 使用", job.Cfg.OutputDir, running.ID)
+		}
+	}
+	a.jobs[job.ID] = job
+	return nil
+}
+
+func (a *App) unregisterJob(jobID string) {
+	a.jobsLock.Lock()
+	defer a.jobsLock.Unlock()
+	delete(a.jobs, jobID)
 }
 
 // AnalyzeRequest 对应前端 form 提交的所有字段
@@ -187,40 +286,149 @@ type AnalyzeRequest struct {
 	// 这两个是我们在前端 onFinish 里处理后的字符串格式时间
 	StartDatetime string `json:"startDatetime"`
 	StopDatetime  string `json:"stopDatetime"`
+	// 时区: 用于解析起止时间和输出 TIMESTAMP 列, 如 Asia/Shanghai、+08:00、Local 或 server(MySQL 的时区).
+	// 为空时连接数据库的任务使用 MySQL 的时区, 只用表结构文件的离线任务使用本机时区
+	TimeZone string `json:"timeZone"`
+	// repl: 伪装成从库从 MySQL 拉取 binlog, file: 解析本地 binlog 文件, 默认 repl
+	Mode string `json:"mode"`
+	// file 模式下的本地 binlog 文件或目录, 指定目录时会依次解析目录下所有 binlog
+	LocalBinlogPath string `json:"localBinlogPath"`
+	// 任务 ID, 用于 StopJob, 为空时自动生成
+	JobID string `json:"jobId"`
+	// mysql 或 mariadb, 决定 GTID 的格式, 默认 mysql
+	MysqlType string `json:"mysqlType"`
+	// GTID 范围: 跳过 startGtid 中的事务, stopGtid 中的事务都读到后停止
+	StartGtid string `json:"startGtid"`
+	StopGtid  string `json:"stopGtid"`
+	// 只解析 / 忽略这些 GTID 集合中的事务
+	IncludeGtids string `json:"includeGtids"`
+	ExcludeGtids string `json:"excludeGtids"`
+	// 起止 binlog 文件和位置, 位置为事件的起始位置, 与 mysqlbinlog 的 --start-position --stop-position 一致.
+	// 指定开始文件时不再按开始时间查找起始 binlog, 结束位置为 0 时解析完整个结束文件
+	StartFile string `json:"startFile"`
+	StartPos  uint   `json:"startPos"`
+	StopFile  string `json:"stopFile"`
+	StopPos   uint   `json:"stopPos"`
+	// 持续跟踪: 仅 repl 模式, 一直从主库读取 binlog 直到任务被停止, 统计结果按间隔输出
+	Follow bool `json:"follow"`
+	// 从输出目录中的断点继续上次停止或异常退出的任务, 其他参数须与上次相同
+	Resume bool `json:"resume"`
+	// DumpTableDefs 导出的表结构文件, 作为解析起点的表结构, 文件中没有的表仍从数据库查询
+	TableDefFile string `json:"tableDefFile"`
+	// 只从表结构文件中获取表结构, 不连接数据库, 仅 file 模式下可以不填连接字符串
+	OnlyTableDefFile bool `json:"onlyTableDefFile"`
 }
 
+// AnalyzeBinlog 根据请求创建一个独立的解析任务并执行, 多个任务可以同时运行
 func (a *App) AnalyzeBinlog(req AnalyzeRequest) error {
-
-	// 解析连接字符串
-	connStr := req.ConnectionString
-	user, password, host, port, err := parseConnectionString(connStr)
+	cfg, err := newJobConf(req)
 	if err != nil {
-		return fmt.Errorf("解析连接字符串失败: %v", err)
+		return err
+	}
+
+	job := &analyzeJob{ID: req.JobID, Req: req, Cfg: cfg, StartTime: time.Now(), done: make(chan struct{})}
+	if job.ID == "" {
+		job.ID = fmt.Sprintf("job-%d", job.StartTime.UnixNano())
+	}
+	ctx := cfg.NewJobContext(context.Background())
+	defer cfg.Stop()
+	if err := a.registerJob(job); err != nil {
+		return err
+	}
+	defer func() {
+		a.unregisterJob(job.ID)
+		close(job.done)
+	}()
+
+	// 断点中的起始位置在 CheckCmdOptions 中一起校验
+	if err := cfg.LoadCheckpoint(); err != nil {
+		return err
+	}
+	if err := cfg.CheckCmdOptions(); err != nil {
+		return err
+	}
+	if cfg.WorkType == "archive" {
+		return runArchiveJob(ctx, job)
+	}
+	if err := cfg.LoadTableDefs(); err != nil {
+		return err
+	}
+	cfg.EventChan = make(chan my.MyBinEvent, cfg.Threads*2)
+	cfg.StatChan = make(chan my.BinEventStats, cfg.Threads*2)
+	cfg.SqlChan = make(chan my.ForwardRollbackSqlOfPrint, cfg.Threads*2)
+	if err := cfg.OpenStatsResultFiles(); err != nil {
+		cfg.CloseFH()
+		return err
+	}
+	if err := cfg.OpenTxResultFiles(); err != nil {
+		cfg.CloseFH()
+		return err
+	}
+	// 离线解析时表结构全部来自文件, 不连接数据库
+	if !cfg.OnlyColFromFile {
+		if err := cfg.CreateDB(); err != nil {
+			cfg.CloseFH()
+			return err
+		}
 	}
 
-	my.GConfCmd.SqlTblPrefixDb = false
+	log.Printf("任务 %s 开始解析, 输出目录 %s", job.ID, cfg.OutputDir)
+	if err := runJob(ctx, cfg); err != nil {
+		log.Printf("任务 %s 解析失败: %v", job.ID, err)
+		return err
+	}
+	if ctx.Err() != nil {
+		log.Printf("任务 %s 已停止, 已处理到 %s", job.ID, progressString(cfg))
+		return nil
+	}
+	log.Printf("任务 %s 解析结束", job.ID)
+	return nil
+}
 
-	my.GConfCmd.Databases = req.Databases
-	my.GConfCmd.Passwd = password
-	my.GConfCmd.User = user
-	my.GConfCmd.Host = host
-	my.GConfCmd.Port = uint(port)
-	my.GConfCmd.Tables = req.Tables
+// runArchiveJob 下载 binlog 原始文件到输出目录, 不解析也不连接数据库查询表结构
+func runArchiveJob(ctx context.Context, job *analyzeJob) error {
+	log.Printf("任务 %s 开始下载 binlog, 输出目录 %s", job.ID, job.Cfg.OutputDir)
+	if err := my.ArchiveBinlogsFromRepl(ctx, job.Cfg); err != nil {
+		log.Printf("任务 %s 下载失败: %v", job.ID, err)
+		return err
+	}
+	if ctx.Err() != nil {
+		log.Printf("任务 %s 已停止, 已下载到 %s", job.ID, progressString(job.Cfg))
+		return nil
+	}
+	log.Printf("任务 %s 下载结束", job.ID)
+	return nil
+}
 
-	// 设置表过滤
-	/*
-		if tables, ok := config["tables"].([]interface{}); ok && len(tables) > 0 {
-			tableList := make([]string, len(tables))
-			for i, table := range tables {
-				tableList[i] = table.(string)
-			}
-			my.GConfCmd.Tables = tableList
+// newJobConf 根据前端请求生成任务配置
+func newJobConf(req AnalyzeRequest) (*my.ConfCmd, error) {
+	var (
+		user, password, host string
+		port                 int
+		err                  error
+	)
+	// 解析连接字符串, file 模式只用表结构文件时不需要连接数据库
+	connStr := strings.TrimSpace(req.ConnectionString)
+	if connStr != "" || !req.OnlyTableDefFile || req.Mode != "file" {
+		user, password, host, port, err = parseConnectionString(connStr)
+		if err != nil {
+			return nil, my.NewConfigError("解析连接字符串失败: %v", err)
 		}
-	*/
+	}
+
+	cfg := &my.ConfCmd{}
+	cfg.SqlTblPrefixDb = false
+
+	cfg.Databases = req.Databases
+	cfg.Passwd = password
+	cfg.User = user
+	cfg.Host = host
+	cfg.Port = uint(port)
+	cfg.Tables = req.Tables
 
 	// 设置操作类型
 	if req.IncludeDDL {
-		my.GConfCmd.PrintDDL = true
+		cfg.PrintDDL = true
 	} else {
 		sqlTypes := []string{}
 		if req.IncludeInsert {
@@ -232,146 +440,238 @@ func (a *App) AnalyzeBinlog(req AnalyzeRequest) error {
 		if req.IncludeDelete {
 			sqlTypes = append(sqlTypes, "delete")
 		}
-		my.GConfCmd.FilterSql = sqlTypes
-		my.GConfCmd.FilterSqlLen = len(sqlTypes)
+		cfg.FilterSql = sqlTypes
+		cfg.FilterSqlLen = len(sqlTypes)
 	}
 
-	GBinlogTimeLocation, err := time.LoadLocation("Local")
+	timeZone := strings.TrimSpace(req.TimeZone)
+	if timeZone == "" {
+		timeZone = my.C_serverTimeZone
+		if req.Mode == "file" && req.OnlyTableDefFile {
+			timeZone = "Local"
+		}
+	}
+	err = cfg.SetTimeZone(timeZone)
+	if err != nil && timeZone == my.C_serverTimeZone {
+		log.Printf("获取 MySQL 时区失败, 使用本机时区: %v", err)
+		timeZone = "Local"
+		err = cfg.SetTimeZone(timeZone)
+	}
+	if err != nil {
+		return nil, my.NewConfigError("无效的时区 %s: %v", timeZone, err)
+	}
 
 	if req.StartDatetime != "" {
-		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, req.StartDatetime, GBinlogTimeLocation)
+		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, req.StartDatetime, cfg.BinlogTimeLoc)
 		if err != nil {
-			log.Println(err.Error())
+			return nil, my.NewConfigError("无效的开始时间 %s", req.StartDatetime)
 		}
-		my.GConfCmd.StartDatetime = uint32(t.Unix())
-		my.GConfCmd.IfSetStartDateTime = true
+		cfg.StartDatetime = uint32(t.Unix())
+		cfg.IfSetStartDateTime = true
 	} else {
-		my.GConfCmd.IfSetStartDateTime = false
+		cfg.IfSetStartDateTime = false
 	}
 
 	if req.StopDatetime != "" {
-		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, req.StopDatetime, GBinlogTimeLocation)
+		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, req.StopDatetime, cfg.BinlogTimeLoc)
 		if err != nil {
-			log.Fatalf("invalid stop datetime -stop-datetime " + req.StopDatetime)
+			return nil, my.NewConfigError("无效的结束时间 %s", req.StopDatetime)
 		}
-		my.GConfCmd.StopDatetime = uint32(t.Unix())
-		my.GConfCmd.IfSetStopDateTime = true
+		cfg.StopDatetime = uint32(t.Unix())
+		cfg.IfSetStopDateTime = true
 	} else {
-		my.GConfCmd.IfSetStopDateTime = false
+		cfg.IfSetStopDateTime = false
 	}
 
 	if req.StopDatetime != "" && req.StartDatetime != "" {
-		if my.GConfCmd.StartDatetime >= my.GConfCmd.StopDatetime {
-			log.Fatalf("-start-datetime must be ealier than -stop-datetime")
-		}
-	}
-
-	my.GConfCmd.OutputDir = req.OutputDir
-	/*
-		if this.StartFile != "" {
-			this.IfSetStartFilePos = true
-			this.StartFilePos = mysql.Position{Name: this.StartFile, Pos: uint32(this.StartPos)}
-
-		} else {
-			this.IfSetStartFilePos = false
-		}
-	*/
-	my.GConfCmd.IfSetStartFilePos = false
-
-	/*
-		if this.StopFile != "" {
-			this.IfSetStopFilePos = true
-			this.StopFilePos = mysql.Position{Name: this.StopFile, Pos: uint32(this.StopPos)}
-			this.IfSetStopParsPoint = true
-
-		} else {
-			this.IfSetStopFilePos = false
-			this.IfSetStopParsPoint = false
-		}
-	*/
-	my.GConfCmd.IfSetStopFilePos = false
-	my.GConfCmd.IfSetStopParsPoint = false
-
-	/*
-		if this.Mode == "file" {
-
-			if this.StartFile == "" {
-				log.Fatalf("missing binlog file.  -start-file must be specify when -mode=file ")
-			}
-			this.GivenBinlogFile = this.StartFile
-			if !toolkits.IsFile(this.GivenBinlogFile) {
-				log.Fatalf("%s doesnot exists nor a file\n", this.GivenBinlogFile)
-			} else {
-				this.BinlogDir = filepath.Dir(this.GivenBinlogFile)
-			}
-		}
-		if my.GConfCmd.Mode == "file" {
-			if my.GConfCmd.LocalBinFile == "" {
-				log.Fatalf("missing binlog file.  -local-binlog-file must be specify when -mode=file ")
-			}
-			my.GConfCmd.GivenBinlogFile = my.GConfCmd.LocalBinFile
-			if !toolkits.IsFile(my.GConfCmd.GivenBinlogFile) {
-				log.Fatalf("%s doesnot exists nor a file\n", my.GConfCmd.GivenBinlogFile)
-			} else {
-				my.GConfCmd.BinlogDir = filepath.Dir(my.GConfCmd.GivenBinlogFile)
-			}
-		}*/
+		if cfg.StartDatetime >= cfg.StopDatetime {
+			return nil, my.NewConfigError("开始时间必须早于结束时间")
+		}
+	}
+
+	cfg.OutputDir = req.OutputDir
+
+	cfg.Mode = req.Mode
+	if cfg.Mode == "" {
+		cfg.Mode = "repl"
+	}
+	cfg.Follow = req.Follow
+	cfg.Resume = req.Resume
+	if cfg.Mode == "file" {
+		if err := setLocalBinlogPath(cfg, req.LocalBinlogPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := setBinlogFilePos(cfg, req); err != nil {
+		return nil, err
+	}
 	// 设置线程数
-	my.GConfCmd.IsStopped = false
-	my.GConfCmd.Threads = uint(req.Threads)
-	my.GConfCmd.PrintInterval = my.GConfCmd.GetDefaultValueOfRange("PrintInterval")
-	my.GConfCmd.BigTrxRowLimit = my.GConfCmd.GetDefaultValueOfRange("BigTrxRowLimit")
-	my.GConfCmd.LongTrxSeconds = my.GConfCmd.GetDefaultValueOfRange("LongTrxSeconds")
-	my.GConfCmd.ServerId = 1113306
-	my.GConfCmd.Mode = "repl"
-	my.GConfCmd.WorkType = req.WorkType
-	my.GConfCmd.MysqlType = "mysql"
-	my.GConfCmd.PrintExtraInfo = true
-	my.GConfCmd.EventChan = make(chan my.MyBinEvent, my.GConfCmd.Threads*2)
-	my.GConfCmd.StatChan = make(chan my.BinEventStats, my.GConfCmd.Threads*2)
-	my.GConfCmd.SqlChan = make(chan my.ForwardRollbackSqlOfPrint, my.GConfCmd.Threads*2)
-	my.GConfCmd.StatChan = make(chan my.BinEventStats, my.GConfCmd.Threads*2)
-	my.GConfCmd.OpenStatsResultFiles()
-	my.GConfCmd.OpenTxResultFiles()
-
-	my.GConfCmd.CheckCmdOptions()
-	my.GConfCmd.CreateDB()
-
-	my.GConfCmd.IfSetStopParsPoint = false
-	//my.GConfCmd.ParseCmdOptions()
-	defer my.GConfCmd.CloseFH()
-
-	if my.GConfCmd.WorkType != "stats" {
-		my.G_HandlingBinEventIndex = &my.BinEventHandlingIndx{EventIdx: 1, Finished: false}
+	cfg.Threads = uint(req.Threads)
+	cfg.PrintInterval = cfg.GetDefaultValueOfRange("PrintInterval")
+	cfg.BigTrxRowLimit = cfg.GetDefaultValueOfRange("BigTrxRowLimit")
+	cfg.LongTrxSeconds = cfg.GetDefaultValueOfRange("LongTrxSeconds")
+	cfg.ServerId = 1113306
+	// 前端的正向解析即 my2sql 的 2sql
+	cfg.WorkType = req.WorkType
+	if cfg.WorkType == "forward" {
+		cfg.WorkType = "2sql"
+	}
+	cfg.MysqlType = req.MysqlType
+	if cfg.MysqlType == "" {
+		cfg.MysqlType = "mysql"
+	}
+	// 在 CheckCmdOptions 中按 MysqlType 解析
+	cfg.StartGtid = strings.TrimSpace(req.StartGtid)
+	cfg.StopGtid = strings.TrimSpace(req.StopGtid)
+	cfg.IncludeGtids = strings.TrimSpace(req.IncludeGtids)
+	cfg.ExcludeGtids = strings.TrimSpace(req.ExcludeGtids)
+	cfg.PrintExtraInfo = true
+	cfg.ReadTblDefJsonFile = req.TableDefFile
+	cfg.OnlyColFromFile = req.OnlyTableDefFile
+	return cfg, nil
+}
+
+// runJob 启动统计、生成 SQL 和输出的协程并解析 binlog, 直到解析结束或任务被停止.
+// 调用前 cfg 的 channel 和结果文件必须已经创建好, 返回解析过程中的第一个错误.
+// ctx 取消后各协程尽快退出
+func runJob(ctx context.Context, cfg *my.ConfCmd) error {
+	defer cfg.CloseFH()
+
+	if cfg.WorkType != "stats" {
+		cfg.InitBinEventHandlingIndex()
 	}
 	var wg, wgGenSql sync.WaitGroup
 	wg.Add(1)
-	go my.ProcessBinEventStats(my.GConfCmd, &wg)
+	go my.ProcessBinEventStats(cfg, &wg)
 
-	if my.GConfCmd.WorkType != "stats" {
+	if cfg.WorkType != "stats" {
 		wg.Add(1)
-		go my.PrintExtraInfoForForwardRollbackupSql(my.GConfCmd, &wg)
-		for i := uint(1); i <= my.GConfCmd.Threads; i++ {
+		go my.PrintExtraInfoForForwardRollbackupSql(ctx, cfg, &wg)
+		for i := uint(1); i <= cfg.Threads; i++ {
 			wgGenSql.Add(1)
-			go my.GenForwardRollbackSqlFromBinEvent(i, my.GConfCmd, &wgGenSql)
+			go my.GenForwardRollbackSqlFromBinEvent(ctx, i, cfg, &wgGenSql)
 		}
 	}
-	if my.GConfCmd.Mode == "repl" {
-		my.ParserAllBinEventsFromRepl(my.GConfCmd)
-	} else if my.GConfCmd.Mode == "file" {
+	var err error
+	if cfg.Mode == "repl" {
+		err = my.ParserAllBinEventsFromRepl(ctx, cfg)
+	} else if cfg.Mode == "file" {
 		myParser := my.BinFileParser{}
-		myParser.Parser = replication.NewBinlogParser()
-		// donot parse mysql datetime/time column into go time structure, take it as string
-		myParser.Parser.SetParseTime(false)
-		// sqlbuilder not support decimal type
-		myParser.Parser.SetUseDecimal(false)
-		myParser.MyParseAllBinlogFiles(my.GConfCmd)
+		// decimal 解析为 decimal.Decimal, TIMESTAMP 列按任务的时区输出
+		myParser.Parser = my.NewJobBinlogParser(cfg)
+		err = myParser.MyParseAllBinlogFiles(ctx, cfg)
 	}
 	wgGenSql.Wait()
-	close(my.GConfCmd.SqlChan)
+	close(cfg.SqlChan)
 	wg.Wait()
-	return err
+	// 行镜像不完整 (binlog_row_image=MINIMAL/NOBLOB) 而无法生成 SQL 的事件按表汇总写入报告
+	if werr := cfg.WriteRowImageWarnings(); werr != nil && err == nil {
+		err = werr
+	}
+	if err != nil {
+		return err
+	}
+	if err = cfg.JobError(); err != nil {
+		return err
+	}
+	// 任务完整结束时断点已无用. follow 模式停止时回滚 SQL 已经反转生成, 断点也不能再继续
+	if ctx.Err() == nil || (cfg.Follow && cfg.WorkType == "rollback") {
+		cfg.RemoveCheckpoint()
+	}
+	return nil
+}
+
+// setLocalBinlogPath 校验 file 模式下的本地 binlog 路径, 可以是单个 binlog 文件或存放 binlog 的目录
+func setLocalBinlogPath(cfg *my.ConfCmd, binlogPath string) error {
+	if binlogPath == "" {
+		return fmt.Errorf("file 模式必须指定本地 binlog 文件或目录")
+	}
+	fi, err := os.Stat(binlogPath)
+	if err != nil {
+		return fmt.Errorf("本地 binlog 路径不存在: %v", err)
+	}
+
+	cfg.LocalBinFile = binlogPath
+	cfg.StartFile = ""
+	cfg.StartPos = 0
+	if fi.IsDir() {
+		firstBinlog, err := my.GetFirstBinlogInDir(binlogPath)
+		if err != nil {
+			return err
+		}
+		cfg.GivenBinlogFile = firstBinlog
+		cfg.BinlogDir = binlogPath
+		cfg.ParseWholeDir = true
+		return nil
+	}
+
+	// binlog 文件名必须以数字序号结尾, 如 mysql-bin.000001, 否则无法找到后续文件. 压缩文件去掉 .gz/.zst 后缀再判断
+	ext := filepath.Ext(my.TrimBinlogCompressSuffix(binlogPath))
+	if len(ext) < 2 {
+		return fmt.Errorf("%s 不是有效的 binlog 文件名", filepath.Base(binlogPath))
+	}
+	if _, err := strconv.ParseUint(ext[1:], 10, 32); err != nil {
+		return fmt.Errorf("%s 不是有效的 binlog 文件名", filepath.Base(binlogPath))
+	}
+	cfg.GivenBinlogFile = binlogPath
+	cfg.BinlogDir = filepath.Dir(binlogPath)
+	return nil
+}
+
+// setBinlogFilePos 设置起止 binlog 文件和位置, file 模式下须在 setLocalBinlogPath 之后调用
+func setBinlogFilePos(cfg *my.ConfCmd, req AnalyzeRequest) error {
+	cfg.IfSetStartFilePos = false
+	cfg.IfSetStopFilePos = false
+	cfg.IfSetStopParsPoint = false
+
+	startFile := my.TrimBinlogCompressSuffix(filepath.Base(strings.TrimSpace(req.StartFile)))
+	stopFile := my.TrimBinlogCompressSuffix(filepath.Base(strings.TrimSpace(req.StopFile)))
+	if req.StartFile == "" {
+		if req.StartPos != 0 {
+			return my.NewConfigError("指定开始位置时必须同时指定开始 binlog 文件")
+		}
+	} else {
+		if _, _, err := my.GetBinlogBasenameAndIndex(startFile); err != nil {
+			return my.NewConfigError("%s 不是有效的 binlog 文件名", startFile)
+		}
+		if cfg.Mode == "file" && my.FindBinlogFile(cfg.BinlogDir, startFile) == "" {
+			return my.NewConfigError("%s 下不存在开始 binlog 文件 %s", cfg.BinlogDir, startFile)
+		}
+		cfg.StartFile = startFile
+		cfg.StartPos = req.StartPos
+		if cfg.StartPos < 4 {
+			cfg.StartPos = 4
+		}
+		cfg.StartFilePos = mysql.Position{Name: cfg.StartFile, Pos: uint32(cfg.StartPos)}
+		cfg.IfSetStartFilePos = true
+	}
 
+	if req.StopFile == "" {
+		if req.StopPos != 0 {
+			return my.NewConfigError("指定结束位置时必须同时指定结束 binlog 文件")
+		}
+	} else {
+		if _, _, err := my.GetBinlogBasenameAndIndex(stopFile); err != nil {
+			return my.NewConfigError("%s 不是有效的 binlog 文件名", stopFile)
+		}
+		cfg.StopFile = stopFile
+		cfg.StopPos = req.StopPos
+		if cfg.StopPos == 0 {
+			cfg.StopPos = math.MaxUint32
+		} else if cfg.StopPos < 4 {
+			return my.NewConfigError("无效的结束位置 %d", req.StopPos)
+		}
+		cfg.StopFilePos = mysql.Position{Name: cfg.StopFile, Pos: uint32(cfg.StopPos)}
+		cfg.IfSetStopFilePos = true
+		cfg.IfSetStopParsPoint = true
+	}
+
+	if cfg.IfSetStartFilePos && cfg.IfSetStopFilePos {
+		if my.CompareBinlogPos(cfg.StartFile, cfg.StartPos, cfg.StopFile, cfg.StopPos) != -1 {
+			return my.NewConfigError("开始位置 %s 必须早于结束位置 %s", cfg.StartFilePos.String(), cfg.StopFilePos.String())
+		}
+	}
+	return nil
 }
 
 // ParseBinlogStatus 解析分析产生的 txt 报告
@@ -490,38 +790,24 @@ func parseConnectionString(connStr string) (string, string, string, int, error)
 
 // ExportSQL 导出 SQL
 func (a *App) ExportSQL(config map[string]interface{}, exportType string) (string, error) {
-	my.GConfCmd.IfSetStopParsPoint = false
-	my.GConfCmd.ParseCmdOptions()
-	defer my.GConfCmd.CloseFH()
-	if my.GConfCmd.WorkType != "stats" {
-		my.G_HandlingBinEventIndex = &my.BinEventHandlingIndx{EventIdx: 1, Finished: false}
-	}
-	var wg, wgGenSql sync.WaitGroup
-	wg.Add(1)
-	go my.ProcessBinEventStats(my.GConfCmd, &wg)
-
-	if my.GConfCmd.WorkType != "stats" {
-		wg.Add(1)
-		go my.PrintExtraInfoForForwardRollbackupSql(my.GConfCmd, &wg)
-		for i := uint(1); i <= my.GConfCmd.Threads; i++ {
-			wgGenSql.Add(1)
-			go my.GenForwardRollbackSqlFromBinEvent(i, my.GConfCmd, &wgGenSql)
+	cfg := &my.ConfCmd{}
+	cfg.IfSetStopParsPoint = false
+	done, err := cfg.ParseCmdOptions(os.Args[1:])
+	if err != nil || done {
+		cfg.CloseFH()
+		if err != nil {
+			return "", err
+		}
+		if cfg.DumpTblDefToFile != "" {
+			return fmt.Sprintf("表结构已导出到: %s", cfg.DumpTblDefToFile), nil
 		}
+		return my.C_Version, nil
 	}
-	if my.GConfCmd.Mode == "repl" {
-		my.ParserAllBinEventsFromRepl(my.GConfCmd)
-	} else if my.GConfCmd.Mode == "file" {
-		myParser := my.BinFileParser{}
-		myParser.Parser = replication.NewBinlogParser()
-		// donot parse mysql datetime/time column into go time structure, take it as string
-		myParser.Parser.SetParseTime(false)
-		// sqlbuilder not support decimal type
-		myParser.Parser.SetUseDecimal(false)
-		myParser.MyParseAllBinlogFiles(my.GConfCmd)
+	ctx := cfg.NewJobContext(context.Background())
+	defer cfg.Stop()
+	if err := runJob(ctx, cfg); err != nil {
+		return "", err
 	}
-	wgGenSql.Wait()
-	close(my.GConfCmd.SqlChan)
-	wg.Wait()
 	// exportType: "forward" 或 "rollback"
 
 	// TODO: 调用 my2sql 生成 SQL 文件
@@ -543,3 +829,67 @@ func (a *App) SelectFolder() (string, error) {
 	}
 	return directory, nil
 }
+
+// SelectBinlogFile 唤起原生对话框选择要离线解析的 binlog 文件
+func (a *App) SelectBinlogFile() (string, error) {
+	file, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择 binlog 文件",
+	})
+	if err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// SelectBinlogDir 唤起原生对话框选择存放 binlog 的目录
+func (a *App) SelectBinlogDir() (string, error) {
+	directory, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择 binlog 所在目录",
+	})
+	if err != nil {
+		return "", err
+	}
+	return directory, nil
+}
+
+// SelectTableDefFile 唤起原生对话框选择表结构文件, save 为 true 时选择导出的文件
+func (a *App) SelectTableDefFile(save bool) (string, error) {
+	filters := []runtime.FileFilter{{DisplayName: "表结构文件 (*.json)", Pattern: "*.json"}}
+	if save {
+		return runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			Title: "导出表结构", DefaultFilename: "table_defs.json", Filters: filters,
+		})
+	}
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择表结构文件", Filters: filters,
+	})
+}
+
+// DumpTableDefs 从数据库导出所选库表的表结构到 fileName, 不选表时导出整个库, 返回导出的表数量.
+// 导出的文件可以在没有数据库连接的环境中配合 file 模式解析 binlog
+func (a *App) DumpTableDefs(connStr string, databases []string, tables []string, fileName string) (int, error) {
+	if fileName == "" {
+		return 0, my.NewConfigError("未指定表结构文件")
+	}
+	user, password, host, port, err := parseConnectionString(connStr)
+	if err != nil {
+		return 0, my.NewConfigError("解析连接字符串失败: %v", err)
+	}
+	cfg := &my.ConfCmd{User: user, Passwd: password, Host: host, Port: uint(port),
+		Databases: databases, Tables: tables, DumpTblDefToFile: fileName}
+	defer cfg.CloseFH()
+	return cfg.DumpTableDefs()
+}
+
+// ReadTableDefFile 读取表结构文件, 返回其中的库及各库的表, 离线解析时用于选择目标库表
+func (a *App) ReadTableDefFile(fileName string) (map[string][]string, error) {
+	defs, err := my.ReadTableDefsFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string][]string{}
+	for _, tb := range defs {
+		tables[tb.Database] = append(tables[tb.Database], tb.Table)
+	}
+	return tables, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	my "my-wails-app/pkg/my2sql/base"
+)
+
+func TestSetBinlogFilePos(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mysql-bin.000002"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		mode      string
+		req       AnalyzeRequest
+		wantErr   bool
+		wantStart string
+		wantStop  string
+	}{
+		{name: "no position", mode: "repl"},
+		{name: "start and stop", mode: "repl",
+			req:       AnalyzeRequest{StartFile: "mysql-bin.000002", StartPos: 400, StopFile: "mysql-bin.000003", StopPos: 1000},
+			wantStart: "(mysql-bin.000002, 400)", wantStop: "(mysql-bin.000003, 1000)"},
+		{name: "start pos defaults to 4", mode: "repl", req: AnalyzeRequest{StartFile: "mysql-bin.000002"},
+			wantStart: "(mysql-bin.000002, 4)"},
+		{name: "stop pos 0 is the end of stop file", mode: "repl", req: AnalyzeRequest{StopFile: "/data/mysql-bin.000003"},
+			wantStop: "(mysql-bin.000003, 4294967295)"},
+		{name: "start file exists", mode: "file", req: AnalyzeRequest{StartFile: "mysql-bin.000002"},
+			wantStart: "(mysql-bin.000002, 4)"},
+		{name: "start file not exists", mode: "file", req: AnalyzeRequest{StartFile: "mysql-bin.000001"}, wantErr: true},
+		{name: "start pos without file", mode: "repl", req: AnalyzeRequest{StartPos: 400}, wantErr: true},
+		{name: "stop pos without file", mode: "repl", req: AnalyzeRequest{StopPos: 400}, wantErr: true},
+		{name: "invalid start file", mode: "repl", req: AnalyzeRequest{StartFile: "binlog"}, wantErr: true},
+		{name: "invalid stop file", mode: "repl", req: AnalyzeRequest{StopFile: "mysql-bin.abc"}, wantErr: true},
+		{name: "invalid stop pos", mode: "repl", req: AnalyzeRequest{StopFile: "mysql-bin.000003", StopPos: 3}, wantErr: true},
+		{name: "start not before stop", mode: "repl",
+			req: AnalyzeRequest{StartFile: "mysql-bin.000003", StartPos: 1000, StopFile: "mysql-bin.000003", StopPos: 1000}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &my.ConfCmd{Mode: tt.mode, BinlogDir: dir}
+			err := setBinlogFilePos(cfg, tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setBinlogFilePos() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if ee, ok := err.(*my.EngineError); !ok || ee.Category != my.ErrCategoryConfig {
+					t.Errorf("setBinlogFilePos() error = %v, want a config error", err)
+				}
+				return
+			}
+			if cfg.IfSetStartFilePos != (tt.wantStart != "") || (tt.wantStart != "" && cfg.StartFilePos.String() != tt.wantStart) {
+				t.Errorf("start = %v %s, want %s", cfg.IfSetStartFilePos, cfg.StartFilePos.String(), tt.wantStart)
+			}
+			if cfg.IfSetStopFilePos != (tt.wantStop != "") || (tt.wantStop != "" && cfg.StopFilePos.String() != tt.wantStop) {
+				t.Errorf("stop = %v %s, want %s", cfg.IfSetStopFilePos, cfg.StopFilePos.String(), tt.wantStop)
+			}
+			if cfg.IfSetStopParsPoint != cfg.IfSetStopFilePos {
+				t.Errorf("IfSetStopParsPoint = %v, want %v", cfg.IfSetStopParsPoint, cfg.IfSetStopFilePos)
+			}
+		})
+	}
+}
@@ -8,13 +8,14 @@ import {
   DatabaseOutlined, FolderOpenOutlined, PlayCircleOutlined, 
   ExclamationCircleOutlined, CheckOutlined, FileSearchOutlined,
   SettingOutlined, FilterOutlined, ConsoleSqlOutlined,
-  DeleteOutlined, StopOutlined, SyncOutlined, HistoryOutlined, ArrowRightOutlined
+  DeleteOutlined, StopOutlined, SyncOutlined, HistoryOutlined, ArrowRightOutlined,
+  CloudDownloadOutlined, ExportOutlined
 } from '@ant-design/icons';
 import zhCN from 'antd/locale/zh_CN';
 
 // 导入 Wails 运行时和生成的 Go 函数
 // @ts-ignore
-import { TestConnection, GetTables, AnalyzeBinlog, SelectFolder, ParseBinlogStatus, StopAnalyze } from '../wailsjs/go/main/App';
+import { TestConnection, GetTables, AnalyzeBinlog, SelectFolder, SelectBinlogFile, SelectBinlogDir, ParseBinlogStatus, StopJob, SelectTableDefFile, DumpTableDefs, ReadTableDefFile } from '../wailsjs/go/main/App';
 // @ts-ignore
 import { EventsOn, EventsOff } from '../wailsjs/runtime/runtime';
 
@@ -40,6 +41,9 @@ const App: React.FC = () => {
   const [connStatus, setConnStatus] = useState<'none' | 'success' | 'error'>('none');
   const [availableDbs, setAvailableDbs] = useState<string[]>([]);
   const [availableTables, setAvailableTables] = useState<string[]>([]);
+  // 表结构文件中的库表, 离线解析时代替数据库中的库表列表
+  const [tableDefTables, setTableDefTables] = useState<Record<string, string[]>>({});
+  const [dumpLoading, setDumpLoading] = useState(false);
   const [results, setResults] = useState<ResultRow[]>([]);
   const [isModalVisible, setIsModalVisible] = useState(false);
 
@@ -48,8 +52,17 @@ const App: React.FC = () => {
   const [logs, setLogs] = useState<string[]>([]);
   const logEndRef = useRef<HTMLDivElement>(null);
 
+  // 当前任务 ID, 停止时只停止本窗口提交的任务
+  const jobIdRef = useRef<string>('');
+
   // --- 表单联动监听 ---
   const outputDirValue = Form.useWatch('outputDir', form);
+  const modeValue = Form.useWatch('mode', form);
+  const localBinlogPathValue = Form.useWatch('localBinlogPath', form);
+  const tableDefFileValue = Form.useWatch('tableDefFile', form);
+  const onlyTableDefFile = Form.useWatch('onlyTableDefFile', form);
+  // file 模式下只用表结构文件, 不需要连接数据库
+  const isOffline = modeValue === 'file' && !!tableDefFileValue && !!onlyTableDefFile;
   const includeDDL = Form.useWatch('includeDDL', form);
   const includeInsert = Form.useWatch('includeInsert', form);
   const includeUpdate = Form.useWatch('includeUpdate', form);
@@ -76,9 +89,9 @@ const App: React.FC = () => {
   // 3. 停止任务函数（核心修改）
   const handleStopTask = async () => {
     try {
-      await StopAnalyze();
+      const pos = jobIdRef.current ? await StopJob(jobIdRef.current) : '';
       setLoading(false); // 关键：立即恢复按钮状态
-      message.warning('解析任务已强制停止');
+      message.warning(pos ? `解析任务已停止，已处理到 ${pos}` : '解析任务已停止');
     } catch (e) {
       message.error('停止指令发送失败');
     }
@@ -124,7 +137,38 @@ const App: React.FC = () => {
     }
   };
 
-  // 6. 查看结果报告
+  // 6. 选择 / 导出表结构文件
+  const onSelectTableDefFile = async () => {
+    const f = await SelectTableDefFile(false);
+    if (!f) return;
+    try {
+      const tbs = await ReadTableDefFile(f);
+      form.setFieldsValue({ tableDefFile: f });
+      setTableDefTables(tbs || {});
+      if (connStatus !== 'success') setAvailableDbs(Object.keys(tbs || {}).sort());
+    } catch (err: any) {
+      message.error(`读取表结构文件失败: ${err}`);
+    }
+  };
+
+  const onDumpTableDefs = async () => {
+    if (connStatus !== 'success') return message.warning('请先测试数据库连接');
+    const f = await SelectTableDefFile(true);
+    if (!f) return;
+    setDumpLoading(true);
+    try {
+      const db = form.getFieldValue('databases');
+      const cnt = await DumpTableDefs(form.getFieldValue('connectionString'), db ? [db] : [], form.getFieldValue('tables') || [], f);
+      form.setFieldsValue({ tableDefFile: f });
+      message.success(`已导出 ${cnt} 张表的表结构`);
+    } catch (err: any) {
+      message.error(`导出表结构失败: ${err}`);
+    } finally {
+      setDumpLoading(false);
+    }
+  };
+
+  // 7. 查看结果报告
   const handleViewSummary = async () => {
     if (!outputDirValue) return message.warning('请先设置保存路径');
     try {
@@ -137,18 +181,26 @@ const App: React.FC = () => {
     }
   };
 
-  // 7. 提交任务
+  // 8. 提交任务
   const onHandleSubmit = async (values: any) => {
     setLogs([]);
     setLogVisible(true);
     setLoading(true);
     try {
+      jobIdRef.current = `job-${Date.now()}`;
       const payload = { 
         ...values, 
+        jobId: jobIdRef.current,
         workType: values.sqlType, 
         databases: values.databases ? [values.databases] : [],
         startDatetime: values.timeRange?.[0] ? values.timeRange[0].format('YYYY-MM-DD HH:mm:ss') : '',
         stopDatetime: values.timeRange?.[1] ? values.timeRange[1].format('YYYY-MM-DD HH:mm:ss') : '',
+        follow: values.mode !== 'file' && !!values.follow,
+        startPos: values.startPos ?? 0,
+        stopPos: values.stopPos ?? 0,
+        tableDefFile: values.tableDefFile ?? '',
+        onlyTableDefFile: values.mode === 'file' && !!values.tableDefFile && !!values.onlyTableDefFile,
+        timeZone: values.timeZone ?? '',
       };
       await AnalyzeBinlog(payload);
       message.success('解析任务执行完毕');
@@ -225,7 +277,7 @@ const App: React.FC = () => {
               form={form}
               layout="vertical"
               initialValues={{ 
-                sqlType: 'forward', connectionString: 'root:password@tcp(127.0.0.1:3306)', 
+                sqlType: 'forward', mode: 'repl', mysqlType: 'mysql', connectionString: 'root:password@tcp(127.0.0.1:3306)', 
                 threads: 4, includeInsert: true, includeUpdate: true, includeDelete: true 
               }}
               onFinish={onHandleSubmit}
@@ -233,7 +285,7 @@ const App: React.FC = () => {
               <Card size="small" title={<Space><SettingOutlined />连接与输出</Space>} style={{ marginBottom: 20 }}>
                 <Row gutter={24}>
                   <Col span={12}>
-                    <Form.Item label="MySQL 连接字符串" name="connectionString" rules={[{ required: true }]}>
+                    <Form.Item label="MySQL 连接字符串" name="connectionString" rules={[{ required: !isOffline }]}>
                       <Space.Compact style={{ width: '100%' }}>
                         <Input placeholder="root:pass@tcp(127.0.0.1:3306)" variant="filled" spellCheck={false} />
                         <Button type="primary" onClick={onTestConnection} loading={connLoading}>测试</Button>
@@ -252,6 +304,60 @@ const App: React.FC = () => {
                     </Form.Item>
                   </Col>
                 </Row>
+                <Row gutter={24}>
+                  <Col span={12}>
+                    <Form.Item label="Binlog 来源" name="mode">
+                      <Radio.Group>
+                        <Radio value="repl">从 MySQL 拉取</Radio>
+                        <Radio value="file">本地 binlog 文件</Radio>
+                      </Radio.Group>
+                    </Form.Item>
+                    <Form.Item label="服务器类型" name="mysqlType">
+                      <Radio.Group>
+                        <Radio value="mysql">MySQL</Radio>
+                        <Radio value="mariadb">MariaDB</Radio>
+                      </Radio.Group>
+                    </Form.Item>
+                  </Col>
+                  <Col span={12}>
+                    {modeValue === 'file' && (
+                      <Form.Item label="本地 binlog 文件或目录" name="localBinlogPath" rules={[{ required: true }]}>
+                        <Space.Compact style={{ width: '100%' }}>
+                          <Input value={localBinlogPathValue} readOnly placeholder="选择 binlog 文件或所在目录" variant="filled" />
+                          <Button icon={<FileSearchOutlined />} onClick={async () => {
+                            const f = await SelectBinlogFile();
+                            if(f) form.setFieldsValue({ localBinlogPath: f });
+                          }} />
+                          <Button icon={<FolderOpenOutlined />} onClick={async () => {
+                            const d = await SelectBinlogDir();
+                            if(d) form.setFieldsValue({ localBinlogPath: d });
+                          }} />
+                        </Space.Compact>
+                      </Form.Item>
+                    )}
+                    {modeValue !== 'file' && (
+                      <Form.Item label="持续跟踪 (直到手动停止)" name="follow" valuePropName="checked">
+                        <Switch size="small" />
+                      </Form.Item>
+                    )}
+                    <Form.Item label="从断点继续 (保存目录中上次未完成的任务)" name="resume" valuePropName="checked">
+                      <Switch size="small" />
+                    </Form.Item>
+                    <Form.Item label="表结构文件 (不填则从数据库查询表结构)" name="tableDefFile">
+                      <Space.Compact style={{ width: '100%' }}>
+                        <Input value={tableDefFileValue} readOnly placeholder="选择导出的表结构 JSON 文件" variant="filled" allowClear
+                          onChange={(e) => { if (!e.target.value) form.setFieldsValue({ tableDefFile: undefined }); }} />
+                        <Button icon={<FileSearchOutlined />} onClick={onSelectTableDefFile} />
+                        <Button icon={<ExportOutlined />} onClick={onDumpTableDefs} loading={dumpLoading}>导出</Button>
+                      </Space.Compact>
+                    </Form.Item>
+                    {modeValue === 'file' && (
+                      <Form.Item label="只使用表结构文件 (不连接数据库)" name="onlyTableDefFile" valuePropName="checked">
+                        <Switch size="small" disabled={!tableDefFileValue} />
+                      </Form.Item>
+                    )}
+                  </Col>
+                </Row>
               </Card>
 
               <Row gutter={20}>
@@ -262,7 +368,9 @@ const App: React.FC = () => {
                         showSearch 
                         options={availableDbs.map(d => ({ label: d, value: d }))} 
                         onChange={async (db) => {
-                          const tbs = await GetTables(form.getFieldValue('connectionString'), [db]);
+                          const tbs = connStatus === 'success'
+                            ? await GetTables(form.getFieldValue('connectionString'), [db])
+                            : (tableDefTables[db] || []);
                           setAvailableTables(tbs);
                         }}
                       />
@@ -273,6 +381,59 @@ const App: React.FC = () => {
                     <Form.Item label="时间段过滤" name="timeRange">
                       <RangePicker showTime style={{ width: '100%' }} />
                     </Form.Item>
+                    <Form.Item label="时区 (时间段和 TIMESTAMP 列使用)" name="timeZone">
+                      <Input placeholder="不填则使用 MySQL 的时区, 如 Asia/Shanghai、+08:00、Local" allowClear spellCheck={false} />
+                    </Form.Item>
+                    <Row gutter={12}>
+                      <Col span={12}>
+                        <Form.Item label="起始 GTID (跳过该集合内的事务)" name="startGtid">
+                          <Input placeholder="uuid:1-100 或 0-1-100" allowClear spellCheck={false} />
+                        </Form.Item>
+                      </Col>
+                      <Col span={12}>
+                        <Form.Item label="结束 GTID (解析到该集合为止)" name="stopGtid">
+                          <Input placeholder="uuid:1-200 或 0-1-200" allowClear spellCheck={false} />
+                        </Form.Item>
+                      </Col>
+                    </Row>
+                    <Row gutter={12}>
+                      <Col span={12}>
+                        <Form.Item label="只解析 GTID" name="includeGtids">
+                          <Input placeholder="不填则不限制" allowClear spellCheck={false} />
+                        </Form.Item>
+                      </Col>
+                      <Col span={12}>
+                        <Form.Item label="忽略 GTID" name="excludeGtids">
+                          <Input placeholder="不填则不忽略" allowClear spellCheck={false} />
+                        </Form.Item>
+                      </Col>
+                    </Row>
+                    <Row gutter={12}>
+                      <Col span={12}>
+                        <Form.Item label="开始 binlog 文件 / 位置">
+                          <Space.Compact style={{ width: '100%' }}>
+                            <Form.Item name="startFile" noStyle>
+                              <Input placeholder="mysql-bin.000001" allowClear spellCheck={false} />
+                            </Form.Item>
+                            <Form.Item name="startPos" noStyle>
+                              <InputNumber min={4} placeholder="4" style={{ width: 120 }} />
+                            </Form.Item>
+                          </Space.Compact>
+                        </Form.Item>
+                      </Col>
+                      <Col span={12}>
+                        <Form.Item label="结束 binlog 文件 / 位置">
+                          <Space.Compact style={{ width: '100%' }}>
+                            <Form.Item name="stopFile" noStyle>
+                              <Input placeholder="mysql-bin.000002" allowClear spellCheck={false} />
+                            </Form.Item>
+                            <Form.Item name="stopPos" noStyle>
+                              <InputNumber min={4} placeholder="文件末尾" style={{ width: 120 }} />
+                            </Form.Item>
+                          </Space.Compact>
+                        </Form.Item>
+                      </Col>
+                    </Row>
                   </Card>
                 </Col>
 
@@ -282,12 +443,15 @@ const App: React.FC = () => {
                       <Text strong style={{ display: 'block', marginBottom: 10 }}>生成 SQL 类型</Text>
                       <Form.Item name="sqlType" noStyle>
                         <Radio.Group buttonStyle="solid" style={{ width: '100%' }}>
-                          <Radio.Button value="forward" style={{ width: '50%', textAlign: 'center' }}>
+                          <Radio.Button value="forward" style={{ width: '33.3%', textAlign: 'center' }}>
                             <ArrowRightOutlined /> 正向
                           </Radio.Button>
-                          <Radio.Button value="rollback" style={{ width: '50%', textAlign: 'center' }}>
+                          <Radio.Button value="rollback" style={{ width: '33.3%', textAlign: 'center' }}>
                             <HistoryOutlined /> 回滚
                           </Radio.Button>
+                          <Radio.Button value="archive" disabled={modeValue === 'file'} style={{ width: '33.4%', textAlign: 'center' }}>
+                            <CloudDownloadOutlined /> 下载
+                          </Radio.Button>
                         </Radio.Group>
                       </Form.Item>
                     </div>
@@ -320,7 +484,7 @@ const App: React.FC = () => {
                     <Space direction="vertical" style={{ width: '100%' }}>
                       <Button 
                         type="primary" block size="large" htmlType="submit" 
-                        loading={loading} disabled={connStatus !== 'success'} 
+                        loading={loading} disabled={connStatus !== 'success' && !isOffline} 
                         icon={<PlayCircleOutlined />} 
                         style={{ height: 48 }}
                       >
@@ -4,14 +4,28 @@ import {main} from '../models';
 
 export function AnalyzeBinlog(arg1:main.AnalyzeRequest):Promise<void>;
 
+export function DumpTableDefs(arg1:string,arg2:Array<string>,arg3:Array<string>,arg4:string):Promise<number>;
+
 export function ExportSQL(arg1:Record<string, any>,arg2:string):Promise<string>;
 
 export function GetTables(arg1:string,arg2:Array<string>):Promise<Array<string>>;
 
+export function ListJobs():Promise<Array<main.JobInfo>>;
+
 export function ParseBinlogStatus(arg1:string):Promise<Array<main.BinlogResult>>;
 
+export function ReadTableDefFile(arg1:string):Promise<Record<string, Array<string>>>;
+
+export function SelectBinlogDir():Promise<string>;
+
+export function SelectBinlogFile():Promise<string>;
+
 export function SelectFolder():Promise<string>;
 
+export function SelectTableDefFile(arg1:boolean):Promise<string>;
+
 export function StopAnalyze():Promise<void>;
 
+export function StopJob(arg1:string):Promise<string>;
+
 export function TestConnection(arg1:string):Promise<Array<string>>;
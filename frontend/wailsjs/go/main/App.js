@@ -6,6 +6,10 @@ export function AnalyzeBinlog(arg1) {
   return window['go']['main']['App']['AnalyzeBinlog'](arg1);
 }
 
+export function DumpTableDefs(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['DumpTableDefs'](arg1, arg2, arg3, arg4);
+}
+
 export function ExportSQL(arg1, arg2) {
   return window['go']['main']['App']['ExportSQL'](arg1, arg2);
 }
@@ -14,18 +18,42 @@ export function GetTables(arg1, arg2) {
   return window['go']['main']['App']['GetTables'](arg1, arg2);
 }
 
+export function ListJobs() {
+  return window['go']['main']['App']['ListJobs']();
+}
+
 export function ParseBinlogStatus(arg1) {
   return window['go']['main']['App']['ParseBinlogStatus'](arg1);
 }
 
+export function ReadTableDefFile(arg1) {
+  return window['go']['main']['App']['ReadTableDefFile'](arg1);
+}
+
+export function SelectBinlogDir() {
+  return window['go']['main']['App']['SelectBinlogDir']();
+}
+
+export function SelectBinlogFile() {
+  return window['go']['main']['App']['SelectBinlogFile']();
+}
+
 export function SelectFolder() {
   return window['go']['main']['App']['SelectFolder']();
 }
 
+export function SelectTableDefFile(arg1) {
+  return window['go']['main']['App']['SelectTableDefFile'](arg1);
+}
+
 export function StopAnalyze() {
   return window['go']['main']['App']['StopAnalyze']();
 }
 
+export function StopJob(arg1) {
+  return window['go']['main']['App']['StopJob'](arg1);
+}
+
 export function TestConnection(arg1) {
   return window['go']['main']['App']['TestConnection'](arg1);
 }
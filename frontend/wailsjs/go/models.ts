@@ -13,6 +13,23 @@ export namespace main {
 	    worktype: string;
 	    startDatetime: string;
 	    stopDatetime: string;
+	    timeZone: string;
+	    mode: string;
+	    localBinlogPath: string;
+	    jobId: string;
+	    mysqlType: string;
+	    startGtid: string;
+	    stopGtid: string;
+	    includeGtids: string;
+	    excludeGtids: string;
+	    startFile: string;
+	    startPos: number;
+	    stopFile: string;
+	    stopPos: number;
+	    follow: boolean;
+	    resume: boolean;
+	    tableDefFile: string;
+	    onlyTableDefFile: boolean;
 	
 	    static createFrom(source: any = {}) {
 	        return new AnalyzeRequest(source);
@@ -32,6 +49,23 @@ export namespace main {
 	        this.worktype = source["worktype"];
 	        this.startDatetime = source["startDatetime"];
 	        this.stopDatetime = source["stopDatetime"];
+	        this.timeZone = source["timeZone"];
+	        this.mode = source["mode"];
+	        this.localBinlogPath = source["localBinlogPath"];
+	        this.jobId = source["jobId"];
+	        this.mysqlType = source["mysqlType"];
+	        this.startGtid = source["startGtid"];
+	        this.stopGtid = source["stopGtid"];
+	        this.includeGtids = source["includeGtids"];
+	        this.excludeGtids = source["excludeGtids"];
+	        this.startFile = source["startFile"];
+	        this.startPos = source["startPos"];
+	        this.stopFile = source["stopFile"];
+	        this.stopPos = source["stopPos"];
+	        this.follow = source["follow"];
+	        this.resume = source["resume"];
+	        this.tableDefFile = source["tableDefFile"];
+	        this.onlyTableDefFile = source["onlyTableDefFile"];
 	    }
 	}
 	export class BinlogResult {
@@ -56,6 +90,26 @@ export namespace main {
 	        this.timestamp = source["timestamp"];
 	    }
 	}
+	export class JobInfo {
+	    id: string;
+	    mode: string;
+	    workType: string;
+	    outputDir: string;
+	    startTime: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new JobInfo(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.mode = source["mode"];
+	        this.workType = source["workType"];
+	        this.outputDir = source["outputDir"];
+	        this.startTime = source["startTime"];
+	    }
+	}
 
 }
 
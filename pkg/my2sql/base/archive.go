@@ -0,0 +1,178 @@
+package base
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// binlogArchiver writes the raw events of one binlog into a local file of the same name
+type binlogArchiver struct {
+	dir    string
+	name   string
+	fh     *os.File
+	buf    *bufio.Writer
+	offset uint32 // size of the local file, the start position of the next event
+}
+
+func (this *binlogArchiver) open(name string) error {
+	if err := this.close(); err != nil {
+		return err
+	}
+	fileName := filepath.Join(this.dir, name)
+	fh, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{Name: name, Pos: 4}, "fail to open file %s %v", fileName, err)
+	}
+	this.name = name
+	this.fh = fh
+	this.buf = bufio.NewWriterSize(fh, 1024*1024)
+	this.offset = 0
+	log.Printf("start to archive binlog %s into %s", name, fileName)
+	return this.write(replication.BinLogFileHeader)
+}
+
+func (this *binlogArchiver) write(data []byte) error {
+	if _, err := this.buf.Write(data); err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{Name: this.name, Pos: this.offset}, "fail to write binlog %s %v", this.fh.Name(), err)
+	}
+	this.offset += uint32(len(data))
+	return nil
+}
+
+func (this *binlogArchiver) flush() error {
+	if this.fh == nil {
+		return nil
+	}
+	if err := this.buf.Flush(); err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{Name: this.name, Pos: this.offset}, "fail to write binlog %s %v", this.fh.Name(), err)
+	}
+	return nil
+}
+
+func (this *binlogArchiver) close() error {
+	if this.fh == nil {
+		return nil
+	}
+	err := this.flush()
+	if cerr := this.fh.Close(); err == nil && cerr != nil {
+		err = NewEngineError(ErrCategoryOutput, mysql.Position{Name: this.name, Pos: this.offset}, "fail to close binlog %s %v", this.fh.Name(), cerr)
+	}
+	this.fh = nil
+	this.buf = nil
+	return err
+}
+
+// ArchiveBinlogsFromRepl downloads binlogs from mysql as a slave and saves them into OutputDir byte by byte,
+// like mysqlbinlog --read-from-remote-server --raw. the saved files can be parsed later with -mode=file.
+// it starts from the beginning of -start-file, or of the binlog -start-datetime is in,
+// and stops after -stop-file, or after the binlog -stop-datetime is reached in, or when there is no new event
+func ArchiveBinlogsFromRepl(ctx context.Context, cfg *ConfCmd) error {
+	if !cfg.IfSetStartFilePos {
+		files, err := getBinlogFiles(ctx, cfg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return NewEngineError(ErrCategoryConnection, mysql.Position{}, "无法获取 Binlog 列表: %v", err)
+		}
+		cfg.StartFile = findStartFile(ctx, cfg, files)
+	}
+	var err error
+	cfg.BinlogStreamer, err = NewReplBinlogStreamer(cfg)
+	if err != nil {
+		return err
+	}
+	defer cfg.BinlogSyncer.Close()
+
+	archiver := &binlogArchiver{dir: cfg.OutputDir}
+	log.Println("start to archive binlog from mysql")
+	err = archiveBinlogEvents(ctx, cfg, archiver)
+	if cerr := archiver.close(); err == nil {
+		err = cerr
+	}
+	log.Println("finish archiving binlog from mysql")
+	return err
+}
+
+func archiveBinlogEvents(ctx context.Context, cfg *ConfCmd, archiver *binlogArchiver) error {
+	var (
+		err          error
+		ev           *replication.BinlogEvent
+		stopInBinlog bool // -stop-datetime is reached, stop after the current binlog
+	)
+	for {
+		if cfg.Follow {
+			ev, err = cfg.BinlogStreamer.GetEvent(ctx)
+		} else {
+			evCtx, cancel := context.WithTimeout(ctx, EventTimeout)
+			ev, err = cfg.BinlogStreamer.GetEvent(evCtx)
+			cancel()
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("停止下载, 已保存到 %s:%d", archiver.name, archiver.offset)
+				return nil
+			} else if err == context.DeadlineExceeded {
+				log.Println("deadline exceeded.")
+				return nil
+			}
+			return NewEngineError(ErrCategoryConnection, mysql.Position{Name: archiver.name, Pos: archiver.offset}, "error to get binlog event %v", err)
+		}
+
+		if ev.Header.EventType == replication.HEARTBEAT_EVENT || ev.Header.EventType == replication.HEARTBEAT_LOG_EVENT_V2 {
+			continue
+		}
+		if ev.Header.LogPos == 0 || ev.Header.Flags&replication.LOG_EVENT_ARTIFICIAL_F != 0 {
+			// fake events are generated by mysql, they are not in the binlog file.
+			// the fake rotate event at the beginning of every binlog tells its name
+			if ev.Header.EventType != replication.ROTATE_EVENT {
+				continue
+			}
+			next := string(ev.Event.(*replication.RotateEvent).NextLogName)
+			if next == archiver.name {
+				continue
+			}
+			if archiver.name != "" {
+				if stopInBinlog {
+					log.Printf("stop to archive binlog. StopDatetime reached in %s", archiver.name)
+					return nil
+				}
+				if cfg.IfSetStopFilePos && archiver.name == cfg.StopFile {
+					log.Printf("stop to archive binlog. StopFile %s saved", cfg.StopFile)
+					return nil
+				}
+			}
+			if err = archiver.open(next); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if archiver.fh == nil {
+			return NewEngineError(ErrCategoryDecode, mysql.Position{Pos: ev.Header.LogPos}, "get binlog event before the rotate event, binlog name unknown")
+		}
+		if ev.Header.LogPos-ev.Header.EventSize != archiver.offset {
+			return NewEngineError(ErrCategoryDecode, mysql.Position{Name: archiver.name, Pos: ev.Header.LogPos},
+				"binlog event should start at %d, but start at %d", archiver.offset, ev.Header.LogPos-ev.Header.EventSize)
+		}
+		if err = archiver.write(ev.RawData); err != nil {
+			return err
+		}
+		if cfg.Follow {
+			// the local file is always complete up to the last event received
+			if err = archiver.flush(); err != nil {
+				return err
+			}
+		}
+		if cfg.IfSetStopDateTime && ev.Header.Timestamp >= cfg.StopDatetime {
+			stopInBinlog = true
+		}
+		cfg.SetProgress(mysql.Position{Name: archiver.name, Pos: ev.Header.LogPos})
+	}
+}
@@ -0,0 +1,138 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func fakeRotateEvent(next string) *replication.BinlogEvent {
+	return &replication.BinlogEvent{Header: &replication.EventHeader{EventType: replication.ROTATE_EVENT, LogPos: 0},
+		Event: &replication.RotateEvent{Position: 4, NextLogName: []byte(next)}}
+}
+
+// rawEvent returns an event starting at pos of size bytes, its raw data is filled with fill
+func rawEvent(eventType replication.EventType, pos uint32, size uint32, fill byte) *replication.BinlogEvent {
+	return &replication.BinlogEvent{Header: &replication.EventHeader{EventType: eventType, LogPos: pos + size, EventSize: size},
+		RawData: bytes.Repeat([]byte{fill}, int(size))}
+}
+
+func TestArchiveBinlogEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		stopFile  string
+		events    []*replication.BinlogEvent
+		wantErr   bool
+		wantFiles map[string][]byte
+	}{
+		{
+			name:     "two binlogs until stop file",
+			stopFile: "mysql-bin.000002",
+			events: []*replication.BinlogEvent{
+				fakeRotateEvent("mysql-bin.000001"),
+				rawEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 10, 'f'),
+				{Header: &replication.EventHeader{EventType: replication.HEARTBEAT_EVENT}},
+				rawEvent(replication.QUERY_EVENT, 14, 6, 'q'),
+				rawEvent(replication.ROTATE_EVENT, 20, 5, 'r'),
+				fakeRotateEvent("mysql-bin.000002"),
+				rawEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 10, 'F'),
+				rawEvent(replication.XID_EVENT, 14, 3, 'x'),
+				fakeRotateEvent("mysql-bin.000003"),
+				rawEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 10, 'n'),
+			},
+			wantFiles: map[string][]byte{
+				"mysql-bin.000001": []byte("\xfebinffffffffffqqqqqqrrrrr"),
+				"mysql-bin.000002": []byte("\xfebinFFFFFFFFFFxxx"),
+			},
+		},
+		{
+			name:     "gap between events",
+			stopFile: "mysql-bin.000001",
+			events: []*replication.BinlogEvent{
+				fakeRotateEvent("mysql-bin.000001"),
+				rawEvent(replication.FORMAT_DESCRIPTION_EVENT, 4, 10, 'f'),
+				rawEvent(replication.QUERY_EVENT, 20, 6, 'q'),
+			},
+			wantErr: true,
+		},
+		{
+			name:     "event before rotate",
+			stopFile: "mysql-bin.000001",
+			events:   []*replication.BinlogEvent{rawEvent(replication.QUERY_EVENT, 4, 6, 'q')},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &ConfCmd{OutputDir: dir, StopFile: tt.stopFile, IfSetStopFilePos: true, BinlogStreamer: replication.NewBinlogStreamer()}
+			for _, ev := range tt.events {
+				if err := cfg.BinlogStreamer.AddEventToStreamer(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			archiver := &binlogArchiver{dir: dir}
+			err := archiveBinlogEvents(context.Background(), cfg, archiver)
+			if cerr := archiver.close(); err == nil {
+				err = cerr
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("archiveBinlogEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if ee, ok := err.(*EngineError); !ok || ee.Category != ErrCategoryDecode {
+					t.Errorf("archiveBinlogEvents() error = %v, want a decode error", err)
+				}
+				return
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != len(tt.wantFiles) {
+				t.Errorf("%d files archived, want %d", len(entries), len(tt.wantFiles))
+			}
+			for name, want := range tt.wantFiles {
+				got, err := os.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveBinlogEventsCanceled(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &ConfCmd{OutputDir: dir, BinlogStreamer: replication.NewBinlogStreamer()}
+	ctx := cfg.NewJobContext(context.Background())
+	cfg.Stop()
+	if err := archiveBinlogEvents(ctx, cfg, &binlogArchiver{dir: dir}); err != nil {
+		t.Errorf("archiveBinlogEvents() of stopped job error = %v", err)
+	}
+}
+
+func TestCheckCmdOptionsArchive(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *ConfCmd
+	}{
+		{name: "file mode", cfg: &ConfCmd{Mode: "file"}},
+		{name: "start gtid", cfg: &ConfCmd{Mode: "repl", StartGtid: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"}},
+		{name: "resume", cfg: &ConfCmd{Mode: "repl", Resume: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.WorkType = "archive"
+			tt.cfg.MysqlType = "mysql"
+			err := tt.cfg.CheckCmdOptions()
+			if ee, ok := err.(*EngineError); !ok || ee.Category != ErrCategoryConfig {
+				t.Errorf("CheckCmdOptions() error = %v, want a config error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package base
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"my-wails-app/pkg/my2sql/sqltypes"
+
+	"github.com/pingcap/tidb/pkg/parser/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// the values of char, varchar and text columns are logged as the bytes in the charsets of the columns.
+// they are converted into utf8, the sql files are utf8mb4 and start with ConfCmd.SqlFilePreamble.
+// the values which can not be converted are written as hex with the charset introducer, ex: _gbk X'C4E3'
+
+// the charsets whose bytes are written as they are
+var utf8Charsets = []string{"", "utf8", "utf8mb3", "utf8mb4", "ascii"}
+
+// {mysql charset: encoding}
+var charsetEncodings = map[string]encoding.Encoding{
+	"latin1":   charmap.Windows1252, // latin1 of mysql is cp1252
+	"latin2":   charmap.ISO8859_2,
+	"latin5":   charmap.ISO8859_9,
+	"latin7":   charmap.ISO8859_13,
+	"greek":    charmap.ISO8859_7,
+	"hebrew":   charmap.ISO8859_8,
+	"cp1250":   charmap.Windows1250,
+	"cp1251":   charmap.Windows1251,
+	"cp1256":   charmap.Windows1256,
+	"cp1257":   charmap.Windows1257,
+	"cp850":    charmap.CodePage850,
+	"cp852":    charmap.CodePage852,
+	"cp866":    charmap.CodePage866,
+	"koi8r":    charmap.KOI8R,
+	"koi8u":    charmap.KOI8U,
+	"macroman": charmap.Macintosh,
+	"gbk":      simplifiedchinese.GBK,
+	"gb2312":   simplifiedchinese.GBK, // gb2312 is a subset of gbk
+	"gb18030":  simplifiedchinese.GB18030,
+	"big5":     traditionalchinese.Big5,
+	"ujis":     japanese.EUCJP,
+	"eucjpms":  japanese.EUCJP,
+	"sjis":     japanese.ShiftJIS,
+	"cp932":    japanese.ShiftJIS,
+	"euckr":    korean.EUCKR,
+}
+
+// GetCharsetOfCollation returns the charset of the collation, ex: gbk of gbk_chinese_ci, "" if it is empty
+func GetCharsetOfCollation(collation string) string {
+	if collation == "" {
+		return ""
+	}
+	if coll, err := charset.GetCollationByName(collation); err == nil {
+		return coll.CharsetName
+	}
+	return strings.SplitN(strings.ToLower(collation), "_", 2)[0]
+}
+
+// GetCharsetOfCollationId returns the charset of the collation id in the table map event, "" if it is unknown
+func GetCharsetOfCollationId(id uint64) string {
+	if coll, err := charset.GetCollationByID(int(id)); err == nil {
+		return coll.CharsetName
+	}
+	return ""
+}
+
+// IsCharacterType returns true for the types with a charset, ex: varchar, text, enum
+func IsCharacterType(fieldType string) bool {
+	tp := strings.ToLower(fieldType)
+	return strings.Contains(tp, "char") || strings.Contains(tp, "text") || tp == "enum" || tp == "set"
+}
+
+// ConvertCharsetValue converts the value of the character column in cs into utf8 string,
+// it returns the value with the charset introducer if it can not be converted, see sqltypes.MakeCharsetString
+func ConvertCharsetValue(v interface{}, cs string) interface{} {
+	var raw []byte
+	switch val := v.(type) {
+	case string:
+		raw = []byte(val)
+	case []byte:
+		raw = val
+	default:
+		return v
+	}
+	cs = strings.ToLower(cs)
+	for _, one := range utf8Charsets {
+		if cs == one {
+			return string(raw)
+		}
+	}
+	if enc, ok := charsetEncodings[cs]; ok {
+		if str, err := enc.NewDecoder().Bytes(raw); err == nil && !strings.ContainsRune(string(str), utf8.RuneError) {
+			return string(str)
+		}
+	}
+	return sqltypes.MakeCharsetString(cs, raw)
+}
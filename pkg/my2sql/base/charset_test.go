@@ -0,0 +1,78 @@
+package base
+
+import (
+	"bytes"
+	"testing"
+
+	"my-wails-app/pkg/my2sql/sqltypes"
+)
+
+func TestConvertCharsetValue(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		cs   string
+		want interface{} // the utf8 string, or the sql of the value with the charset introducer
+	}{
+		{name: "gbk", v: "\xc4\xe3\xba\xc3", cs: "gbk", want: "你好"},
+		{name: "gbk bytes", v: []byte("\xc4\xe3"), cs: "GBK", want: "你"},
+		{name: "gbk invalid bytes", v: "\xff\xff", cs: "gbk", want: "_gbk X'ffff'"},
+		{name: "gbk truncated", v: "a\xc4", cs: "gbk", want: "_gbk X'61c4'"},
+		{name: "gb18030", v: "\x81\x30\x81\x30", cs: "gb18030", want: "\u0080"},
+		{name: "big5", v: "\xa4\xa4", cs: "big5", want: "中"},
+		{name: "sjis", v: "\x93\xfa\x96\x7b", cs: "sjis", want: "日本"},
+		{name: "latin1 is cp1252", v: "caf\xe9 \x80", cs: "latin1", want: "café €"},
+		{name: "utf8mb4 unchanged", v: "你好", cs: "utf8mb4", want: "你好"},
+		{name: "unknown charset of definition", v: "abc", cs: "", want: "abc"},
+		{name: "charset without encoding", v: "\xb0", cs: "armscii8", want: "_armscii8 X'b0'"},
+		{name: "not a string", v: int64(1), cs: "gbk", want: int64(1)},
+		{name: "null", v: nil, cs: "gbk", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConvertCharsetValue(tt.v, tt.cs)
+			if v, ok := got.(sqltypes.Value); ok {
+				var b bytes.Buffer
+				v.EncodeSql(&b)
+				got = b.String()
+			}
+			if got != tt.want {
+				t.Errorf("ConvertCharsetValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetCharsetOfCollation(t *testing.T) {
+	tests := []struct {
+		collation string
+		want      string
+	}{
+		{collation: "gbk_chinese_ci", want: "gbk"},
+		{collation: "utf8mb4_0900_ai_ci", want: "utf8mb4"},
+		{collation: "latin1_swedish_ci", want: "latin1"},
+		{collation: "binary", want: "binary"},
+		{collation: "GB18030_UNICODE_520_CI", want: "gb18030"},
+		{collation: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := GetCharsetOfCollation(tt.collation); got != tt.want {
+			t.Errorf("GetCharsetOfCollation(%s) = %s, want %s", tt.collation, got, tt.want)
+		}
+	}
+	ids := map[uint64]string{28: "gbk", 33: "utf8", 45: "utf8mb4", 63: "binary", 255: "utf8mb4", 8: "latin1", 60000: ""}
+	for id, want := range ids {
+		if got := GetCharsetOfCollationId(id); got != want {
+			t.Errorf("GetCharsetOfCollationId(%d) = %s, want %s", id, got, want)
+		}
+	}
+}
+
+func TestIsCharacterType(t *testing.T) {
+	for tp, want := range map[string]bool{"varchar": true, "char": true, "mediumtext": true, "enum": true, "SET": true,
+		"blob": false, "varbinary": false, "int": false, "json": false} {
+		if got := IsCharacterType(tp); got != want {
+			t.Errorf("IsCharacterType(%s) = %v, want %v", tp, got, want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package base
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	constvar "my-wails-app/pkg/my2sql/constvar"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/siddontang/go-log/log"
+)
+
+const CheckpointFileName = "my2sql_checkpoint.json"
+
+// a checkpoint is saved at the end of the first transaction after this interval
+var CheckpointInterval = 5 * time.Second
+
+// CheckpointFile is an output file being written, Size is its length up to the checkpoint.
+// for rollback tmp files, Rollback is the file it is reverted into and TrxPoses is its bytesCntFiles
+type CheckpointFile struct {
+	Name     string  `json:"name"`
+	Binlog   string  `json:"binlog"`
+	Size     int64   `json:"size"`
+	Rollback string  `json:"rollback,omitempty"`
+	TrxPoses [][]int `json:"trx_poses,omitempty"`
+}
+
+// CheckpointStats is the stats of one table collected but not printed yet at the checkpoint, see BinEventStatsPrint
+type CheckpointStats struct {
+	Binlog    string `json:"binlog"`
+	StartTime uint32 `json:"start_time"`
+	StopTime  uint32 `json:"stop_time"`
+	StartPos  uint32 `json:"start_position"`
+	StopPos   uint32 `json:"stop_position"`
+	Database  string `json:"database"`
+	Table     string `json:"table"`
+	Inserts   uint32 `json:"inserts"`
+	Updates   uint32 `json:"updates"`
+	Deletes   uint32 `json:"deletes"`
+	Gtids     string `json:"gtids,omitempty"`
+}
+
+// CheckpointPart is the state of one thread at the end of a transaction,
+// the result of every event up to Binlog:Pos has been written into Files.
+// the stats thread also saves the time to print stats next and the stats waiting for it,
+// so the stats files of a resumed job are the same as the job is not stopped
+type CheckpointPart struct {
+	Binlog    string            `json:"binlog"`
+	Pos       uint32            `json:"position"`
+	TrxIndex  uint64            `json:"trx_index"`
+	EventIdx  uint64            `json:"event_index"`
+	Files     []CheckpointFile  `json:"files"`
+	PrintTime uint32            `json:"print_time,omitempty"`
+	Stats     []CheckpointStats `json:"stats,omitempty"`
+}
+
+func (this *CheckpointPart) Position() mysql.Position {
+	return mysql.Position{Name: this.Binlog, Pos: this.Pos}
+}
+
+// SetStatsToPrint saves the stats not printed yet, key of statsPrintArr is db.tb
+func (this *CheckpointPart) SetStatsToPrint(statsPrintArr map[string]*BinEventStatsPrint) {
+	this.Stats = nil
+	keys := make([]string, 0, len(statsPrintArr))
+	for k := range statsPrintArr {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		st := statsPrintArr[k]
+		cst := CheckpointStats{Binlog: st.Binlog, StartTime: st.StartTime, StopTime: st.StopTime, StartPos: st.StartPos, StopPos: st.StopPos,
+			Database: st.Database, Table: st.Table, Inserts: st.Inserts, Updates: st.Updates, Deletes: st.Deletes}
+		if st.Gtids != nil {
+			cst.Gtids = st.Gtids.String()
+		}
+		this.Stats = append(this.Stats, cst)
+	}
+}
+
+// StatsToPrint returns the stats not printed yet at the checkpoint, key=db.tb
+func (this *CheckpointPart) StatsToPrint(flavor string) map[string]*BinEventStatsPrint {
+	statsPrintArr := map[string]*BinEventStatsPrint{}
+	for _, cst := range this.Stats {
+		st := &BinEventStatsPrint{Binlog: cst.Binlog, StartTime: cst.StartTime, StopTime: cst.StopTime, StartPos: cst.StartPos, StopPos: cst.StopPos,
+			Database: cst.Database, Table: cst.Table, Inserts: cst.Inserts, Updates: cst.Updates, Deletes: cst.Deletes}
+		if cst.Gtids != "" {
+			gset, err := mysql.ParseGTIDSet(flavor, cst.Gtids)
+			if err != nil {
+				log.Errorf("fail to parse gtids %s of %s.%s in checkpoint %v", cst.Gtids, cst.Database, cst.Table, err)
+			} else {
+				st.Gtids = gset
+			}
+		}
+		statsPrintArr[GetAbsTableName(cst.Database, cst.Table)] = st
+	}
+	return statsPrintArr
+}
+
+// Checkpoint is saved in OutputDir while the job runs, -resume continues the job from it.
+// Sql is saved by the thread writing sql files, Stats by the stats thread,
+// binlog is read again from the earlier one and each thread skips what it has written
+type Checkpoint struct {
+	WorkType     string          `json:"work_type"`
+	FilePerTable bool            `json:"file_per_table"`
+	UpdateTime   string          `json:"update_time"`
+	Sql          *CheckpointPart `json:"sql,omitempty"`
+	Stats        *CheckpointPart `json:"stats,omitempty"`
+}
+
+func (this *ConfCmd) CheckpointFilePath() string {
+	return filepath.Join(this.OutputDir, CheckpointFileName)
+}
+
+// LoadCheckpoint reads the checkpoint of OutputDir if -resume is set,
+// and starts reading binlog from it. it must be called before the result files are opened
+func (this *ConfCmd) LoadCheckpoint() error {
+	if !this.Resume {
+		return nil
+	}
+	cpFile := this.CheckpointFilePath()
+	data, err := os.ReadFile(cpFile)
+	if err != nil {
+		return NewConfigError("no checkpoint to resume from in %s %v", this.OutputDir, err)
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return NewConfigError("invalid checkpoint %s %v", cpFile, err)
+	}
+	if cp.WorkType != this.WorkType || cp.FilePerTable != this.FilePerTable {
+		return NewConfigError("checkpoint %s is saved by a job of work-type=%s file-per-table=%v, not match this job",
+			cpFile, cp.WorkType, cp.FilePerTable)
+	}
+
+	start := cp.Stats
+	if cp.Sql != nil && (start == nil || cp.Sql.Position().Compare(start.Position()) < 0) {
+		start = cp.Sql
+	}
+	if start == nil {
+		return NewConfigError("checkpoint %s is empty, nothing to resume from", cpFile)
+	}
+	if this.Mode == "file" && FindBinlogFile(this.BinlogDir, start.Binlog) == "" {
+		return NewConfigError("binlog %s of checkpoint not found in %s", start.Binlog, this.BinlogDir)
+	}
+
+	this.StartFile = start.Binlog
+	this.StartPos = uint(start.Pos)
+	this.StartFilePos = start.Position()
+	this.IfSetStartFilePos = true
+	this.trxIndex = start.TrxIndex
+	if cp.Sql != nil {
+		this.binEventIdx = cp.Sql.EventIdx
+	}
+	this.resumeFrom = cp
+	this.checkpoint = Checkpoint{WorkType: cp.WorkType, FilePerTable: cp.FilePerTable, Sql: cp.Sql, Stats: cp.Stats}
+	log.Infof("resume from checkpoint %s, start to read binlog at %s", cpFile, this.StartFilePos.String())
+	return nil
+}
+
+// ResumedPart returns the part of the checkpoint the job resumes from, nil if it is not resumed
+func (this *ConfCmd) ResumedPart(ifSql bool) *CheckpointPart {
+	if this.resumeFrom == nil {
+		return nil
+	}
+	if ifSql {
+		return this.resumeFrom.Sql
+	}
+	return this.resumeFrom.Stats
+}
+
+// SaveCheckpoint saves the part of one thread, it is written into a tmp file then renamed,
+// so the checkpoint file is complete even if the process crashes
+func (this *ConfCmd) SaveCheckpoint(ifSql bool, part *CheckpointPart) error {
+	this.checkpointLock.Lock()
+	defer this.checkpointLock.Unlock()
+
+	this.checkpoint.WorkType = this.WorkType
+	this.checkpoint.FilePerTable = this.FilePerTable
+	this.checkpoint.UpdateTime = time.Now().Format(constvar.DATETIME_FORMAT)
+	if ifSql {
+		this.checkpoint.Sql = part
+	} else {
+		this.checkpoint.Stats = part
+	}
+	data, err := json.MarshalIndent(&this.checkpoint, "", "  ")
+	if err != nil {
+		return NewEngineError(ErrCategoryOutput, part.Position(), "fail to save checkpoint %v", err)
+	}
+	cpFile := this.CheckpointFilePath()
+	tmpFile := cpFile + ".tmp"
+	if err = os.WriteFile(tmpFile, data, 0644); err != nil {
+		return NewEngineError(ErrCategoryOutput, part.Position(), "fail to save checkpoint %s %v", tmpFile, err)
+	}
+	if err = os.Rename(tmpFile, cpFile); err != nil {
+		return NewEngineError(ErrCategoryOutput, part.Position(), "fail to save checkpoint %s %v", cpFile, err)
+	}
+	return nil
+}
+
+// RemoveCheckpoint is called when the job finishes, there is nothing to resume
+func (this *ConfCmd) RemoveCheckpoint() {
+	err := os.Remove(this.CheckpointFilePath())
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("fail to remove checkpoint %s %v", this.CheckpointFilePath(), err)
+	}
+}
+
+// OpenResumedFile opens an output file of the checkpoint for appending,
+// what is written after the checkpoint is truncated
+func OpenResumedFile(f CheckpointFile) (*os.File, error) {
+	fi, err := os.Stat(f.Name)
+	if err != nil {
+		return nil, NewConfigError("output file %s of checkpoint not found %v", f.Name, err)
+	}
+	if fi.Size() < f.Size {
+		return nil, NewConfigError("output file %s is shorter than it is in checkpoint, %d < %d", f.Name, fi.Size(), f.Size)
+	}
+	fh, err := os.OpenFile(f.Name, os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to open file %s %v", f.Name, err)
+	}
+	if err = fh.Truncate(f.Size); err == nil {
+		_, err = fh.Seek(f.Size, os.SEEK_SET)
+	}
+	if err != nil {
+		fh.Close()
+		return nil, NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to truncate file %s to %d %v", f.Name, f.Size, err)
+	}
+	return fh, nil
+}
+
+// FindCheckpointFile returns the file named name in the resumed part
+func FindCheckpointFile(part *CheckpointPart, name string) (CheckpointFile, bool) {
+	if part == nil {
+		return CheckpointFile{}, false
+	}
+	for _, f := range part.Files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return CheckpointFile{}, false
+}
+
+// InitBinEventHandlingIndex makes the sql generating threads start from the first event to be read,
+// it is not 1 when the job is resumed
+func (this *ConfCmd) InitBinEventHandlingIndex() {
+	this.HandlingBinEventIndex = &BinEventHandlingIndx{EventIdx: this.binEventIdx + 1, Finished: false}
+}
@@ -0,0 +1,182 @@
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &ConfCmd{Mode: "repl", WorkType: "rollback", OutputDir: dir}
+	stats := &CheckpointPart{Binlog: "mysql-bin.000003", Pos: 800, TrxIndex: 9,
+		Files: []CheckpointFile{{Name: filepath.Join(dir, "binlog_status.txt"), Binlog: "mysql-bin.000003", Size: 120}}}
+	sql := &CheckpointPart{Binlog: "mysql-bin.000003", Pos: 500, TrxIndex: 7, EventIdx: 30,
+		Files: []CheckpointFile{{Name: filepath.Join(dir, "db.tb.3.tmp"), Binlog: "mysql-bin.000003", Size: 60,
+			Rollback: filepath.Join(dir, "rollback.3.sql"), TrxPoses: [][]int{{20, 1}, {40, 2}}}}}
+	if err := cfg.SaveCheckpoint(false, stats); err != nil {
+		t.Fatalf("SaveCheckpoint() error = %v", err)
+	}
+	if err := cfg.SaveCheckpoint(true, sql); err != nil {
+		t.Fatalf("SaveCheckpoint() error = %v", err)
+	}
+	if _, err := os.Stat(cfg.CheckpointFilePath() + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("tmp file of checkpoint is left")
+	}
+
+	// not resumed
+	cfg2 := &ConfCmd{Mode: "repl", WorkType: "rollback", OutputDir: dir}
+	if err := cfg2.LoadCheckpoint(); err != nil || cfg2.IfSetStartFilePos || cfg2.ResumedPart(true) != nil {
+		t.Fatalf("LoadCheckpoint() without -resume = %v, start %v", err, cfg2.IfSetStartFilePos)
+	}
+
+	// binlog is read again from the earlier part of the two
+	cfg2.Resume = true
+	if err := cfg2.LoadCheckpoint(); err != nil {
+		t.Fatalf("LoadCheckpoint() error = %v", err)
+	}
+	if cfg2.StartFilePos != sql.Position() || !cfg2.IfSetStartFilePos || cfg2.trxIndex != 7 || cfg2.binEventIdx != 30 {
+		t.Errorf("start = %v %v, trx %d, event %d, want %v true, 7, 30",
+			cfg2.StartFilePos, cfg2.IfSetStartFilePos, cfg2.trxIndex, cfg2.binEventIdx, sql.Position())
+	}
+	if f, ok := FindCheckpointFile(cfg2.ResumedPart(true), sql.Files[0].Name); !ok || f.Rollback != sql.Files[0].Rollback || len(f.TrxPoses) != 2 {
+		t.Errorf("FindCheckpointFile() = %+v, %v, want %+v", f, ok, sql.Files[0])
+	}
+	if _, ok := FindCheckpointFile(cfg2.ResumedPart(false), sql.Files[0].Name); ok {
+		t.Errorf("FindCheckpointFile() finds the sql file in the stats part")
+	}
+	cfg2.InitBinEventHandlingIndex()
+	if cfg2.HandlingBinEventIndex.EventIdx != 31 {
+		t.Errorf("HandlingBinEventIndex = %d, want 31", cfg2.HandlingBinEventIndex.EventIdx)
+	}
+
+	cfg3 := &ConfCmd{Mode: "repl", WorkType: "2sql", OutputDir: dir, Resume: true}
+	if err := cfg3.LoadCheckpoint(); err == nil {
+		t.Errorf("LoadCheckpoint() resumes a job of another work type")
+	}
+
+	cfg.RemoveCheckpoint()
+	if err := cfg2.LoadCheckpoint(); err == nil {
+		t.Errorf("LoadCheckpoint() resumes from a removed checkpoint")
+	}
+}
+
+func TestOpenResumedFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "db.tb.3.sql")
+	if err := os.WriteFile(name, []byte("insert 1;\ninsert 2;\ninsert 3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// what is written after the checkpoint is truncated, and the file is appended from there
+	fh, err := OpenResumedFile(CheckpointFile{Name: name, Size: 20})
+	if err != nil {
+		t.Fatalf("OpenResumedFile() error = %v", err)
+	}
+	if _, err = fh.WriteString("insert 4;\n"); err != nil {
+		t.Fatal(err)
+	}
+	fh.Close()
+	got, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "insert 1;\ninsert 2;\ninsert 4;\n"; string(got) != want {
+		t.Errorf("resumed file = %q, want %q", got, want)
+	}
+
+	if _, err = OpenResumedFile(CheckpointFile{Name: name, Size: 100}); err == nil {
+		t.Errorf("OpenResumedFile() accepts a file shorter than the checkpoint")
+	}
+	if _, err = OpenResumedFile(CheckpointFile{Name: filepath.Join(dir, "missing.sql"), Size: 0}); err == nil {
+		t.Errorf("OpenResumedFile() accepts a missing file")
+	}
+}
+
+// statsOfTrxs returns the stats of transactions, each of one insert into tb1 and one into tb2, a transaction per second
+func statsOfTrxs(cnt int) []BinEventStats {
+	var sts []BinEventStats
+	pos := uint32(4)
+	for i := 0; i < cnt; i++ {
+		ts := uint32(1700000000 + i)
+		for _, one := range []BinEventStats{
+			{QueryType: "query", QuerySql: "BEGIN"},
+			{QueryType: "insert", Database: "db", Table: "tb1", RowCnt: 2},
+			{QueryType: "insert", Database: "db", Table: "tb2", RowCnt: 1},
+			{QueryType: "query", QuerySql: "COMMIT"},
+		} {
+			one.Binlog = "mysql-bin.000001"
+			one.Timestamp = ts
+			one.StartPos = pos
+			pos += 100
+			one.StopPos = pos
+			one.TrxIndex = uint64(i + 1)
+			sts = append(sts, one)
+		}
+	}
+	return sts
+}
+
+// runStatsJob runs the stats thread of a job in dir with sts, and returns the sorted lines of binlog_status.txt
+func runStatsJob(t *testing.T, dir string, resume bool, sts []BinEventStats) []string {
+	cfg := &ConfCmd{Mode: "repl", WorkType: "stats", OutputDir: dir, Resume: resume, MysqlType: "mysql",
+		PrintInterval: 3, BigTrxRowLimit: 10, LongTrxSeconds: 10, StatChan: make(chan BinEventStats)}
+	if err := cfg.LoadCheckpoint(); err != nil {
+		t.Fatalf("LoadCheckpoint() error = %v", err)
+	}
+	if err := cfg.OpenStatsResultFiles(); err != nil {
+		t.Fatalf("OpenStatsResultFiles() error = %v", err)
+	}
+	if err := cfg.OpenTxResultFiles(); err != nil {
+		t.Fatalf("OpenTxResultFiles() error = %v", err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go ProcessBinEventStats(cfg, &wg)
+	for _, st := range sts {
+		cfg.StatChan <- st
+	}
+	close(cfg.StatChan)
+	wg.Wait()
+	cfg.CloseFH()
+	if err := cfg.JobError(); err != nil {
+		t.Fatalf("stats thread error = %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "binlog_status.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimRight(line, " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestProcessBinEventStatsResume(t *testing.T) {
+	defer func(interval time.Duration) { CheckpointInterval = interval }(CheckpointInterval)
+	sts := statsOfTrxs(7)
+
+	CheckpointInterval = time.Hour
+	want := runStatsJob(t, t.TempDir(), false, sts)
+
+	// a checkpoint is saved at the end of every transaction, the job stops in the middle of a print interval,
+	// what it prints when stopping is truncated by the resumed job
+	CheckpointInterval = 0
+	dir := t.TempDir()
+	runStatsJob(t, dir, false, sts[:4*5])
+	got := runStatsJob(t, dir, true, sts)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("stats of resumed job =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// nor does saving checkpoints change the stats
+	if got = runStatsJob(t, t.TempDir(), false, sts); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("stats of job saving checkpoints =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -1,13 +1,13 @@
 package base
 
 import (
-	"fmt"
+	"context"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 
 	"my-wails-app/pkg/my2sql/dsql"
-	toolkits "my-wails-app/pkg/my2sql/toolkits"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
@@ -20,10 +20,6 @@ type BinEventHandlingIndx struct {
 	Finished bool
 }
 
-var (
-	G_HandlingBinEventIndex *BinEventHandlingIndx
-)
-
 type MyBinEvent struct {
 	MyPos       mysql.Position //this is the end position
 	EventIdx    uint64
@@ -36,10 +32,13 @@ type MyBinEvent struct {
 	TrxStatus   int           // 0:begin, 1: commit, 2: rollback, -1: in_progress
 	QuerySql    *dsql.SqlInfo // for ddl and binlog which is not row format
 	OrgSql      string        // for ddl and binlog which is not row format
+	Gtid        string        // gtid of the transaction, empty if gtid_mode is off
+	TbInfo      *TblInfoJson  // definition of the table at the position of the rows event, set when it is dispatched
 }
 
 func (this *MyBinEvent) CheckBinEvent(cfg *ConfCmd, ev *replication.BinlogEvent, currentBinlog *string) int {
-	myPos := mysql.Position{Name: *currentBinlog, Pos: ev.Header.LogPos}
+	// StartFilePos and StopFilePos are compared with the start position of the event, like mysqlbinlog --start-position --stop-position
+	myPos := mysql.Position{Name: *currentBinlog, Pos: GetEventStartPos(ev.Header)}
 
 	if ev.Header.EventType == replication.ROTATE_EVENT {
 		rotatEvent := ev.Event.(*replication.RotateEvent)
@@ -48,6 +47,28 @@ func (this *MyBinEvent) CheckBinEvent(cfg *ConfCmd, ev *replication.BinlogEvent,
 		return C_reContinue
 	}
 
+	if ev.Header.EventType == replication.QUERY_EVENT && cfg.WorkType != "stats" && !cfg.isBeforeStart(myPos, ev.Header) {
+		// the table definitions are changed by ddl even if its transaction is filtered out
+		cfg.TablesColumnsInfo.ApplyQueryEvent(ev.Event.(*replication.QueryEvent), myPos, ev.Header.LogPos)
+	}
+
+	switch ev.Header.EventType {
+	case replication.GTID_EVENT, replication.ANONYMOUS_GTID_EVENT, replication.GTID_TAGGED_LOG_EVENT,
+		replication.MARIADB_GTID_EVENT:
+		if cfg.CheckGtidEvent(ev) == C_reBreak {
+			return C_reBreak
+		}
+		if cfg.skipTrx {
+			this.IfRowsEvent = false
+			return C_reContinue
+		}
+	default:
+		if cfg.skipTrx {
+			this.IfRowsEvent = false
+			return C_reContinue
+		}
+	}
+
 	if cfg.IfSetStartFilePos {
 		cmpRe := myPos.Compare(cfg.StartFilePos)
 		if cmpRe == -1 {
@@ -87,7 +108,8 @@ func (this *MyBinEvent) CheckBinEvent(cfg *ConfCmd, ev *replication.BinlogEvent,
 		}
 	}
 
-	if ev.Header.EventType == replication.UPDATE_ROWS_EVENTv1 || ev.Header.EventType == replication.UPDATE_ROWS_EVENTv2 {
+	if ev.Header.EventType == replication.UPDATE_ROWS_EVENTv1 || ev.Header.EventType == replication.UPDATE_ROWS_EVENTv2 ||
+		ev.Header.EventType == replication.PARTIAL_UPDATE_ROWS_EVENT {
 		if cfg.IsTargetDml("update") {
 			goto BinEventCheck
 		} else {
@@ -110,38 +132,22 @@ BinEventCheck:
 		replication.DELETE_ROWS_EVENTv1,
 		replication.WRITE_ROWS_EVENTv2,
 		replication.UPDATE_ROWS_EVENTv2,
-		replication.DELETE_ROWS_EVENTv2:
+		replication.DELETE_ROWS_EVENTv2,
+		replication.PARTIAL_UPDATE_ROWS_EVENT:
 
 		wrEvent := ev.Event.(*replication.RowsEvent)
 		db := string(wrEvent.Table.Schema)
 		tb := string(wrEvent.Table.Table)
-		/*if !cfg.IsTargetTable(db, tb) {
+		if !cfg.IsTargetTable(db, tb) {
 			return C_reContinue
-		}*/
-
-		if len(cfg.Databases) > 0 {
-			if !toolkits.ContainsString(cfg.Databases, db) {
-				return C_reContinue
-			}
-		}
-		if len(cfg.Tables) > 0 {
-			if !toolkits.ContainsString(cfg.Tables, tb) {
-				return C_reContinue
-			}
-		}
-
-		if len(cfg.IgnoreDatabases) > 0 {
-			if toolkits.ContainsString(cfg.IgnoreDatabases, db) {
-				return C_reContinue
-			}
 		}
 
-		if len(cfg.IgnoreTables) > 0 {
-			if toolkits.ContainsString(cfg.IgnoreTables, tb) {
-				return C_reContinue
+		if ev.Header.EventType == replication.PARTIAL_UPDATE_ROWS_EVENT {
+			if err := DecodePartialJsonDiffs(ev); err != nil {
+				log.Warnf("fail to decode the json diffs of %s.%s at %s/%d, no sql is generated for them: %v",
+					db, tb, *currentBinlog, ev.Header.LogPos, err)
 			}
 		}
-
 		this.BinEvent = wrEvent
 		this.IfRowsEvent = true
 	case replication.QUERY_EVENT:
@@ -162,22 +168,135 @@ BinEventCheck:
 
 }
 
-// 辅助函数：判断是否为 DDL
-func isDDLKeyword(sql string) bool {
-	keywords := []string{"CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME"}
-	for _, k := range keywords {
-		if strings.Contains(strings.ToUpper(sql), k) {
-			fmt.Println(sql)
-			return true
+// DispatchBinEvent tracks the transaction status of the event which passed CheckBinEvent,
+// sends it to the sql generating threads and sends its statistic to the stats thread.
+// it is shared by the repl and file readers, tbMapPos is the start position of the last table map event.
+// it returns ctx.Err() if the job is canceled while waiting for the channels
+func (this *ConfCmd) DispatchBinEvent(ctx context.Context, ev *replication.BinlogEvent, oneMyEvent *MyBinEvent, binlog string, tbMapPos uint32) error {
+	var (
+		err      error
+		sqlLower string = ""
+	)
+	db, tb, sqlType, sql, rowCnt := GetDbTbAndQueryAndRowCntFromBinevent(ev)
+	if sqlType == "query" {
+		sqlLower = strings.ToLower(sql)
+		if sqlLower == "begin" {
+			this.trxStatus = C_trxBegin
+			this.trxIndex++
+		} else if sqlLower == "commit" {
+			this.trxStatus = C_trxCommit
+		} else if sqlLower == "rollback" {
+			this.trxStatus = C_trxRollback
+		} else if oneMyEvent.QuerySql != nil {
+			this.trxStatus = C_trxProcess
+			rowCnt = 1
 		}
+	} else {
+		this.trxStatus = C_trxProcess
 	}
-	return false
+
+	if this.WorkType != "stats" {
+		ifSendEvent := false
+		if this.PrintDDL && sqlType == "query" && isDDLKeyword(sql) {
+			oneMyEvent.OrgSql = sql
+			ifSendEvent = true
+		}
+		if !this.PrintDDL && oneMyEvent.IfRowsEvent {
+			// the definition at this position, the ddls after it make new versions
+			oneMyEvent.TbInfo, err = this.TablesColumnsInfo.GetTableInfoForRowsEvent(this, oneMyEvent.BinEvent)
+			if err != nil {
+				return WrapEngineError(ErrCategorySchema, oneMyEvent.MyPos, err)
+			}
+			ifSendEvent = true
+		}
+
+		if ifSendEvent {
+			this.binEventIdx++
+			oneMyEvent.EventIdx = this.binEventIdx
+			oneMyEvent.SqlType = sqlType
+			oneMyEvent.Timestamp = ev.Header.Timestamp
+			oneMyEvent.TrxIndex = this.trxIndex
+			oneMyEvent.TrxStatus = this.trxStatus
+			oneMyEvent.Gtid = this.trxGtid
+			select {
+			case this.EventChan <- *oneMyEvent:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	//output analysis result whatever the WorkType is
+	if sqlType != "" {
+		st := BinEventStats{Timestamp: ev.Header.Timestamp, Binlog: binlog, StartPos: tbMapPos, StopPos: ev.Header.LogPos,
+			Database: db, Table: tb, QuerySql: sql, RowCnt: rowCnt, QueryType: sqlType, Gtid: this.trxGtid,
+			TrxIndex: this.trxIndex}
+		if sqlType == "query" {
+			st.StartPos = ev.Header.LogPos - ev.Header.EventSize
+		}
+		select {
+		case this.StatChan <- st:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// DispatchPayloadEvent checks and dispatches the events compressed in a transaction payload event(binlog_transaction_compression=ON)
+// one by one, as if they were read from binlog. the events are located at the payload event.
+// it returns C_reBreak or C_reFileEnd when CheckBinEvent does, otherwise C_reContinue
+func (this *ConfCmd) DispatchPayloadEvent(ctx context.Context, ev *replication.BinlogEvent, currentBinlog *string) (int, error) {
+	payloadEvent, ok := ev.Event.(*replication.TransactionPayloadEvent)
+	if !ok {
+		return C_reContinue, nil
+	}
+	events, err := this.decodePayloadEvents(payloadEvent)
+	if err != nil {
+		return C_reBreak, NewEngineError(ErrCategoryDecode, mysql.Position{Name: *currentBinlog, Pos: ev.Header.LogPos},
+			"fail to decode the events in the transaction payload event %v", err)
+	}
+	startPos := GetEventStartPos(ev.Header)
+	tbMapPos := startPos
+	for _, inner := range events {
+		inner.Header.LogPos = ev.Header.LogPos
+		inner.Header.EventSize = ev.Header.EventSize
+		if inner.Header.Timestamp == 0 {
+			inner.Header.Timestamp = ev.Header.Timestamp
+		}
+		oneMyEvent := &MyBinEvent{MyPos: mysql.Position{Name: *currentBinlog, Pos: ev.Header.LogPos}, StartPos: tbMapPos}
+		chkRe := oneMyEvent.CheckBinEvent(this, inner, currentBinlog)
+		if chkRe == C_reContinue {
+			continue
+		} else if chkRe == C_reBreak || chkRe == C_reFileEnd {
+			return chkRe, nil
+		}
+		if err := this.DispatchBinEvent(ctx, inner, oneMyEvent, *currentBinlog, tbMapPos); err != nil {
+			return C_reBreak, err
+		}
+	}
+	return C_reContinue, nil
+}
+
+// isBeforeStart returns true if the event at pos is before -start-file/-start-pos or -start-datetime
+func (this *ConfCmd) isBeforeStart(pos mysql.Position, header *replication.EventHeader) bool {
+	if this.IfSetStartFilePos && pos.Compare(this.StartFilePos) < 0 {
+		return true
+	}
+	return this.IfSetStartDateTime && header.Timestamp < this.StartDatetime
+}
+
+var truncateSqlRegexp = regexp.MustCompile(`(?is)^truncate\b`)
+
+// 辅助函数：判断是否为 DDL, the sqls changing table definitions and truncate table
+func isDDLKeyword(sql string) bool {
+	return isSchemaChangeSql(sql) || truncateSqlRegexp.MatchString(leadingCommentRegexp.ReplaceAllString(sql, ""))
 }
 
 func CheckBinHeaderCondition(cfg *ConfCmd, header *replication.EventHeader, currentBinlog string) int {
 	// process: 0, continue: 1, break: 2
 
-	myPos := mysql.Position{Name: currentBinlog, Pos: header.LogPos}
+	myPos := mysql.Position{Name: currentBinlog, Pos: GetEventStartPos(header)}
 	//fmt.Println(cfg.StartFilePos, cfg.IfSetStopFilePos, myPos)
 	if cfg.IfSetStartFilePos {
 		cmpRe := myPos.Compare(cfg.StartFilePos)
@@ -218,7 +337,8 @@ func CheckBinHeaderCondition(cfg *ConfCmd, header *replication.EventHeader, curr
 		}
 	}
 
-	if header.EventType == replication.UPDATE_ROWS_EVENTv1 || header.EventType == replication.UPDATE_ROWS_EVENTv2 {
+	if header.EventType == replication.UPDATE_ROWS_EVENTv1 || header.EventType == replication.UPDATE_ROWS_EVENTv2 ||
+		header.EventType == replication.PARTIAL_UPDATE_ROWS_EVENT {
 		if cfg.IsTargetDml("update") {
 			return C_reProcess
 		} else {
@@ -237,11 +357,22 @@ func CheckBinHeaderCondition(cfg *ConfCmd, header *replication.EventHeader, curr
 	return C_reProcess
 }
 
+// GetEventStartPos returns the start position of the event, 0 for artificial events which are not in the binlog file
+func GetEventStartPos(header *replication.EventHeader) uint32 {
+	if header.LogPos < header.EventSize {
+		return 0
+	}
+	return header.LogPos - header.EventSize
+}
+
 func GetFirstBinlogPosToParse(cfg *ConfCmd) (string, int64) {
 	var binlog string
 	var pos int64
 	if cfg.StartFile != "" {
-		binlog = filepath.Join(cfg.BinlogDir, cfg.StartFile)
+		binlog = FindBinlogFile(cfg.BinlogDir, cfg.StartFile)
+		if binlog == "" {
+			binlog = filepath.Join(cfg.BinlogDir, cfg.StartFile)
+		}
 	} else {
 		binlog = cfg.GivenBinlogFile
 	}
@@ -0,0 +1,113 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestGetEventStartPos(t *testing.T) {
+	tests := []struct {
+		name   string
+		header replication.EventHeader
+		want   uint32
+	}{
+		{name: "event in file", header: replication.EventHeader{LogPos: 500, EventSize: 100}, want: 400},
+		{name: "first event", header: replication.EventHeader{LogPos: 124, EventSize: 120}, want: 4},
+		{name: "artificial rotate event", header: replication.EventHeader{LogPos: 0, EventSize: 47}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetEventStartPos(&tt.header); got != tt.want {
+				t.Errorf("GetEventStartPos() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBinHeaderConditionFilePos(t *testing.T) {
+	// like mysqlbinlog, the event starting at -start-pos is parsed and the one starting at -stop-pos is not
+	cfg := &ConfCmd{
+		IfSetStartFilePos: true, StartFilePos: mysql.Position{Name: "mysql-bin.000002", Pos: 400},
+		IfSetStopFilePos: true, StopFilePos: mysql.Position{Name: "mysql-bin.000003", Pos: 1000},
+	}
+	tests := []struct {
+		name     string
+		binlog   string
+		logPos   uint32
+		wantFlag int
+	}{
+		{name: "before start file", binlog: "mysql-bin.000001", logPos: 500, wantFlag: C_reContinue},
+		{name: "before start pos", binlog: "mysql-bin.000002", logPos: 399, wantFlag: C_reContinue},
+		{name: "ends at start pos", binlog: "mysql-bin.000002", logPos: 400, wantFlag: C_reContinue},
+		{name: "starts at start pos", binlog: "mysql-bin.000002", logPos: 500, wantFlag: C_reProcess},
+		{name: "ends at stop pos", binlog: "mysql-bin.000003", logPos: 1000, wantFlag: C_reProcess},
+		{name: "starts at stop pos", binlog: "mysql-bin.000003", logPos: 1100, wantFlag: C_reBreak},
+		{name: "after stop file", binlog: "mysql-bin.000004", logPos: 200, wantFlag: C_reBreak},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := &replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: tt.logPos, EventSize: 100}
+			if got := CheckBinHeaderCondition(cfg, header, tt.binlog); got != tt.wantFlag {
+				t.Errorf("CheckBinHeaderCondition() = %d, want %d", got, tt.wantFlag)
+			}
+		})
+	}
+}
+
+func TestDispatchPayloadEvent(t *testing.T) {
+	cfg := &ConfCmd{WorkType: "stats", StatChan: make(chan BinEventStats, 10)}
+	if err := cfg.SetPayloadFormat(testFormatDescription()); err != nil {
+		t.Fatal(err)
+	}
+	binlog := "mysql-bin.000001"
+	result, err := cfg.DispatchPayloadEvent(context.Background(), payloadEvent(t), &binlog)
+	if result != C_reContinue || err != nil {
+		t.Fatalf("DispatchPayloadEvent() = %d, %v, want %d, nil", result, err, C_reContinue)
+	}
+	close(cfg.StatChan)
+
+	// the events are located at the payload event, positions in the payload are not binlog positions
+	var types []string
+	for st := range cfg.StatChan {
+		types = append(types, st.QueryType)
+		if st.Binlog != binlog || st.StartPos != 700 || st.StopPos != 1000 || st.Timestamp != 1700000000 {
+			t.Errorf("stats of %s = %s %d-%d %d, want %s 700-1000 1700000000", st.QueryType, st.Binlog, st.StartPos, st.StopPos, st.Timestamp, binlog)
+		}
+	}
+	if got := fmt.Sprint(types); got != "[query insert query]" {
+		t.Errorf("stats of %s sent, want [query insert query]", got)
+	}
+}
+
+func TestDispatchPayloadEventStop(t *testing.T) {
+	tests := []struct {
+		name       string
+		stopPos    uint32
+		wantResult int
+		wantStats  int
+	}{
+		{name: "stop at payload event", stopPos: 700, wantResult: C_reBreak},
+		{name: "stop after payload event", stopPos: 1000, wantResult: C_reContinue, wantStats: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ConfCmd{WorkType: "stats", StatChan: make(chan BinEventStats, 10),
+				IfSetStopFilePos: true, StopFilePos: mysql.Position{Name: "mysql-bin.000001", Pos: tt.stopPos}}
+			if err := cfg.SetPayloadFormat(testFormatDescription()); err != nil {
+				t.Fatal(err)
+			}
+			binlog := "mysql-bin.000001"
+			result, err := cfg.DispatchPayloadEvent(context.Background(), payloadEvent(t), &binlog)
+			if result != tt.wantResult || err != nil {
+				t.Fatalf("DispatchPayloadEvent() = %d, %v, want %d, nil", result, err, tt.wantResult)
+			}
+			if len(cfg.StatChan) != tt.wantStats {
+				t.Errorf("%d stats sent, want %d", len(cfg.StatChan), tt.wantStats)
+			}
+		})
+	}
+}
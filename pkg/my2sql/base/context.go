@@ -1,12 +1,14 @@
 package base
 
 import (
+	"context"
 	"database/sql"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"time"
 
 	constvar "my-wails-app/pkg/my2sql/constvar"
@@ -23,6 +25,8 @@ const (
 	C_joinSepComma = ","
 
 	EventTimeout = 5 * time.Second
+	// with -follow, mysql sends a heartbeat event when there is no binlog event for this period
+	FollowHeartbeatPeriod = 10 * time.Second
 
 	C_unknownColPrefix   = "dropped_column_"
 	C_unknownColType     = "unknown_type"
@@ -40,14 +44,12 @@ const (
 )
 
 var (
-	GConfCmd            *ConfCmd = &ConfCmd{}
-	GBinlogTimeLocation *time.Location
 	//GSqlParser          *parser.Parser = parser.New()
 
 	GUseDatabase string = ""
 
 	GOptsValidMode      []string = []string{"repl", "file"}
-	GOptsValidWorkType  []string = []string{"2sql", "rollback", "stats"}
+	GOptsValidWorkType  []string = []string{"2sql", "rollback", "stats", "archive"}
 	GOptsValidMysqlType []string = []string{"mysql", "mariadb"}
 	GOptsValidFilterSql []string = []string{"insert", "update", "delete"}
 
@@ -106,10 +108,22 @@ type ConfCmd struct {
 	StartDatetime      uint32
 	StopDatetime       uint32
 	BinlogTimeLocation string
+	BinlogTimeLoc      *time.Location
+	SqlTimeZone        string // time_zone of the sql files, see SetTimeZone
 
 	IfSetStartDateTime bool
 	IfSetStopDateTime  bool
 
+	// gtid sets in the format of MysqlType, see ParseGtidOptions
+	StartGtid      string
+	StopGtid       string
+	IncludeGtids   string
+	ExcludeGtids   string
+	StartGtidSet   mysql.GTIDSet
+	StopGtidSet    mysql.GTIDSet
+	IncludeGtidSet mysql.GTIDSet
+	ExcludeGtidSet mysql.GTIDSet
+
 	LocalBinFile string
 
 	OutputToScreen bool
@@ -119,6 +133,11 @@ type ConfCmd struct {
 
 	IfSetStopParsPoint bool
 
+	// keep getting binlog from mysql until the job is stopped, instead of quitting after EventTimeout without events
+	Follow bool
+	// continue the job from the checkpoint in OutputDir, see LoadCheckpoint
+	Resume bool
+
 	OutputDir string
 
 	//MinColumns     bool
@@ -127,6 +146,8 @@ type ConfCmd struct {
 	KeepTrx        bool
 	SqlTblPrefixDb bool
 	FilePerTable   bool
+	// write the index of enum and the bitmask of set instead of the labels, for debugging
+	EnumSetRawIndex bool
 
 	PrintExtraInfo bool
 
@@ -137,6 +158,8 @@ type ConfCmd struct {
 	DumpTblDefToFile   string
 
 	BinlogDir string
+	// parse every binlog of BinlogDir from GivenBinlogFile on, set when a directory is given in file mode
+	ParseWholeDir bool
 
 	GivenBinlogFile string
 
@@ -159,14 +182,56 @@ type ConfCmd struct {
 	//DdlFH     *os.File
 	BiglongFH *os.File
 
+	BinlogSyncer   *replication.BinlogSyncer
 	BinlogStreamer *replication.BinlogStreamer
-	FromDB         *sql.DB
-
-	PrintDDL  bool
-	IsStopped bool
+	// decodes the events compressed in the transaction payload events, see SetPayloadFormat
+	payloadParser *replication.BinlogParser
+	FromDB        *sql.DB
+	// guards FromDB when it is connected lazily, see GetFromDB
+	fromDBLock sync.Mutex
+	// SRIDs of the geographic spatial reference systems of mysql 8.0, nil for mysql 5.7 or without mysql
+	GeographicSrids map[uint32]bool
+
+	PrintDDL bool
+
+	// cancel the context of the job, see NewJobContext
+	cancel context.CancelFunc
+	// end position of the last event whose result has been written, see SetProgress
+	progress     mysql.Position
+	progressLock sync.Mutex
+
+	// checkpoint the job resumes from, and the one being saved, see checkpoint.go
+	resumeFrom     *Checkpoint
+	checkpoint     Checkpoint
+	checkpointLock sync.Mutex
+
+	// rows events whose sqls are not generated because of partial row images, see row_image.go
+	rowImageWarnings     map[string]map[string]*RowImageWarning
+	rowImageWarningsLock sync.Mutex
+
+	// the first error of the job, see SetJobError
+	jobErr     error
+	jobErrLock sync.Mutex
+
+	// per job state, every job owns its own sql ordering index and table structure cache
+	HandlingBinEventIndex *BinEventHandlingIndx
+	TablesColumnsInfo     TablesColumnsInfo
+
+	// index of events sent to EventChan and of transactions, maintained by the binlog reader
+	binEventIdx uint64
+	trxIndex    uint64
+	trxStatus   int
+	// gtid of the current transaction and whether it is skipped by the gtid options, see CheckGtidEvent
+	trxGtid string
+	skipTrx bool
+	// gtids of the transactions seen so far, the job stops once it contains StopGtidSet
+	seenGtidSet mysql.GTIDSet
 }
 
-func (this *ConfCmd) ParseCmdOptions() {
+// ParseCmdOptions parses the command line options args of the job, every call has its own flag set.
+// done is true if the options ask for nothing but a task which is finished in it, ex: -v, -dump-tbl-def-file,
+// the job is not to run then and no result file is opened
+func (this *ConfCmd) ParseCmdOptions(args []string) (done bool, err error) {
 	var (
 		version   bool
 		dbs       string
@@ -177,75 +242,88 @@ func (this *ConfCmd) ParseCmdOptions() {
 		sqlTypes         string
 		startTime        string
 		stopTime         string
-		err              error
 		doNotAddPrifixDb bool
 	)
 
-	flag.Usage = func() {
-		this.PrintUsageMsg()
+	fs := flag.NewFlagSet("my2sql", flag.ContinueOnError)
+	fs.Usage = func() {
+		this.PrintUsageMsg(fs)
 	}
 
-	flag.BoolVar(&version, "v", false, "print version")
-	flag.StringVar(&this.Mode, "mode", "repl", StrSliceToString(GOptsValidMode, C_joinSepComma, C_validOptMsg)+". repl: as a slave to get binlogs from master. file: get binlogs from local filesystem. default repl")
-	flag.StringVar(&this.WorkType, "work-type", "2sql", StrSliceToString(GOptsValidWorkType, C_joinSepComma, C_validOptMsg)+". 2sql: convert binlog to sqls, rollback: generate rollback sqls, stats: analyze transactions. default: 2sql")
-	flag.StringVar(&this.MysqlType, "mysql-type", "mysql", StrSliceToString(GOptsValidMysqlType, C_joinSepComma, C_validOptMsg)+". server of binlog, mysql or mariadb, default mysql")
+	fs.BoolVar(&version, "v", false, "print version")
+	fs.StringVar(&this.Mode, "mode", "repl", StrSliceToString(GOptsValidMode, C_joinSepComma, C_validOptMsg)+". repl: as a slave to get binlogs from master. file: get binlogs from local filesystem. default repl")
+	fs.StringVar(&this.WorkType, "work-type", "2sql", StrSliceToString(GOptsValidWorkType, C_joinSepComma, C_validOptMsg)+". 2sql: convert binlog to sqls, rollback: generate rollback sqls, stats: analyze transactions, archive: save binlog files from mysql as they are. default: 2sql")
+	fs.StringVar(&this.MysqlType, "mysql-type", "mysql", StrSliceToString(GOptsValidMysqlType, C_joinSepComma, C_validOptMsg)+". server of binlog, mysql or mariadb, default mysql")
 
-	flag.StringVar(&this.Host, "host", "127.0.0.1", "mysql host, default 127.0.0.1 .")
-	flag.UintVar(&this.Port, "port", 3306, "mysql port, default 3306.")
-	flag.StringVar(&this.User, "user", "", "mysql user. ")
-	flag.StringVar(&this.Passwd, "password", "", "mysql user password.")
-	flag.UintVar(&this.ServerId, "server-id", 1113306, "this program replicates from mysql as slave to read binlogs. Must set this server id unique from other slaves, default 1113306")
+	fs.StringVar(&this.Host, "host", "127.0.0.1", "mysql host, default 127.0.0.1 .")
+	fs.UintVar(&this.Port, "port", 3306, "mysql port, default 3306.")
+	fs.StringVar(&this.User, "user", "", "mysql user. ")
+	fs.StringVar(&this.Passwd, "password", "", "mysql user password.")
+	fs.UintVar(&this.ServerId, "server-id", 1113306, "this program replicates from mysql as slave to read binlogs. Must set this server id unique from other slaves, default 1113306")
 
-	flag.StringVar(&dbs, "databases", "", "only parse these databases, comma seperated, default all.")
-	flag.StringVar(&tbs, "tables", "", "only parse these tables, comma seperated, DONOT prefix with schema, default all.")
-	flag.StringVar(&ignoreDbs, "ignore-databases", "", "ignore parse these databases, comma seperated, default null")
-	flag.StringVar(&ignoreTbs, "ignore-tables", "", "ignore parse these tables, comma seperated, default null")
-	flag.StringVar(&sqlTypes, "sql", "", StrSliceToString(GOptsValidFilterSql, C_joinSepComma, C_validOptMsg)+". only parse these types of sql, comma seperated, valid types are: insert, update, delete; default is all(insert,update,delete)")
-	flag.BoolVar(&this.IgnorePrimaryKeyForInsert, "ignore-primaryKey-forInsert", false, "for insert statement when -workType=2sql, ignore primary key")
+	fs.StringVar(&dbs, "databases", "", "only parse these databases, comma seperated, default all.")
+	fs.StringVar(&tbs, "tables", "", "only parse these tables, comma seperated, DONOT prefix with schema, default all.")
+	fs.StringVar(&ignoreDbs, "ignore-databases", "", "ignore parse these databases, comma seperated, default null")
+	fs.StringVar(&ignoreTbs, "ignore-tables", "", "ignore parse these tables, comma seperated, default null")
+	fs.StringVar(&sqlTypes, "sql", "", StrSliceToString(GOptsValidFilterSql, C_joinSepComma, C_validOptMsg)+". only parse these types of sql, comma seperated, valid types are: insert, update, delete; default is all(insert,update,delete)")
+	fs.BoolVar(&this.IgnorePrimaryKeyForInsert, "ignore-primaryKey-forInsert", false, "for insert statement when -workType=2sql, ignore primary key")
 
-	flag.StringVar(&this.StartFile, "start-file", "", "binlog file to start reading")
-	flag.UintVar(&this.StartPos, "start-pos", 4, "start reading the binlog at position")
-	flag.StringVar(&this.StopFile, "stop-file", "", "binlog file to stop reading")
-	flag.UintVar(&this.StopPos, "stop-pos", 4, "Stop reading the binlog at position")
-	flag.StringVar(&this.LocalBinFile, "local-binlog-file", "", "local binlog files to process, It works with -mode=file ")
+	fs.StringVar(&this.StartFile, "start-file", "", "binlog file to start reading")
+	fs.UintVar(&this.StartPos, "start-pos", 4, "start reading the binlog at position")
+	fs.StringVar(&this.StopFile, "stop-file", "", "binlog file to stop reading")
+	fs.UintVar(&this.StopPos, "stop-pos", 4, "Stop reading the binlog at position")
+	fs.StringVar(&this.LocalBinFile, "local-binlog-file", "", "local binlog files to process, It works with -mode=file ")
 
-	flag.StringVar(&this.BinlogTimeLocation, "tl", "Local", "time location to parse timestamp/datetime column in binlog, such as Asia/Shanghai. default Local")
-	flag.StringVar(&startTime, "start-datetime", "", "Start reading the binlog at first event having a datetime equal or posterior to the argument, it should be like this: \"2020-01-01 01:00:00\"")
-	flag.StringVar(&stopTime, "stop-datetime", "", "Stop reading the binlog at first event having a datetime equal or posterior to the argument, it should be like this: \"2020-12-30 01:00:00\"")
+	fs.StringVar(&this.BinlogTimeLocation, "tl", "Local", "time zone to parse -start-datetime/-stop-datetime and to write timestamp columns, such as Asia/Shanghai, +08:00, or server for the time zone of mysql. default Local")
+	fs.StringVar(&startTime, "start-datetime", "", "Start reading the binlog at first event having a datetime equal or posterior to the argument, it should be like this: \"2020-01-01 01:00:00\"")
+	fs.StringVar(&stopTime, "stop-datetime", "", "Stop reading the binlog at first event having a datetime equal or posterior to the argument, it should be like this: \"2020-12-30 01:00:00\"")
 
-	flag.BoolVar(&this.OutputToScreen, "output-toScreen", false, "Just output to screen,do not write to file")
-	flag.BoolVar(&this.PrintExtraInfo, "add-extraInfo", true, "Works with -work-type=2sql|rollback. Print database/table/datetime/binlogposition...info on the line before sql, default false")
+	fs.BoolVar(&this.OutputToScreen, "output-toScreen", false, "Just output to screen,do not write to file")
+	fs.BoolVar(&this.PrintExtraInfo, "add-extraInfo", true, "Works with -work-type=2sql|rollback. Print database/table/datetime/binlogposition...info on the line before sql, default false")
 
-	flag.BoolVar(&this.FullColumns, "full-columns", false, "For update sql, include unchanged columns. for update and delete, use all columns to build where condition.\t\ndefault false, this is, use changed columns to build set part, use primary/unique key to build where condition")
-	flag.BoolVar(&doNotAddPrifixDb, "do-not-add-prifixDb", false, "Prefix table name witch database name in sql,ex: insert into db1.tb1 (x1, x1) values (y1, y1). ")
-	flag.BoolVar(&this.UseUniqueKeyFirst, "U", false, "prefer to use unique key instead of primary key to build where condition for delete/update sql")
+	fs.BoolVar(&this.FullColumns, "full-columns", false, "For update sql, include unchanged columns. for update and delete, use all columns to build where condition.\t\ndefault false, this is, use changed columns to build set part, use primary/unique key to build where condition")
+	fs.BoolVar(&this.EnumSetRawIndex, "enum-set-raw-index", false, "write enum and set columns as the index and the bitmask in binlog instead of the labels, for debugging.\t\ndefault false, the labels are taken from the table definitions")
+	fs.BoolVar(&doNotAddPrifixDb, "do-not-add-prifixDb", false, "Prefix table name witch database name in sql,ex: insert into db1.tb1 (x1, x1) values (y1, y1). ")
+	fs.BoolVar(&this.UseUniqueKeyFirst, "U", false, "prefer to use unique key instead of primary key to build where condition for delete/update sql")
 
-	flag.StringVar(&this.OutputDir, "output-dir", "", "result output dir, default current work dir. Attension, result files could be large, set it to a dir with large free space")
-	flag.BoolVar(&this.FilePerTable, "file-per-table", false, "One file for one table if true, else one file for all tables. default false. Attention, always one file for one binlog")
-	flag.IntVar(&this.PrintInterval, "print-interval", this.GetDefaultValueOfRange("PrintInterval"), "works with -w='stats', print stats info each PrintInterval. "+this.GetDefaultAndRangeValueMsg("PrintInterval"))
-	flag.IntVar(&this.BigTrxRowLimit, "big-trx-row-limit", this.GetDefaultValueOfRange("BigTrxRowLimit"), "transaction with affected rows greater or equal to this value is considerated as big transaction. "+this.GetDefaultAndRangeValueMsg("BigTrxRowLimit"))
-	flag.IntVar(&this.LongTrxSeconds, "long-trx-seconds", this.GetDefaultValueOfRange("LongTrxSeconds"), "transaction with duration greater or equal to this value is considerated as long transaction. "+this.GetDefaultAndRangeValueMsg("LongTrxSeconds"))
+	fs.StringVar(&this.StartGtid, "start-gtid", "", "skip the transactions in this gtid set, start reading the binlog after them. with -mode=repl, mysql only sends binlog after it")
+	fs.StringVar(&this.StopGtid, "stop-gtid", "", "stop reading the binlog once all the transactions in this gtid set are read")
+	fs.StringVar(&this.IncludeGtids, "include-gtids", "", "only parse the transactions in this gtid set")
+	fs.StringVar(&this.ExcludeGtids, "exclude-gtids", "", "ignore the transactions in this gtid set")
 
-	flag.UintVar(&this.Threads, "threads", uint(this.GetDefaultValueOfRange("Threads")), "Works with -workType=2sql|rollback. threads to run")
+	fs.StringVar(&this.OutputDir, "output-dir", "", "result output dir, default current work dir. Attension, result files could be large, set it to a dir with large free space")
+	fs.BoolVar(&this.FilePerTable, "file-per-table", false, "One file for one table if true, else one file for all tables. default false. Attention, always one file for one binlog")
+	fs.IntVar(&this.PrintInterval, "print-interval", this.GetDefaultValueOfRange("PrintInterval"), "works with -w='stats', print stats info each PrintInterval. "+this.GetDefaultAndRangeValueMsg("PrintInterval"))
+	fs.IntVar(&this.BigTrxRowLimit, "big-trx-row-limit", this.GetDefaultValueOfRange("BigTrxRowLimit"), "transaction with affected rows greater or equal to this value is considerated as big transaction. "+this.GetDefaultAndRangeValueMsg("BigTrxRowLimit"))
+	fs.IntVar(&this.LongTrxSeconds, "long-trx-seconds", this.GetDefaultValueOfRange("LongTrxSeconds"), "transaction with duration greater or equal to this value is considerated as long transaction. "+this.GetDefaultAndRangeValueMsg("LongTrxSeconds"))
 
-	flag.BoolVar(&this.PrintDDL, "print-ddl", false, "print ddl to result file")
+	fs.UintVar(&this.Threads, "threads", uint(this.GetDefaultValueOfRange("Threads")), "Works with -workType=2sql|rollback. threads to run")
 
-	flag.Parse()
+	fs.BoolVar(&this.PrintDDL, "print-ddl", false, "print ddl to result file")
+	fs.StringVar(&this.DumpTblDefToFile, "dump-tbl-def-file", "", "dump the definitions of the tables selected by -databases -tables -ignore-databases -ignore-tables from mysql into this json file, then exit")
+	fs.StringVar(&this.ReadTblDefJsonFile, "read-tbl-def-file", "", "read table definitions from this json file dumped by -dump-tbl-def-file, the tables not in it are taken from mysql")
+	fs.BoolVar(&this.OnlyColFromFile, "only-col-from-file", false, "works with -read-tbl-def-file. only take table definitions from the json file, do not connect to mysql for them, ex: parse binlog files of a host which is gone")
+	fs.BoolVar(&this.Resume, "resume", false, "continue the job stopped or crashed from the checkpoint in -output-dir, with the same options")
+	fs.BoolVar(&this.Follow, "follow", false, "works with -mode=repl. keep getting binlog from mysql until it is killed, stats are printed each PrintInterval")
+
+	if err = fs.Parse(args); err != nil {
+		return false, NewConfigError("%v", err)
+	}
 
 	if version {
 		fmt.Printf("%s\n", C_Version)
-		os.Exit(0)
+		return true, nil
 	}
 
 	if this.Mode != "repl" && this.Mode != "file" {
-		log.Fatalf("unsupported mode=%s, valid modes: file, repl", this.Mode)
+		return false, NewConfigError("unsupported mode=%s, valid modes: file, repl", this.Mode)
 	}
 
 	// check --output-dir
 	if this.OutputDir != "" {
 		ifExist, errMsg := CheckIsDir(this.OutputDir)
 		if !ifExist {
-			log.Fatalf("OutputDir -o=%s DIR_NOT_EXISTS", errMsg)
+			return false, NewConfigError("OutputDir -o=%s DIR_NOT_EXISTS", errMsg)
 		}
 	} else {
 		this.OutputDir, _ = os.Getwd()
@@ -281,22 +359,23 @@ func (this *ConfCmd) ParseCmdOptions() {
 	if sqlTypes != "" {
 		this.FilterSql = CommaSeparatedListToArray(sqlTypes)
 		for _, oneSqlT := range this.FilterSql {
-			CheckElementOfSliceStr(GOptsValidFilterSql, oneSqlT, "invalid sqltypes", true)
+			if !CheckElementOfSliceStr(GOptsValidFilterSql, oneSqlT, "invalid sqltypes", true) {
+				return false, NewConfigError("invalid sqltypes %s", oneSqlT)
+			}
 		}
 		this.FilterSqlLen = len(this.FilterSql)
 	} else {
 		this.FilterSqlLen = 0
 	}
 
-	GBinlogTimeLocation, err = time.LoadLocation(this.BinlogTimeLocation)
-	if err != nil {
-		log.Fatalf("invalid time location %v"+this.BinlogTimeLocation, err)
+	if err = this.SetTimeZone(this.BinlogTimeLocation); err != nil {
+		return false, err
 	}
 
 	if startTime != "" {
-		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, startTime, GBinlogTimeLocation)
+		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, startTime, this.BinlogTimeLoc)
 		if err != nil {
-			log.Fatalf("invalid start datetime -start-datetime " + startTime)
+			return false, NewConfigError("invalid start datetime -start-datetime %s", startTime)
 		}
 		this.StartDatetime = uint32(t.Unix())
 		this.IfSetStartDateTime = true
@@ -305,9 +384,9 @@ func (this *ConfCmd) ParseCmdOptions() {
 	}
 
 	if stopTime != "" {
-		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, stopTime, GBinlogTimeLocation)
+		t, err := time.ParseInLocation(constvar.DATETIME_FORMAT, stopTime, this.BinlogTimeLoc)
 		if err != nil {
-			log.Fatalf("invalid stop datetime -stop-datetime " + stopTime)
+			return false, NewConfigError("invalid stop datetime -stop-datetime %s", stopTime)
 		}
 		this.StopDatetime = uint32(t.Unix())
 		this.IfSetStopDateTime = true
@@ -317,7 +396,7 @@ func (this *ConfCmd) ParseCmdOptions() {
 
 	if startTime != "" && stopTime != "" {
 		if this.StartDatetime >= this.StopDatetime {
-			log.Fatalf("-start-datetime must be ealier than -stop-datetime")
+			return false, NewConfigError("-start-datetime must be ealier than -stop-datetime")
 		}
 	}
 
@@ -342,11 +421,11 @@ func (this *ConfCmd) ParseCmdOptions() {
 	if this.Mode == "file" {
 
 		if this.StartFile == "" {
-			log.Fatalf("missing binlog file.  -start-file must be specify when -mode=file ")
+			return false, NewConfigError("missing binlog file.  -start-file must be specify when -mode=file ")
 		}
 		this.GivenBinlogFile = this.StartFile
 		if !toolkits.IsFile(this.GivenBinlogFile) {
-			log.Fatalf("%s doesnot exists nor a file\n", this.GivenBinlogFile)
+			return false, NewConfigError("%s doesnot exists nor a file", this.GivenBinlogFile)
 		} else {
 			this.BinlogDir = filepath.Dir(this.GivenBinlogFile)
 		}
@@ -354,37 +433,99 @@ func (this *ConfCmd) ParseCmdOptions() {
 
 	if this.Mode == "file" {
 		if this.LocalBinFile == "" {
-			log.Fatalf("missing binlog file.  -local-binlog-file must be specify when -mode=file ")
+			return false, NewConfigError("missing binlog file.  -local-binlog-file must be specify when -mode=file ")
 		}
 		this.GivenBinlogFile = this.LocalBinFile
 		if !toolkits.IsFile(this.GivenBinlogFile) {
-			log.Fatalf("%s doesnot exists nor a file\n", this.GivenBinlogFile)
+			return false, NewConfigError("%s doesnot exists nor a file", this.GivenBinlogFile)
 		} else {
 			this.BinlogDir = filepath.Dir(this.GivenBinlogFile)
 		}
 	}
 
+	if this.DumpTblDefToFile != "" {
+		if this.OnlyColFromFile {
+			return false, NewConfigError("-dump-tbl-def-file takes table definitions from mysql, it can not work with -only-col-from-file")
+		}
+		cnt, err := this.DumpTableDefs()
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("definitions of %d tables are dumped into %s\n", cnt, this.DumpTblDefToFile)
+		return true, nil
+	}
+
 	this.EventChan = make(chan MyBinEvent, this.Threads*2)
 	this.StatChan = make(chan BinEventStats, this.Threads*2)
 	this.SqlChan = make(chan ForwardRollbackSqlOfPrint, this.Threads*2)
 	this.StatChan = make(chan BinEventStats, this.Threads*2)
-	this.OpenStatsResultFiles()
-	this.OpenTxResultFiles()
+	if err = this.LoadCheckpoint(); err != nil {
+		return false, err
+	}
+	if err = this.OpenStatsResultFiles(); err != nil {
+		return false, err
+	}
+	if err = this.OpenTxResultFiles(); err != nil {
+		return false, err
+	}
 
-	this.CheckCmdOptions()
-	this.CreateDB()
+	if err = this.CheckCmdOptions(); err != nil {
+		return false, err
+	}
+	if err = this.LoadTableDefs(); err != nil {
+		return false, err
+	}
+	if this.OnlyColFromFile {
+		return false, nil
+	}
+	return false, this.CreateDB()
 
 }
 
-func (this *ConfCmd) CheckCmdOptions() {
+func (this *ConfCmd) CheckCmdOptions() error {
 	//check -mode
-	CheckElementOfSliceStr(GOptsValidMode, this.Mode, "invalid arg for -mode", true)
+	if !CheckElementOfSliceStr(GOptsValidMode, this.Mode, "invalid arg for -mode", true) {
+		return NewConfigError("invalid arg for -mode: %s", this.Mode)
+	}
 
 	//check -workType
-	CheckElementOfSliceStr(GOptsValidWorkType, this.WorkType, "invalid arg for -workType", true)
+	if !CheckElementOfSliceStr(GOptsValidWorkType, this.WorkType, "invalid arg for -workType", true) {
+		return NewConfigError("invalid arg for -workType: %s", this.WorkType)
+	}
 
 	//check -mysqlType
-	CheckElementOfSliceStr(GOptsValidMysqlType, this.MysqlType, "invalid arg for -mysqlType", true)
+	if !CheckElementOfSliceStr(GOptsValidMysqlType, this.MysqlType, "invalid arg for -mysqlType", true) {
+		return NewConfigError("invalid arg for -mysqlType: %s", this.MysqlType)
+	}
+
+	//check --start-gtid --stop-gtid --include-gtids --exclude-gtids
+	if err := this.ParseGtidOptions(); err != nil {
+		return err
+	}
+	if this.Follow && this.Mode != "repl" {
+		return NewConfigError("-follow only works with -mode=repl")
+	}
+
+	if this.WorkType == "archive" {
+		if this.Mode != "repl" {
+			return NewConfigError("-work-type=archive only works with -mode=repl")
+		}
+		if this.StartGtidSet != nil || this.Resume {
+			// binlog files are saved from their beginning, use -start-file or -start-datetime
+			return NewConfigError("-start-gtid and -resume are not supported by -work-type=archive")
+		}
+	}
+
+	if this.OnlyColFromFile && this.ReadTblDefJsonFile == "" {
+		return NewConfigError("-only-col-from-file requires -read-tbl-def-file")
+	}
+	if this.OnlyColFromFile && this.DumpTblDefToFile != "" {
+		return NewConfigError("-dump-tbl-def-file takes table definitions from mysql, it can not work with -only-col-from-file")
+	}
+
+	if this.StartGtidSet != nil && this.IfSetStartFilePos && this.resumeFrom == nil {
+		return NewConfigError("-start-gtid and -start-file cannot be set at the same time")
+	}
 
 	/*if this.Mode == "repl" {
 		//check --user
@@ -404,35 +545,45 @@ func (this *ConfCmd) CheckCmdOptions() {
 	if this.StartFile != "" && this.StartPos != 0 && this.StopFile != "" && this.StopPos != 0 {
 		cmpRes := CompareBinlogPos(this.StartFile, this.StartPos, this.StopFile, this.StopPos)
 		if cmpRes != -1 {
-			log.Fatalf("start postion(-start-file -start-pos) must less than stop position(-end-file -end-pos)")
+			return NewConfigError("start postion(-start-file -start-pos) must less than stop position(-end-file -end-pos)")
 		}
 	}
 
 	// check --threads
 	if this.Threads != uint(this.GetDefaultValueOfRange("Threads")) {
-		this.CheckValueInRange("Threads", int(this.Threads), "value of -threads out of range", true)
+		if err := this.CheckValueInRange("Threads", int(this.Threads), "value of -threads out of range"); err != nil {
+			return err
+		}
 	}
 
 	// check --interval
 	if this.PrintInterval != this.GetDefaultValueOfRange("PrintInterval") {
-		this.CheckValueInRange("PrintInterval", this.PrintInterval, "value of -i out of range", true)
+		if err := this.CheckValueInRange("PrintInterval", this.PrintInterval, "value of -i out of range"); err != nil {
+			return err
+		}
 	}
 
 	// check --big-trx-rows
 	if this.BigTrxRowLimit != this.GetDefaultValueOfRange("BigTrxRowLimit") {
-		this.CheckValueInRange("BigTrxRowLimit", this.BigTrxRowLimit, "value of -b out of range", true)
+		if err := this.CheckValueInRange("BigTrxRowLimit", this.BigTrxRowLimit, "value of -b out of range"); err != nil {
+			return err
+		}
 	}
 
 	// check --long-trx-seconds
 	if this.LongTrxSeconds != this.GetDefaultValueOfRange("LongTrxSeconds") {
-		this.CheckValueInRange("LongTrxSeconds", this.LongTrxSeconds, "value of -l out of range", true)
+		if err := this.CheckValueInRange("LongTrxSeconds", this.LongTrxSeconds, "value of -l out of range"); err != nil {
+			return err
+		}
 	}
 
 	// check --threads
 	if this.Threads != uint(this.GetDefaultValueOfRange("Threads")) {
-		this.CheckValueInRange("Threads", int(this.Threads), "value of -t out of range", true)
+		if err := this.CheckValueInRange("Threads", int(this.Threads), "value of -t out of range"); err != nil {
+			return err
+		}
 	}
-
+	return nil
 }
 
 func (this *ConfCmd) CheckRequiredOption(v interface{}, prefix string, ifExt bool) bool {
@@ -448,29 +599,17 @@ func (this *ConfCmd) CheckRequiredOption(v interface{}, prefix string, ifExt boo
 			notOk = true
 		}
 	}
-	if notOk {
-		log.Fatalf("%s", prefix)
+	if notOk && ifExt {
+		log.Error(prefix)
 	}
-	return true
+	return !notOk
 }
 
-func (this *ConfCmd) CheckValueInRange(opt string, val int, prefix string, ifExt bool) bool {
-	valOk := true
-	if val < this.GetMinValueOfRange(opt) {
-		valOk = false
-	} else if val > this.GetMaxValueOfRange(opt) {
-		valOk = false
+func (this *ConfCmd) CheckValueInRange(opt string, val int, prefix string) error {
+	if val < this.GetMinValueOfRange(opt) || val > this.GetMaxValueOfRange(opt) {
+		return NewConfigError("%s: %d is specfied, but %s", prefix, val, this.GetDefaultAndRangeValueMsg(opt))
 	}
-
-	if !valOk {
-
-		if ifExt {
-			log.Fatalf(fmt.Sprintf("%s: %d is specfied, but %s\n", prefix, val, this.GetDefaultAndRangeValueMsg(opt)))
-		} else {
-			log.Error(fmt.Sprintf("%s: %d is specfied, but %s\n", prefix, val, this.GetDefaultAndRangeValueMsg(opt)))
-		}
-	}
-	return valOk
+	return nil
 }
 
 func (this *ConfCmd) GetMinValueOfRange(opt string) int {
@@ -526,6 +665,23 @@ func (this *ConfCmd) GetDefaultAndRangeValueMsg(opt string) string {
 
 }*/
 
+// IsTargetTable returns true if the table is selected by -databases -tables -ignore-databases -ignore-tables
+func (this *ConfCmd) IsTargetTable(db string, tb string) bool {
+	if len(this.Databases) > 0 && !toolkits.ContainsString(this.Databases, db) {
+		return false
+	}
+	if len(this.Tables) > 0 && !toolkits.ContainsString(this.Tables, tb) {
+		return false
+	}
+	if len(this.IgnoreDatabases) > 0 && toolkits.ContainsString(this.IgnoreDatabases, db) {
+		return false
+	}
+	if len(this.IgnoreTables) > 0 && toolkits.ContainsString(this.IgnoreTables, tb) {
+		return false
+	}
+	return true
+}
+
 func (this *ConfCmd) IsTargetDml(dml string) bool {
 	if this.FilterSqlLen < 1 {
 		return true
@@ -537,29 +693,54 @@ func (this *ConfCmd) IsTargetDml(dml string) bool {
 	}
 }
 
-func (this *ConfCmd) OpenStatsResultFiles() {
+func (this *ConfCmd) OpenStatsResultFiles() error {
 	statFile := filepath.Join(this.OutputDir, "binlog_status.txt")
+	if f, ok := FindCheckpointFile(this.ResumedPart(false), statFile); ok {
+		statFH, err := OpenResumedFile(f)
+		if err != nil {
+			return err
+		}
+		this.StatFH = statFH
+		return nil
+	}
 	statFH, err := os.OpenFile(statFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		log.Fatalf("fail to open file %v"+statFile, err)
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to open file %s %v", statFile, err)
 	}
 	statFH.WriteString(GetStatsPrintHeaderLine(Stats_Result_Header_Column_names))
 	this.StatFH = statFH
+	return nil
 }
 
-func (this *ConfCmd) OpenTxResultFiles() {
+func (this *ConfCmd) OpenTxResultFiles() error {
 	biglongFile := filepath.Join(this.OutputDir, "biglong_trx.txt")
+	if f, ok := FindCheckpointFile(this.ResumedPart(false), biglongFile); ok {
+		biglongFH, err := OpenResumedFile(f)
+		if err != nil {
+			return err
+		}
+		this.BiglongFH = biglongFH
+		return nil
+	}
 	biglongFH, err := os.OpenFile(biglongFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		log.Fatalf("fail to open file %v"+biglongFile, err)
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to open file %s %v", biglongFile, err)
 	}
 	biglongFH.WriteString(GetBigLongTrxPrintHeaderLine(Stats_BigLongTrx_Header_Column_names))
 	this.BiglongFH = biglongFH
+	return nil
 }
 
 func (this *ConfCmd) CloseFH() {
-	this.StatFH.Close()
-	this.BiglongFH.Close()
+	if this.StatFH != nil {
+		this.StatFH.Close()
+	}
+	if this.BiglongFH != nil {
+		this.BiglongFH.Close()
+	}
+	if this.FromDB != nil {
+		this.FromDB.Close()
+	}
 }
 
 func (this *ConfCmd) CloseChan() {
@@ -573,16 +754,65 @@ func (this *ConfCmd) CloseChan() {
 	}
 }
 
-func (this *ConfCmd) CreateDB() {
+// CreateDB connects to mysql, the geographic spatial reference systems of it are taken for the geometry values
+func (this *ConfCmd) CreateDB() error {
 	url := GetMysqlUrl(this)
 	db, err := CreateMysqlCon(url)
 	if err != nil {
-		log.Fatalf("Connect mysql failed %v", err)
+		return NewEngineError(ErrCategoryConnection, mysql.Position{}, "Connect mysql failed %v", err)
 	}
+	if this.GeographicSrids, err = GetGeographicSrids(db); err != nil {
+		// the spatial reference systems are in mysql 8.0+
+		log.Infof("no geographic spatial reference system in mysql: %v", err)
+	}
+	this.fromDBLock.Lock()
 	this.FromDB = db
+	this.fromDBLock.Unlock()
+	return nil
+}
+
+// GetFromDB returns the connection to mysql, it connects if CreateDB is not called
+func (this *ConfCmd) GetFromDB() (*sql.DB, error) {
+	this.fromDBLock.Lock()
+	defer this.fromDBLock.Unlock()
+	if this.FromDB == nil {
+		db, err := CreateMysqlCon(GetMysqlUrl(this))
+		if err != nil {
+			return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to connect to mysql %v", err)
+		}
+		this.FromDB = db
+	}
+	return this.FromDB, nil
+}
+
+// NewJobContext returns the context all threads of the job run with, it is canceled by Stop
+func (this *ConfCmd) NewJobContext(parent context.Context) context.Context {
+	ctx, cancel := context.WithCancel(parent)
+	this.cancel = cancel
+	return ctx
+}
+
+// Stop cancels the context of the job, the threads of the job quit as soon as possible
+func (this *ConfCmd) Stop() {
+	if this.cancel != nil {
+		this.cancel()
+	}
+}
+
+// SetProgress records the position up to which the binlog has been processed
+func (this *ConfCmd) SetProgress(pos mysql.Position) {
+	this.progressLock.Lock()
+	this.progress = pos
+	this.progressLock.Unlock()
+}
+
+func (this *ConfCmd) Progress() mysql.Position {
+	this.progressLock.Lock()
+	defer this.progressLock.Unlock()
+	return this.progress
 }
 
-func (this *ConfCmd) PrintUsageMsg() {
+func (this *ConfCmd) PrintUsageMsg(fs *flag.FlagSet) {
 	fmt.Printf("%s\n", C_Version)
-	flag.PrintDefaults()
+	fs.PrintDefaults()
 }
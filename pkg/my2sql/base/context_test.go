@@ -0,0 +1,97 @@
+package base
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestStopJob(t *testing.T) {
+	cfg := &ConfCmd{}
+	// stopping a job which has not started does nothing
+	cfg.Stop()
+
+	ctx := cfg.NewJobContext(context.Background())
+	if ctx.Err() != nil {
+		t.Fatalf("the context of the job is done before Stop()")
+	}
+	cfg.Stop()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("ctx.Err() = %v after Stop(), want %v", ctx.Err(), context.Canceled)
+	}
+
+	pos := mysql.Position{Name: "mysql-bin.000002", Pos: 1024}
+	cfg.SetProgress(pos)
+	if got := cfg.Progress(); got != pos {
+		t.Errorf("Progress() = %v, want %v", got, pos)
+	}
+}
+
+func TestDispatchBinEventCanceled(t *testing.T) {
+	// nobody reads the channels, the job must not hang once it is canceled
+	cfg := &ConfCmd{WorkType: "2sql", PrintDDL: true, EventChan: make(chan MyBinEvent), StatChan: make(chan BinEventStats)}
+	ctx := cfg.NewJobContext(context.Background())
+	cfg.Stop()
+	ev := &replication.BinlogEvent{Header: &replication.EventHeader{EventType: replication.QUERY_EVENT, LogPos: 800, EventSize: 100},
+		Event: &replication.QueryEvent{Schema: []byte("db"), Query: []byte("ALTER TABLE t2 ADD COLUMN c int")}}
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 800}
+	if err := cfg.DispatchBinEvent(ctx, ev, &MyBinEvent{MyPos: pos}, pos.Name, 300); err != context.Canceled {
+		t.Errorf("DispatchBinEvent() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMyParseReaderCanceled(t *testing.T) {
+	cfg := &ConfCmd{}
+	ctx := cfg.NewJobContext(context.Background())
+	cfg.Stop()
+	binlog := "mysql-bin.000001"
+	result, err := BinFileParser{Parser: replication.NewBinlogParser()}.MyParseReader(ctx, cfg, strings.NewReader(""), &binlog, false)
+	if result != C_reBreak || err != nil {
+		t.Errorf("MyParseReader() = %d, %v, want %d, nil", result, err, C_reBreak)
+	}
+}
+
+func TestReverseFileCanceled(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "db.tb.tmp")
+	dest := filepath.Join(dir, "db.tb.sql")
+	if err := os.WriteFile(src, []byte("delete 1;\ndelete 2;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(ctx, src, dest, [][]int{{10, 1}, {10, 1}}, false, "")
+	if err != context.Canceled {
+		t.Errorf("ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(src); err != nil {
+		t.Errorf("tmp file is removed: %v", err)
+	}
+}
+
+func TestCheckCmdOptionsFollow(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{mode: "repl"},
+		{mode: "file", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cfg := &ConfCmd{Mode: tt.mode, WorkType: "2sql", MysqlType: "mysql", Follow: true}
+			err := cfg.CheckCmdOptions()
+			if tt.wantErr && err == nil {
+				t.Errorf("CheckCmdOptions() accepts -follow with -mode=%s", tt.mode)
+			}
+			if !tt.wantErr && err != nil && strings.Contains(err.Error(), "follow") {
+				t.Errorf("CheckCmdOptions() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/siddontang/go-log/log"
+)
+
+// the ddls after the start position are read ahead before the job reads the binlogs. the table definitions in mysql
+// are the ones after them, they are undone to make the definitions at the positions of the events, see snapshotTable.
+// the binlogs are read to their end instead of the stop position, only the query events are kept and the rows events
+// are not decoded. reading ahead does not fail the job, the ddls not read ahead are not undone
+
+// PrepareTableDefs reads the ddls ahead by scan, then preloads the definitions of the selected databases from mysql,
+// the tables changed by the ddls read ahead are taken when they are met. nothing is done if mysql is not to be queried
+func PrepareTableDefs(ctx context.Context, cfg *ConfCmd, scan func(context.Context, *ConfCmd)) {
+	if cfg.WorkType == "stats" || cfg.OnlyColFromFile {
+		return
+	}
+	// the ddls after the start position are undone from the table definitions in mysql
+	scan(ctx, cfg)
+	if _, err := cfg.TablesColumnsInfo.PreloadTableDefs(cfg, cfg.Databases); err != nil {
+		// the definitions are fetched when the tables are met
+		log.Warnf("fail to preload table definitions: %v", err)
+	}
+}
+
+// skipRowsEventDecode leaves the rows events not decoded, only the ddls are read ahead
+func skipRowsEventDecode(*replication.RowsEvent, []byte) error {
+	return nil
+}
+
+// scanDdlEvent keeps the ddl of the event starting at pos, the ddls before the start position are not read by the job
+func scanDdlEvent(cfg *ConfCmd, ev *replication.BinlogEvent, pos mysql.Position) {
+	if ev.Header.EventType != replication.QUERY_EVENT || cfg.isBeforeStart(pos, ev.Header) {
+		return
+	}
+	cfg.TablesColumnsInfo.addPendingDdl(ev.Event.(*replication.QueryEvent), pos, pos.Pos+ev.Header.EventSize)
+}
+
+// ScanDdlsInFiles reads the ddls ahead in the binlog files, from the first one the job parses to the last one in BinlogDir
+func ScanDdlsInFiles(ctx context.Context, cfg *ConfCmd) {
+	parser := replication.NewBinlogParser()
+	parser.SetRowsEventDecodeFunc(skipRowsEventDecode)
+	binlog, _ := GetFirstBinlogPosToParse(cfg)
+	for binlog != "" {
+		if err := scanDdlsInFile(ctx, cfg, parser, binlog); err != nil {
+			if ctx.Err() == nil {
+				log.Warnf("fail to read the ddls ahead in %s, the ddls after are not undone from the table definitions in mysql: %v", binlog, err)
+			}
+			break
+		}
+		next, err := GetNextBinlogFile(cfg.BinlogDir, binlog)
+		if err != nil {
+			log.Warnf("fail to find the binlog after %s to read the ddls ahead: %v", binlog, err)
+			break
+		}
+		binlog = next
+	}
+	log.Infof("%d ddls are read ahead in the binlog files", len(cfg.TablesColumnsInfo.pendingDdls))
+}
+
+func scanDdlsInFile(ctx context.Context, cfg *ConfCmd, parser *replication.BinlogParser, name string) error {
+	f, err := OpenBinlogFile(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	b := make([]byte, len(replication.BinLogFileHeader))
+	if _, err = io.ReadFull(f, b); err != nil {
+		return err
+	} else if !bytes.Equal(b, replication.BinLogFileHeader) {
+		return fmt.Errorf("%s is not a valid binlog file", name)
+	}
+	// the events are located by their position in the file like MyParseReader, a relay log has the positions of the source
+	pos := mysql.Position{Name: TrimBinlogCompressSuffix(filepath.Base(name)), Pos: 4}
+	return parser.ParseReader(f, func(ev *replication.BinlogEvent) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		scanDdlEvent(cfg, ev, pos)
+		pos.Pos += ev.Header.EventSize
+		return nil
+	})
+}
+
+// ScanDdlsFromRepl reads the ddls ahead in the binlogs of mysql, from the start of the job to the end of the binlogs now
+func ScanDdlsFromRepl(ctx context.Context, cfg *ConfCmd) {
+	logs, err := showBinaryLogs(ctx, cfg)
+	if err != nil || len(logs) == 0 {
+		if ctx.Err() == nil {
+			log.Warnf("fail to get the binlogs to read the ddls ahead, the ddls are not undone from the table definitions in mysql: %v", err)
+		}
+		return
+	}
+	end := logs[len(logs)-1]
+
+	replCfg := newReplSyncerConfig(cfg)
+	// another slave besides the one of the job
+	replCfg.ServerID = uint32(time.Now().UnixNano()%10000) + 2000
+	replCfg.RowsEventDecodeFunc = skipRowsEventDecode
+	replSyncer := replication.NewBinlogSyncer(replCfg)
+	streamer, err := startReplSync(cfg, replSyncer)
+	if err != nil {
+		log.Warnf("fail to read the ddls ahead, the ddls are not undone from the table definitions in mysql: %v", err)
+		return
+	}
+	defer replSyncer.Close()
+
+	binlog := cfg.StartFile
+	for {
+		evCtx, cancel := context.WithTimeout(ctx, EventTimeout)
+		ev, err := streamer.GetEvent(evCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && err != context.DeadlineExceeded {
+				log.Warnf("fail to read the ddls ahead after %s, the ddls after are not undone from the table definitions in mysql: %v", binlog, err)
+			}
+			break
+		}
+		if ev.Header.EventType == replication.ROTATE_EVENT {
+			binlog = string(ev.Event.(*replication.RotateEvent).NextLogName)
+			continue
+		}
+		scanDdlEvent(cfg, ev, mysql.Position{Name: binlog, Pos: GetEventStartPos(ev.Header)})
+		if (mysql.Position{Name: binlog, Pos: ev.Header.LogPos}).Compare(end) >= 0 {
+			break
+		}
+	}
+	log.Infof("%d ddls are read ahead in the binlogs to %s", len(cfg.TablesColumnsInfo.pendingDdls), end.String())
+}
@@ -0,0 +1,78 @@
+package base
+
+import (
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// error categories of EngineError
+const (
+	ErrCategoryConfig     = "config"     // invalid options
+	ErrCategoryConnection = "connection" // fail to connect to mysql or to get binlog event from it
+	ErrCategorySchema     = "schema"     // table structure not found or not match the binlog
+	ErrCategoryDecode     = "decode"     // fail to read or parse binlog event
+	ErrCategoryOutput     = "output"     // fail to generate sql or to write result files
+)
+
+// EngineError is returned by the engine instead of exiting the process,
+// Pos is the binlog position the error occurs at, empty if it has nothing to do with binlog
+type EngineError struct {
+	Category string
+	Pos      mysql.Position
+	Err      error
+}
+
+func (this *EngineError) Error() string {
+	if this.Pos.Name == "" {
+		return fmt.Sprintf("[%s] %v", this.Category, this.Err)
+	}
+	return fmt.Sprintf("[%s] %s: %v", this.Category, this.Pos.String(), this.Err)
+}
+
+func (this *EngineError) Unwrap() error {
+	return this.Err
+}
+
+func NewEngineError(category string, pos mysql.Position, format string, args ...interface{}) *EngineError {
+	return &EngineError{Category: category, Pos: pos, Err: fmt.Errorf(format, args...)}
+}
+
+func NewConfigError(format string, args ...interface{}) *EngineError {
+	return NewEngineError(ErrCategoryConfig, mysql.Position{}, format, args...)
+}
+
+// WrapEngineError keeps the category of err if it is already an EngineError, only fills the missing position
+func WrapEngineError(category string, pos mysql.Position, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ee, ok := err.(*EngineError); ok {
+		if ee.Pos.Name != "" {
+			return ee
+		}
+		return &EngineError{Category: ee.Category, Pos: pos, Err: ee.Err}
+	}
+	return &EngineError{Category: category, Pos: pos, Err: err}
+}
+
+// SetJobError records the first error of the job and stops it,
+// the threads of the job call it instead of exiting the process
+func (this *ConfCmd) SetJobError(err error) {
+	if err == nil {
+		return
+	}
+	this.jobErrLock.Lock()
+	if this.jobErr == nil {
+		this.jobErr = err
+	}
+	this.jobErrLock.Unlock()
+	this.Stop()
+}
+
+// JobError returns the first error of the job, nil if no error occurs
+func (this *ConfCmd) JobError() error {
+	this.jobErrLock.Lock()
+	defer this.jobErrLock.Unlock()
+	return this.jobErr
+}
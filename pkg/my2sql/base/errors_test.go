@@ -0,0 +1,99 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+func TestEngineError(t *testing.T) {
+	pos := mysql.Position{Name: "mysql-bin.000001", Pos: 500}
+	tests := []struct {
+		name         string
+		err          error
+		wantCategory string
+		wantPos      mysql.Position
+		wantMsg      string
+	}{
+		{name: "config", err: NewConfigError("invalid sqltypes %s", "merge"),
+			wantCategory: ErrCategoryConfig, wantMsg: "[config] invalid sqltypes merge"},
+		{name: "with position", err: NewEngineError(ErrCategoryDecode, pos, "bad event"),
+			wantCategory: ErrCategoryDecode, wantPos: pos, wantMsg: "[decode] (mysql-bin.000001, 500): bad event"},
+		{name: "wrap plain error", err: WrapEngineError(ErrCategoryOutput, pos, fmt.Errorf("disk full")),
+			wantCategory: ErrCategoryOutput, wantPos: pos, wantMsg: "[output] (mysql-bin.000001, 500): disk full"},
+		{name: "wrap keeps category and fills position", err: WrapEngineError(ErrCategoryOutput, pos, NewConfigError("x")),
+			wantCategory: ErrCategoryConfig, wantPos: pos, wantMsg: "[config] (mysql-bin.000001, 500): x"},
+		{name: "wrap keeps position", err: WrapEngineError(ErrCategoryOutput, mysql.Position{Name: "b", Pos: 4}, NewEngineError(ErrCategorySchema, pos, "x")),
+			wantCategory: ErrCategorySchema, wantPos: pos, wantMsg: "[schema] (mysql-bin.000001, 500): x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ee *EngineError
+			if !errors.As(tt.err, &ee) {
+				t.Fatalf("%v is not an EngineError", tt.err)
+			}
+			if ee.Category != tt.wantCategory || ee.Pos != tt.wantPos {
+				t.Errorf("category, pos = %s, %v, want %s, %v", ee.Category, ee.Pos, tt.wantCategory, tt.wantPos)
+			}
+			if tt.err.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", tt.err.Error(), tt.wantMsg)
+			}
+		})
+	}
+	if WrapEngineError(ErrCategoryOutput, pos, nil) != nil {
+		t.Errorf("WrapEngineError(nil) is not nil")
+	}
+	inner := fmt.Errorf("inner")
+	if !errors.Is(WrapEngineError(ErrCategoryOutput, pos, inner), inner) {
+		t.Errorf("WrapEngineError() does not unwrap to the wrapped error")
+	}
+}
+
+func TestSetJobError(t *testing.T) {
+	cfg := &ConfCmd{}
+	ctx := cfg.NewJobContext(context.Background())
+	cfg.SetJobError(nil)
+	if cfg.JobError() != nil || ctx.Err() != nil {
+		t.Fatalf("SetJobError(nil) changes the job")
+	}
+	first := NewConfigError("first")
+	cfg.SetJobError(first)
+	cfg.SetJobError(NewConfigError("second"))
+	if cfg.JobError() != first {
+		t.Errorf("JobError() = %v, want the first error", cfg.JobError())
+	}
+	if ctx.Err() == nil {
+		t.Errorf("the job is not stopped")
+	}
+}
+
+func TestParseCmdOptionsError(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "unknown option", args: []string{"-no-such-option"}},
+		{name: "invalid mode", args: []string{"-mode", "stream"}},
+		{name: "invalid time location", args: []string{"-mode", "file", "-tl", "Nowhere/Nowhere"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// called twice, the flag set of the first call must not be reused
+			for i := 0; i < 2; i++ {
+				cfg := &ConfCmd{}
+				done, err := cfg.ParseCmdOptions(tt.args)
+				var ee *EngineError
+				if done || !errors.As(err, &ee) || ee.Category != ErrCategoryConfig {
+					t.Fatalf("ParseCmdOptions(%v) = %v, %v, want a config error", tt.args, done, err)
+				}
+			}
+		})
+	}
+	done, err := (&ConfCmd{}).ParseCmdOptions([]string{"-v"})
+	if !done || err != nil {
+		t.Errorf("ParseCmdOptions(-v) = %v, %v, want true, nil", done, err)
+	}
+}
@@ -2,10 +2,12 @@ package base
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"my-wails-app/pkg/my2sql/sqltypes"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -14,6 +16,8 @@ import (
 	SQL "my-wails-app/pkg/my2sql/sqlbuilder"
 
 	"log"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 type ExtraSqlInfoOfPrint struct {
@@ -25,6 +29,8 @@ type ExtraSqlInfoOfPrint struct {
 	datetime  string
 	trxIndex  uint64
 	trxStatus int
+	gtid      string
+	eventIdx  uint64
 }
 
 type ForwardRollbackSqlOfPrint struct {
@@ -37,167 +43,255 @@ var (
 	RollbackSqlFileNamePrefix string = "rollback"
 )
 
-func GenForwardRollbackSqlFromBinEvent(i uint, cfg *ConfCmd, wg *sync.WaitGroup) {
+func GenForwardRollbackSqlFromBinEvent(ctx context.Context, i uint, cfg *ConfCmd, wg *sync.WaitGroup) {
 	defer wg.Done()
+	defer log.Println(fmt.Sprintf("exit thread %d to generate redo/rollback sql", i))
 	var (
-		err error
-		//var currentIdx uint64
-		tbInfo             *TblInfoJson
-		db, tb, fulltb     string
-		allColNames        []FieldInfo
-		colsDef            []SQL.NonAliasColumn
-		colsTypeName       []string
-		colCnt             int
+		err                error
 		sqlArr             []string
-		uniqueKeyIdx       []int
-		uniqueKey          KeyInfo
-		primaryKeyIdx      []int
-		ifRollback         bool = false
-		ifIgnorePrimary    bool = cfg.IgnorePrimaryKeyForInsert
+		db, tb             string
 		currentSqlForPrint ForwardRollbackSqlOfPrint
-		posStr             string
-		//printStatementSql  bool = false
+		ev                 MyBinEvent
+		ok                 bool
 	)
 	log.Println(fmt.Sprintf("start thread %d to generate redo/rollback sql", i))
-	if cfg.WorkType == "rollback" {
-		ifRollback = true
-	}
 
-	for ev := range cfg.EventChan {
-		if ev.IfRowsEvent {
-			posStr = GetPosStr(ev.MyPos.Name, ev.StartPos, ev.MyPos.Pos)
-			db = string(ev.BinEvent.Table.Schema)
-			tb = string(ev.BinEvent.Table.Table)
-			fulltb = GetAbsTableName(db, tb)
-			tbInfo, err = G_TablesColumnsInfo.GetTableInfoJson(db, tb)
-			if err != nil {
-				log.Println(fmt.Sprintf("error to found %s table structure for event", fulltb))
-				continue
+	for {
+		select {
+		case ev, ok = <-cfg.EventChan:
+			if !ok {
+				return
 			}
-			if tbInfo == nil {
-				log.Println("no suitable table struct found for %s for event %s", fulltb, posStr)
+		case <-ctx.Done():
+			return
+		}
+		db, tb, sqlArr, err = GenSqlsForOneBinEvent(cfg, &ev)
+		if err != nil {
+			log.Println(err.Error())
+			// SetJobError cancels ctx, all threads of the job quit
+			cfg.SetJobError(err)
+			return
+		}
+		currentSqlForPrint = ForwardRollbackSqlOfPrint{sqls: sqlArr,
+			sqlInfo: ExtraSqlInfoOfPrint{schema: db, table: tb, binlog: ev.MyPos.Name, startpos: ev.StartPos, endpos: ev.MyPos.Pos,
+				datetime: time.Unix(int64(ev.Timestamp), 0).In(cfg.BinlogTimeLoc).Format(constvar.DATETIME_FORMAT_NOSPACE),
+				trxIndex: ev.TrxIndex, trxStatus: ev.TrxStatus, gtid: ev.Gtid, eventIdx: ev.EventIdx}}
+
+		// every event must pass here in order even if no sql is generated, or the other threads wait for it forever
+		for {
+			if ctx.Err() != nil {
+				return
 			}
-			colCnt = len(ev.BinEvent.Rows[0])
-			allColNames = GetAllFieldNamesWithDroppedFields(colCnt, tbInfo.Columns)
-			colsDef, colsTypeName = GetSqlFieldsEXpressions(colCnt, allColNames, ev.BinEvent.Table)
-			colsTypeNameFromMysql := make([]string, len(colsTypeName))
+			//fmt.Println("in thread", i)
+			cfg.HandlingBinEventIndex.lock.Lock()
+			//fmt.Println("handing index:", cfg.HandlingBinEventIndex.EventIdx, "binevent index:", ev.EventIdx)
+			if cfg.HandlingBinEventIndex.EventIdx == ev.EventIdx {
+				if len(currentSqlForPrint.sqls) > 0 {
+					if cfg.OutputToScreen {
+						for _, sql := range currentSqlForPrint.sqls {
+							fmt.Println(sql)
+						}
+					} else {
+						select {
+						case cfg.SqlChan <- currentSqlForPrint:
+						case <-ctx.Done():
+							cfg.HandlingBinEventIndex.lock.Unlock()
+							return
+						}
+					}
+				}
+				cfg.HandlingBinEventIndex.EventIdx++
+				cfg.HandlingBinEventIndex.lock.Unlock()
+				//fmt.Println("handing index == binevent index, break")
+				break
+			}
+
+			cfg.HandlingBinEventIndex.lock.Unlock()
+			time.Sleep(1 * time.Microsecond)
+
+		}
+	}
+}
+
+// GenSqlsForOneBinEvent generates redo or rollback sqls of one event,
+// sqls is nil if the event should be skipped
+func GenSqlsForOneBinEvent(cfg *ConfCmd, ev *MyBinEvent) (db string, tb string, sqls []string, err error) {
+	var (
+		tbInfo          *TblInfoJson
+		fulltb          string
+		allColNames     []FieldInfo
+		colsDef         []SQL.NonAliasColumn
+		colsTypeName    []string
+		colCnt          int
+		sqlArr          []string
+		uniqueKeyIdx    []int
+		uniqueKey       KeyInfo
+		primaryKeyIdx   []int
+		generatedIdx    []int
+		ifRollback      bool = cfg.WorkType == "rollback"
+		ifIgnorePrimary bool = cfg.IgnorePrimaryKeyForInsert
+		posStr          string
+	)
 
-			if len(colsTypeName) > len(tbInfo.Columns) {
-				log.Fatalf("%s column count %d in binlog > in table structure %d, usually means DDL in the middle", fulltb, len(colsTypeName), len(tbInfo.Columns))
+	// sqlbuilder panics on values it can not handle, report it as an error of the event instead of crashing
+	defer func() {
+		if r := recover(); r != nil {
+			err = NewEngineError(ErrCategoryOutput, ev.MyPos, "fail to generate sql for %s: %v", GetAbsTableName(db, tb), r)
+		}
+	}()
+
+	if ev.IfRowsEvent {
+		posStr = GetPosStr(ev.MyPos.Name, ev.StartPos, ev.MyPos.Pos)
+		db = string(ev.BinEvent.Table.Schema)
+		tb = string(ev.BinEvent.Table.Table)
+		fulltb = GetAbsTableName(db, tb)
+		tbInfo = ev.TbInfo
+		if tbInfo == nil {
+			tbInfo, err = cfg.TablesColumnsInfo.GetTableInfoForRowsEvent(cfg, ev.BinEvent)
+			if err != nil {
+				return db, tb, nil, WrapEngineError(ErrCategorySchema, ev.MyPos, err)
 			}
-			for ci, colType := range colsTypeName {
-				colsTypeNameFromMysql[ci] = tbInfo.Columns[ci].FieldType
+		}
+		if err = CheckTableMapWithDefinition(ev.BinEvent.Table, tbInfo); err != nil {
+			// no sql is generated by a definition which is not the one of the event
+			return db, tb, nil, NewEngineError(ErrCategorySchema, ev.MyPos, "%s %v, %s", fulltb, err, tbInfo.VersionString())
+		}
+		colCnt = len(ev.BinEvent.Rows[0])
+		allColNames = GetAllFieldNamesWithDroppedFields(colCnt, tbInfo.Columns)
+		colsDef, colsTypeName = GetSqlFieldsEXpressions(colCnt, allColNames, ev.BinEvent.Table, cfg.GeographicSrids)
+		colsTypeNameFromMysql := make([]string, len(colsTypeName))
 
-				if strings.Contains(strings.ToLower(colType), "int") {
-					if tbInfo.Columns[ci].IsUnsigned {
-						for ri, _ := range ev.BinEvent.Rows {
-							ev.BinEvent.Rows[ri][ci] = sqltypes.ConvertIntUnsigned(ev.BinEvent.Rows[ri][ci], colType)
-						}
+		for ci, colType := range colsTypeName {
+			colsTypeNameFromMysql[ci] = tbInfo.Columns[ci].FieldType
 
+			if strings.Contains(strings.ToLower(colType), "int") {
+				if tbInfo.Columns[ci].IsUnsigned {
+					for ri, _ := range ev.BinEvent.Rows {
+						ev.BinEvent.Rows[ri][ci] = sqltypes.ConvertIntUnsigned(ev.BinEvent.Rows[ri][ci], colType)
 					}
+
 				}
+			}
 
-				if colType == "blob" {
-					// text is stored as blob
-					if strings.Contains(strings.ToLower(tbInfo.Columns[ci].FieldType), "text") {
-						for ri, _ := range ev.BinEvent.Rows {
-							if ev.BinEvent.Rows[ri][ci] == nil {
-								continue
-							}
-							txtStr, coOk := ev.BinEvent.Rows[ri][ci].([]byte)
-							if !coOk {
-								log.Fatalf("%s.%s %v []byte  empty %s", fulltb, allColNames[ci].FieldName, ev.BinEvent.Rows[ri][ci], posStr)
-							} else {
-								ev.BinEvent.Rows[ri][ci] = string(txtStr)
-							}
-						}
-					}
+			if (colType == "enum" || colType == "set") && !cfg.EnumSetRawIndex {
+				for ri, _ := range ev.BinEvent.Rows {
+					ev.BinEvent.Rows[ri][ci] = ConvertEnumSetValue(ev.BinEvent.Rows[ri][ci], colType, tbInfo.Columns[ci].EnumSetValues)
 				}
-				/*if colType == "json" {
+			}
+
+			if colType == "decimal" {
+				// decoded as string in the compressed transactions(binlog_transaction_compression=ON)
+				for ri, _ := range ev.BinEvent.Rows {
+					ev.BinEvent.Rows[ri][ci] = sqltypes.ConvertDecimal(ev.BinEvent.Rows[ri][ci])
+				}
+			}
+
+			if colType == "blob" {
+				// text is stored as blob
+				if strings.Contains(strings.ToLower(tbInfo.Columns[ci].FieldType), "text") {
 					for ri, _ := range ev.BinEvent.Rows {
 						if ev.BinEvent.Rows[ri][ci] == nil {
 							continue
 						}
 						txtStr, coOk := ev.BinEvent.Rows[ri][ci].([]byte)
 						if !coOk {
-							log.Fatalf("%s.%s %v []byte  empty %s", fulltb, allColNames[ci].FieldName, ev.BinEvent.Rows[ri][ci], posStr)
+							return db, tb, nil, NewEngineError(ErrCategoryDecode, ev.MyPos,
+								"%s.%s %v []byte  empty %s", fulltb, allColNames[ci].FieldName, ev.BinEvent.Rows[ri][ci], posStr)
 						} else {
-							ev.BinEvent.Rows[ri][ci] = string(txtStr)
+							ev.BinEvent.Rows[ri][ci] = ConvertCharsetValue(txtStr, tbInfo.Columns[ci].Charset)
 						}
 					}
-
-				}*/
-			}
-			uniqueKey = tbInfo.GetOneUniqueKey(cfg.UseUniqueKeyFirst)
-			if len(uniqueKey) > 0 {
-				uniqueKeyIdx = GetColIndexFromKey(uniqueKey, allColNames)
-			} else {
-				uniqueKeyIdx = []int{}
-			}
-
-			if len(tbInfo.PrimaryKey) > 0 {
-				primaryKeyIdx = GetColIndexFromKey(tbInfo.PrimaryKey, allColNames)
-			} else {
-				primaryKeyIdx = []int{}
-				ifIgnorePrimary = false
+				}
 			}
 
-			if ev.SqlType == "insert" {
-				if ifRollback {
-					sqlArr = GenDeleteSqlsForOneRowsEventRollbackInsert(posStr, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, cfg.SqlTblPrefixDb)
-				} else {
-					sqlArr = GenInsertSqlsForOneRowsEvent(posStr, ev.BinEvent, colsDef, 1, false, cfg.SqlTblPrefixDb, ifIgnorePrimary, primaryKeyIdx)
+			if (colType == "varchar" || colType == "char") && IsCharacterType(tbInfo.Columns[ci].FieldType) {
+				// the bytes in the charset of the column
+				for ri, _ := range ev.BinEvent.Rows {
+					ev.BinEvent.Rows[ri][ci] = ConvertCharsetValue(ev.BinEvent.Rows[ri][ci], tbInfo.Columns[ci].Charset)
 				}
-			} else if ev.SqlType == "delete" {
-				if ifRollback {
-					sqlArr = GenInsertSqlsForOneRowsEventRollbackDelete(posStr, ev.BinEvent, colsDef, 1, cfg.SqlTblPrefixDb)
-				} else {
-					sqlArr = GenDeleteSqlsForOneRowsEvent(posStr, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, false, cfg.SqlTblPrefixDb)
+			}
+			/*if colType == "json" {
+				for ri, _ := range ev.BinEvent.Rows {
+					if ev.BinEvent.Rows[ri][ci] == nil {
+						continue
+					}
+					txtStr, coOk := ev.BinEvent.Rows[ri][ci].([]byte)
+					if !coOk {
+						log.Fatalf("%s.%s %v []byte  empty %s", fulltb, allColNames[ci].FieldName, ev.BinEvent.Rows[ri][ci], posStr)
+					} else {
+						ev.BinEvent.Rows[ri][ci] = string(txtStr)
+					}
 				}
-			} else if ev.SqlType == "update" {
-				if ifRollback {
-					sqlArr = GenUpdateSqlsForOneRowsEvent(posStr, colsTypeNameFromMysql, colsTypeName, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, true, cfg.SqlTblPrefixDb)
-				} else {
-					sqlArr = GenUpdateSqlsForOneRowsEvent(posStr, colsTypeNameFromMysql, colsTypeName, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, false, cfg.SqlTblPrefixDb)
+
+			}*/
+		}
+		if ev.SqlType == "update" {
+			// binlog_row_value_options=PARTIAL_JSON
+			ResolvePartialJsonRows(ev.BinEvent)
+			if reason, dropped := DropPartialJsonRows(ev.BinEvent, ifRollback, colsDef); dropped > 0 {
+				cfg.AddRowImageWarning(fulltb, reason, ev.MyPos, dropped)
+				if len(ev.BinEvent.Rows) == 0 {
+					return db, tb, nil, nil
 				}
-			} else {
-				fmt.Println("unsupported query type %s to generate 2sql|rollback sql, it should one of insert|update|delete. %s", ev.SqlType, ev.MyPos.String())
-				continue
 			}
 		}
-		sqlArr = append(sqlArr, ev.OrgSql)
-		currentSqlForPrint = ForwardRollbackSqlOfPrint{sqls: sqlArr,
-			sqlInfo: ExtraSqlInfoOfPrint{schema: db, table: tb, binlog: ev.MyPos.Name, startpos: ev.StartPos, endpos: ev.MyPos.Pos,
-				datetime: GetDatetimeStr(int64(ev.Timestamp), int64(0), constvar.DATETIME_FORMAT_NOSPACE),
-				trxIndex: ev.TrxIndex, trxStatus: ev.TrxStatus}}
+		uniqueKey = tbInfo.GetOneUniqueKey(cfg.UseUniqueKeyFirst)
+		if len(uniqueKey) > 0 {
+			uniqueKeyIdx = GetColIndexFromKey(uniqueKey, allColNames)
+		} else {
+			uniqueKeyIdx = []int{}
+		}
 
-		for {
-			//fmt.Println("in thread", i)
-			G_HandlingBinEventIndex.lock.Lock()
-			//fmt.Println("handing index:", G_HandlingBinEventIndex.EventIdx, "binevent index:", ev.EventIdx)
-			if G_HandlingBinEventIndex.EventIdx == ev.EventIdx {
-				if cfg.OutputToScreen {
-					for _, sql := range currentSqlForPrint.sqls {
-						fmt.Println(sql)
-					}
-				} else {
-					cfg.SqlChan <- currentSqlForPrint
-				}
-				G_HandlingBinEventIndex.EventIdx++
-				G_HandlingBinEventIndex.lock.Unlock()
-				//fmt.Println("handing index == binevent index, break")
-				break
+		if len(tbInfo.PrimaryKey) > 0 {
+			primaryKeyIdx = GetColIndexFromKey(tbInfo.PrimaryKey, allColNames)
+		} else {
+			primaryKeyIdx = []int{}
+			ifIgnorePrimary = false
+		}
+		// generated columns can not be inserted or updated
+		generatedIdx = GetGeneratedColIndex(allColNames)
+
+		// binlog_row_image=MINIMAL or NOBLOB
+		if reason := CheckRowImageForSql(ev.BinEvent, ev.SqlType, ifRollback, colsDef, uniqueKeyIdx); reason != "" {
+			rowCnt := len(ev.BinEvent.Rows)
+			if ev.SqlType == "update" {
+				rowCnt /= 2
 			}
+			cfg.AddRowImageWarning(fulltb, reason, ev.MyPos, rowCnt)
+			return db, tb, nil, nil
+		}
 
-			G_HandlingBinEventIndex.lock.Unlock()
-			time.Sleep(1 * time.Microsecond)
-
+		if ev.SqlType == "insert" {
+			if ifRollback {
+				sqlArr, err = GenDeleteSqlsForOneRowsEventRollbackInsert(posStr, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, cfg.SqlTblPrefixDb, generatedIdx)
+			} else {
+				sqlArr, err = GenInsertSqlsForOneRowsEvent(posStr, ev.BinEvent, colsDef, 1, false, cfg.SqlTblPrefixDb, ifIgnorePrimary, primaryKeyIdx, generatedIdx)
+			}
+		} else if ev.SqlType == "delete" {
+			if ifRollback {
+				sqlArr, err = GenInsertSqlsForOneRowsEventRollbackDelete(posStr, ev.BinEvent, colsDef, 1, cfg.SqlTblPrefixDb, generatedIdx)
+			} else {
+				sqlArr, err = GenDeleteSqlsForOneRowsEvent(posStr, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, false, cfg.SqlTblPrefixDb, generatedIdx)
+			}
+		} else if ev.SqlType == "update" {
+			if ifRollback {
+				sqlArr, err = GenUpdateSqlsForOneRowsEvent(posStr, colsTypeNameFromMysql, colsTypeName, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, true, cfg.SqlTblPrefixDb, generatedIdx)
+			} else {
+				sqlArr, err = GenUpdateSqlsForOneRowsEvent(posStr, colsTypeNameFromMysql, colsTypeName, ev.BinEvent, colsDef, uniqueKeyIdx, cfg.FullColumns, false, cfg.SqlTblPrefixDb, generatedIdx)
+			}
+		} else {
+			log.Printf("unsupported query type %s to generate 2sql|rollback sql, it should one of insert|update|delete. %s\n", ev.SqlType, ev.MyPos.String())
+			return db, tb, nil, nil
+		}
+		if err != nil {
+			return db, tb, nil, NewEngineError(ErrCategoryOutput, ev.MyPos, "%v", err)
 		}
 	}
-	log.Println(fmt.Sprintf("exit thread %d to generate redo/rollback sql", i))
+	sqlArr = append(sqlArr, ev.OrgSql)
+	return db, tb, sqlArr, nil
 }
 
-func PrintExtraInfoForForwardRollbackupSql(cfg *ConfCmd, wg *sync.WaitGroup) {
+func PrintExtraInfoForForwardRollbackupSql(ctx context.Context, cfg *ConfCmd, wg *sync.WaitGroup) {
 	defer wg.Done()
 	var (
 		rollbackFileName string                   = ""
@@ -217,33 +311,156 @@ func PrintExtraInfoForForwardRollbackupSql(cfg *ConfCmd, wg *sync.WaitGroup) {
 		bytesCntFiles      map[string][][]int = map[string][][]int{} //{"file1":{{8, 0}, {8 , 0}}} {length of bytes, trxIndex}
 		lastPrintPos       uint32             = 0
 		lastPrintFile      string             = ""
-		printBytesInterval uint32             = 1024 * 1024 * 10 //every 10MB print process info
+		printBytesInterval uint32             = 1024 * 1024 * 10    //every 10MB print process info
+		fileBinlogs        map[string]string  = map[string]string{} // {file: binlog}, for follow mode to find the files of rotated binlogs
+		lastBinlog         string             = ""
+		fileSizes          map[string]int64   = map[string]int64{}  // bytes written into each file
+		rollbackNames      map[string]string  = map[string]string{} // {tmp file: rollback file}
+		lastSqlInfo        *ExtraSqlInfoOfPrint
+		boundary           *sqlFilesBoundary
+		lastCheckpoint     time.Time       = time.Now()
+		resumed            *CheckpointPart = cfg.ResumedPart(true)
 	)
 	log.Println(fmt.Sprintf("start thread to write redo/rollback sql into file"))
+	if resumed != nil {
+		// append to the files of the checkpoint, what is written after the checkpoint is truncated
+		for _, f := range resumed.Files {
+			FH, err = OpenResumedFile(f)
+			if err != nil {
+				cfg.SetJobError(err)
+				break
+			}
+			fhArr[f.Name] = FH
+			fhArrBuf[f.Name] = bufio.NewWriter(FH)
+			fileBinlogs[f.Name] = f.Binlog
+			fileSizes[f.Name] = f.Size
+			if f.Rollback != "" {
+				rollbackFiles = append(rollbackFiles, map[string]string{"tmp": f.Name, "rollback": f.Rollback})
+				rollbackNames[f.Name] = f.Rollback
+				bytesCntFiles[f.Name] = f.TrxPoses
+			}
+		}
+		lastBinlog = resumed.Binlog
+	}
 	for sc := range cfg.SqlChan {
+		// the sql generating threads quit once the job is canceled, drop what is left in SqlChan
+		if ctx.Err() != nil {
+			continue
+		}
+		if resumed != nil {
+			// it has been written before the checkpoint
+			if (mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos}).Compare(resumed.Position()) <= 0 {
+				continue
+			}
+			resumed = nil
+		}
 		if cfg.WorkType == "rollback" {
-			tmpFileName = GetForwardRollbackSqlFileName(sc.sqlInfo.schema, sc.sqlInfo.table, cfg.FilePerTable, cfg.OutputDir, true, sc.sqlInfo.binlog, true)
-			rollbackFileName = GetForwardRollbackSqlFileName(sc.sqlInfo.schema, sc.sqlInfo.table, cfg.FilePerTable, cfg.OutputDir, true, sc.sqlInfo.binlog, false)
+			tmpFileName, err = GetForwardRollbackSqlFileName(sc.sqlInfo.schema, sc.sqlInfo.table, cfg.FilePerTable, cfg.OutputDir, true, sc.sqlInfo.binlog, true)
+			if err == nil {
+				rollbackFileName, err = GetForwardRollbackSqlFileName(sc.sqlInfo.schema, sc.sqlInfo.table, cfg.FilePerTable, cfg.OutputDir, true, sc.sqlInfo.binlog, false)
+			}
 		} else {
-			tmpFileName = GetForwardRollbackSqlFileName(sc.sqlInfo.schema, sc.sqlInfo.table, cfg.FilePerTable, cfg.OutputDir, false, sc.sqlInfo.binlog, false)
+			tmpFileName, err = GetForwardRollbackSqlFileName(sc.sqlInfo.schema, sc.sqlInfo.table, cfg.FilePerTable, cfg.OutputDir, false, sc.sqlInfo.binlog, false)
+		}
+		if err != nil {
+			cfg.SetJobError(WrapEngineError(ErrCategoryOutput, mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos}, err))
+			continue
+		}
+		if cfg.Follow && lastBinlog != "" && sc.sqlInfo.binlog != lastBinlog {
+			// follow mode does not end until it is stopped, finish the files of the binlogs rotated away
+			for fn, fBinlog := range fileBinlogs {
+				if fBinlog == sc.sqlInfo.binlog {
+					continue
+				}
+				if err = fhArrBuf[fn].Flush(); err != nil {
+					cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to write file %s %v", fn, err))
+				}
+				fhArr[fn].Close()
+				delete(fhArr, fn)
+				delete(fhArrBuf, fn)
+				delete(fileBinlogs, fn)
+				delete(fileSizes, fn)
+			}
+			if cfg.WorkType == "rollback" {
+				var rotatedFiles, leftFiles []map[string]string
+				for _, arr := range rollbackFiles {
+					if _, ok := fhArr[arr["tmp"]]; ok {
+						leftFiles = append(leftFiles, arr)
+					} else {
+						rotatedFiles = append(rotatedFiles, arr)
+					}
+				}
+				rollbackFiles = leftFiles
+				ReverseRollbackFiles(ctx, cfg, rotatedFiles, bytesCntFiles)
+				for _, arr := range rotatedFiles {
+					delete(bytesCntFiles, arr["tmp"])
+					delete(rollbackNames, arr["tmp"])
+				}
+			}
+			// the files in the saved checkpoint are closed, save it again right now
+			lastCheckpoint = time.Time{}
+		}
+		lastBinlog = sc.sqlInfo.binlog
+
+		if lastSqlInfo != nil && sc.sqlInfo.trxIndex != lastSqlInfo.trxIndex {
+			// every sql of the last transaction has been written
+			boundary = newSqlFilesBoundary(lastSqlInfo, fileSizes, bytesCntFiles)
+			if time.Since(lastCheckpoint) >= CheckpointInterval {
+				for fn, bufFH := range fhArrBuf {
+					if err = bufFH.Flush(); err != nil {
+						cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to write file %s %v", fn, err))
+					}
+				}
+				if err = cfg.SaveCheckpoint(true, boundary.checkpointPart(fileBinlogs, rollbackNames, bytesCntFiles)); err != nil {
+					cfg.SetJobError(err)
+				}
+				lastCheckpoint = time.Now()
+			}
 		}
 		if _, ok := fhArr[tmpFileName]; !ok {
 			FH, err = os.OpenFile(tmpFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 			if err != nil {
-
+				cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos},
+					"fail to open file %s %v", tmpFileName, err))
+				continue
 			}
 			bufFH = bufio.NewWriter(FH)
 			fhArrBuf[tmpFileName] = bufFH
 			fhArr[tmpFileName] = FH
+			fileBinlogs[tmpFileName] = sc.sqlInfo.binlog
+			fileSizes[tmpFileName] = 0
+			if cfg.WorkType != "rollback" {
+				// the rollback sql file gets it when it is reversed from the tmp file
+				if _, err = bufFH.WriteString(cfg.SqlFilePreamble()); err != nil {
+					cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos},
+						"fail to write file %s %v", tmpFileName, err))
+					continue
+				}
+				fileSizes[tmpFileName] = int64(len(cfg.SqlFilePreamble()))
+			}
 			if cfg.WorkType == "rollback" {
 				rollbackFiles = append(rollbackFiles, map[string]string{"tmp": tmpFileName, "rollback": rollbackFileName})
+				rollbackNames[tmpFileName] = rollbackFileName
 				bytesCntFiles[tmpFileName] = [][]int{}
 			}
 		}
 
 		//lastTrxIndex = sc.sqlInfo.trxIndex
 		oneSqls = GetForwardRollbackContentLineWithExtra(sc, cfg.PrintExtraInfo)
-		fhArrBuf[tmpFileName].WriteString(oneSqls)
+		if _, err = fhArrBuf[tmpFileName].WriteString(oneSqls); err != nil {
+			cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos},
+				"fail to write file %s %v", tmpFileName, err))
+			continue
+		}
+		fileSizes[tmpFileName] += int64(len(oneSqls))
+		if cfg.Follow && len(cfg.SqlChan) == 0 {
+			// no more sql for now, make it visible in the file while following
+			if err = fhArrBuf[tmpFileName].Flush(); err != nil {
+				cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos},
+					"fail to write file %s %v", tmpFileName, err))
+				continue
+			}
+		}
 		if lastPrintFile == "" {
 			lastPrintFile = sc.sqlInfo.binlog
 		}
@@ -259,28 +476,36 @@ func PrintExtraInfoForForwardRollbackupSql(cfg *ConfCmd, wg *sync.WaitGroup) {
 		if cfg.WorkType == "rollback" {
 			bytesCntFiles[tmpFileName] = append(bytesCntFiles[tmpFileName], []int{len(oneSqls), int(sc.sqlInfo.trxIndex)})
 		}
+		cfg.SetProgress(mysql.Position{Name: sc.sqlInfo.binlog, Pos: sc.sqlInfo.endpos})
+		sqlInfo := sc.sqlInfo
+		lastSqlInfo = &sqlInfo
 	}
 
 	for fn, bufFH := range fhArrBuf {
-		bufFH.Flush()
+		if err = bufFH.Flush(); err != nil {
+			cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to write file %s %v", fn, err))
+		}
 		fhArr[fn].Close()
 	}
 
+	if boundary != nil && (ctx.Err() != nil || cfg.JobError() != nil) {
+		// the job is not finished, save where the last complete transaction ends for -resume
+		if err = cfg.SaveCheckpoint(true, boundary.checkpointPart(fileBinlogs, rollbackNames, bytesCntFiles)); err != nil {
+			log.Println(err.Error())
+		}
+	}
+
 	// reverse rollback sql file
-	if cfg.WorkType == "rollback" {
+	revCtx := ctx
+	if cfg.Follow && cfg.JobError() == nil {
+		// stopping is how follow mode ends, the rollback sql of the last binlog is still reverted
+		revCtx = context.Background()
+	}
+	if cfg.WorkType == "rollback" && revCtx.Err() != nil {
+		log.Println("job is stopped, rollback sql is left in tmp files and not reverted")
+	} else if cfg.WorkType == "rollback" {
 		log.Println("finish writing rollback sql into tmp files, start to revert content order of tmp files")
-		var reWg sync.WaitGroup
-		filesChan := make(chan map[string]string, cfg.Threads)
-		threadNum := GetMinValue(int(cfg.Threads), len(rollbackFiles))
-		for i := 1; i <= threadNum; i++ {
-			reWg.Add(1)
-			go ReverseFileGo(i, filesChan, bytesCntFiles, cfg.KeepTrx, &reWg)
-		}
-		for _, tmpArr := range rollbackFiles {
-			filesChan <- tmpArr
-		}
-		close(filesChan)
-		reWg.Wait()
+		ReverseRollbackFiles(revCtx, cfg, rollbackFiles, bytesCntFiles)
 		log.Println("finish reverting content order of tmp files")
 	} else {
 		log.Println("finish writing redo/forward sql into file")
@@ -289,30 +514,76 @@ func PrintExtraInfoForForwardRollbackupSql(cfg *ConfCmd, wg *sync.WaitGroup) {
 	log.Println("exit thread to write redo/rollback sql into file")
 }
 
-func GetForwardRollbackSqlFileName(schema string, table string, filePerTable bool, outDir string, ifRollback bool, binlog string, ifTmp bool) string {
+// sqlFilesBoundary is where the last transaction written into the sql files ends
+type sqlFilesBoundary struct {
+	part      CheckpointPart
+	sizes     map[string]int64 // {file: size}
+	trxPosCnt map[string]int   // {rollback tmp file: count of its bytesCntFiles}
+}
+
+func newSqlFilesBoundary(lastSqlInfo *ExtraSqlInfoOfPrint, fileSizes map[string]int64, bytesCntFiles map[string][][]int) *sqlFilesBoundary {
+	b := &sqlFilesBoundary{
+		part: CheckpointPart{Binlog: lastSqlInfo.binlog, Pos: lastSqlInfo.endpos,
+			TrxIndex: lastSqlInfo.trxIndex, EventIdx: lastSqlInfo.eventIdx},
+		sizes:     make(map[string]int64, len(fileSizes)),
+		trxPosCnt: make(map[string]int, len(bytesCntFiles)),
+	}
+	for fn, size := range fileSizes {
+		b.sizes[fn] = size
+	}
+	for fn, poses := range bytesCntFiles {
+		b.trxPosCnt[fn] = len(poses)
+	}
+	return b
+}
+
+// checkpointPart only takes the files still open, the files of rotated binlogs in follow mode are finished
+func (this *sqlFilesBoundary) checkpointPart(fileBinlogs map[string]string, rollbackNames map[string]string, bytesCntFiles map[string][][]int) *CheckpointPart {
+	part := this.part
+	part.Files = []CheckpointFile{}
+	for fn, size := range this.sizes {
+		binlog, ok := fileBinlogs[fn]
+		if !ok {
+			continue
+		}
+		cf := CheckpointFile{Name: fn, Binlog: binlog, Size: size}
+		if rollbackName, ok := rollbackNames[fn]; ok {
+			cf.Rollback = rollbackName
+			cf.TrxPoses = bytesCntFiles[fn][:this.trxPosCnt[fn]]
+		}
+		part.Files = append(part.Files, cf)
+	}
+	sort.Slice(part.Files, func(i, j int) bool { return part.Files[i].Name < part.Files[j].Name })
+	return &part
+}
+
+func GetForwardRollbackSqlFileName(schema string, table string, filePerTable bool, outDir string, ifRollback bool, binlog string, ifTmp bool) (string, error) {
 
-	_, idx := GetBinlogBasenameAndIndex(binlog)
+	_, idx, err := GetBinlogBasenameAndIndex(binlog)
+	if err != nil {
+		return "", err
+	}
 
 	if ifRollback {
 		if ifTmp {
 			if filePerTable {
-				return filepath.Join(outDir, fmt.Sprintf(".%s.%s.%s.%d.sql", schema, table, RollbackSqlFileNamePrefix, idx))
+				return filepath.Join(outDir, fmt.Sprintf(".%s.%s.%s.%d.sql", schema, table, RollbackSqlFileNamePrefix, idx)), nil
 			} else {
-				return filepath.Join(outDir, fmt.Sprintf(".%s.%d.sql", RollbackSqlFileNamePrefix, idx))
+				return filepath.Join(outDir, fmt.Sprintf(".%s.%d.sql", RollbackSqlFileNamePrefix, idx)), nil
 			}
 
 		} else {
 			if filePerTable {
-				return filepath.Join(outDir, fmt.Sprintf("%s.%s.%s.%d.sql", schema, table, RollbackSqlFileNamePrefix, idx))
+				return filepath.Join(outDir, fmt.Sprintf("%s.%s.%s.%d.sql", schema, table, RollbackSqlFileNamePrefix, idx)), nil
 			} else {
-				return filepath.Join(outDir, fmt.Sprintf("%s.%d.sql", RollbackSqlFileNamePrefix, idx))
+				return filepath.Join(outDir, fmt.Sprintf("%s.%d.sql", RollbackSqlFileNamePrefix, idx)), nil
 			}
 		}
 	} else {
 		if filePerTable {
-			return filepath.Join(outDir, fmt.Sprintf("%s.%s.%s.%d.sql", schema, table, ForwardSqlFileNamePrefix, idx))
+			return filepath.Join(outDir, fmt.Sprintf("%s.%s.%s.%d.sql", schema, table, ForwardSqlFileNamePrefix, idx)), nil
 		} else {
-			return filepath.Join(outDir, fmt.Sprintf("%s.%d.sql", ForwardSqlFileNamePrefix, idx))
+			return filepath.Join(outDir, fmt.Sprintf("%s.%d.sql", ForwardSqlFileNamePrefix, idx)), nil
 		}
 
 	}
@@ -321,6 +592,11 @@ func GetForwardRollbackSqlFileName(schema string, table string, filePerTable boo
 
 func GetForwardRollbackContentLineWithExtra(sq ForwardRollbackSqlOfPrint, ifExtra bool) string {
 	if ifExtra {
+		if sq.sqlInfo.gtid != "" {
+			return fmt.Sprintf("# datetime=%s database=%s table=%s binlog=%s startpos=%d stoppos=%d gtid=%s\n%s;\n",
+				sq.sqlInfo.datetime, sq.sqlInfo.schema, sq.sqlInfo.table, sq.sqlInfo.binlog, sq.sqlInfo.startpos,
+				sq.sqlInfo.endpos, sq.sqlInfo.gtid, strings.Join(sq.sqls, ";\n"))
+		}
 		return fmt.Sprintf("# datetime=%s database=%s table=%s binlog=%s startpos=%d stoppos=%d\n%s;\n",
 			sq.sqlInfo.datetime, sq.sqlInfo.schema, sq.sqlInfo.table, sq.sqlInfo.binlog, sq.sqlInfo.startpos,
 			sq.sqlInfo.endpos, strings.Join(sq.sqls, ";\n"))
@@ -1,63 +1,123 @@
 package base
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
-	toolkits "my-wails-app/pkg/my2sql/toolkits"
-
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/juju/errors"
+	"github.com/klauspost/compress/zstd"
 	"github.com/siddontang/go-log/log"
 )
 
+// BinlogCompressSuffixes are the suffixes of compressed binlog files, which are parsed without decompressing by hand.
+// the compression is detected by the magic bytes, not by the suffix
+var BinlogCompressSuffixes = []string{".gz", ".zst"}
+
+// BinlogIndexSuffix is the suffix of the index file listing the binlogs in order, ex: mysql-bin.index, relay-log.index
+const BinlogIndexSuffix = ".index"
+
 var (
-	fileBinEventHandlingIndex uint64 = 0
-	fileTrxIndex              uint64 = 0
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
 )
 
+// binlogFileReader reads a binlog file, decompressing it if it is compressed by gzip or zstd
+type binlogFileReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (this *binlogFileReader) Close() error {
+	var err error
+	for i := len(this.closers) - 1; i >= 0; i-- {
+		if cerr := this.closers[i](); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// OpenBinlogFile opens a binlog file, gzip and zstd compressed files are decompressed while reading
+func OpenBinlogFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(f, 1024*1024)
+	r := &binlogFileReader{Reader: br, closers: []func() error{f.Close}}
+	magic, _ := br.Peek(len(zstdMagic))
+	if bytes.HasPrefix(magic, gzipMagic) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.Reader = gr
+		r.closers = append(r.closers, gr.Close)
+	} else if bytes.Equal(magic, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.Reader = zr
+		r.closers = append(r.closers, func() error { zr.Close(); return nil })
+	}
+	return r, nil
+}
+
 type BinFileParser struct {
 	Parser *replication.BinlogParser
 }
 
-func (this BinFileParser) MyParseAllBinlogFiles(cfg *ConfCmd) {
+func (this BinFileParser) MyParseAllBinlogFiles(ctx context.Context, cfg *ConfCmd) error {
 	defer cfg.CloseChan()
 	log.Info("start to parse binlog from local files")
 	binlog, binpos := GetFirstBinlogPosToParse(cfg)
-	binBaseName, binBaseIndx := GetBinlogBasenameAndIndex(binlog)
+	if _, _, err := GetBinlogBasenameAndIndex(binlog); err != nil {
+		return err
+	}
+	PrepareTableDefs(ctx, cfg, ScanDdlsInFiles)
 	log.Info(fmt.Sprintf("start to parse %s %d\n", binlog, binpos))
 
 	for {
 		if cfg.IfSetStopFilePos {
-			if cfg.StopFilePos.Compare(mysql.Position{Name: filepath.Base(binlog), Pos: 4}) < 1 {
+			if cfg.StopFilePos.Compare(mysql.Position{Name: TrimBinlogCompressSuffix(filepath.Base(binlog)), Pos: 4}) < 1 {
 				break
 			}
 		}
 
 		log.Info(fmt.Sprintf("start to parse %s %d\n", binlog, binpos))
-		result, err := this.MyParseOneBinlogFile(cfg, binlog)
+		result, err := this.MyParseOneBinlogFile(ctx, cfg, binlog)
 		if err != nil {
 			log.Error(fmt.Sprintf("error to parse binlog %s %v", binlog, err))
-			break
+			return WrapEngineError(ErrCategoryDecode, mysql.Position{Name: TrimBinlogCompressSuffix(filepath.Base(binlog)), Pos: 4}, err)
 		}
 
 		if result == C_reBreak {
 			break
 		} else if result == C_reFileEnd {
-			if !cfg.IfSetStopParsPoint && !cfg.IfSetStopDateTime {
+			if !cfg.IfSetStopParsPoint && !cfg.IfSetStopDateTime && !cfg.ParseWholeDir {
 				//just parse one binlog
 				break
 			}
-			binlog = filepath.Join(cfg.BinlogDir, GetNextBinlog(binBaseName, binBaseIndx))
-			if !toolkits.IsFile(binlog) {
-				log.Info(fmt.Sprintf("%s not exists nor a file\n", binlog))
+			nextBinlog, err := GetNextBinlogFile(cfg.BinlogDir, binlog)
+			if err != nil {
+				return WrapEngineError(ErrCategoryDecode, mysql.Position{Name: TrimBinlogCompressSuffix(filepath.Base(binlog)), Pos: 4}, err)
+			}
+			if nextBinlog == "" {
+				log.Info(fmt.Sprintf("no binlog after %s in %s\n", filepath.Base(binlog), cfg.BinlogDir))
 				break
 			}
-			binBaseIndx++
+			binlog = nextBinlog
 			binpos = 4
 		} else {
 			log.Info(fmt.Sprintf("this should not happen: return value of MyParseOneBinlog is %d\n", result))
@@ -66,195 +126,170 @@ func (this BinFileParser) MyParseAllBinlogFiles(cfg *ConfCmd) {
 
 	}
 	log.Info("finish parsing binlog from local files")
-
+	return nil
 }
 
-func (this BinFileParser) MyParseOneBinlogFile(cfg *ConfCmd, name string) (int, error) {
+func (this BinFileParser) MyParseOneBinlogFile(ctx context.Context, cfg *ConfCmd, name string) (int, error) {
 	// process: 0, continue: 1, break: 2
-	f, err := os.Open(name)
-	if f != nil {
-		defer f.Close()
-	}
+	f, err := OpenBinlogFile(name)
 	if err != nil {
 		log.Error(fmt.Sprintf("fail to open %s %v\n", name, err))
 		return C_reBreak, errors.Trace(err)
 	}
+	defer f.Close()
 
 	fileTypeBytes := int64(4)
 
+	// the header is checked after decompression, a compressed file is read from the beginning only
 	b := make([]byte, fileTypeBytes)
-	if _, err = f.Read(b); err != nil {
+	if _, err = io.ReadFull(f, b); err != nil {
 		log.Error(fmt.Sprintf("fail to read %s %v", name, err))
 		return C_reBreak, errors.Trace(err)
 	} else if !bytes.Equal(b, replication.BinLogFileHeader) {
 		log.Error(fmt.Sprintf("%s is not a valid binlog file, head 4 bytes must fe'bin' ", name))
-		return C_reBreak, errors.Trace(err)
+		return C_reBreak, errors.Errorf("%s is not a valid binlog file, head 4 bytes must fe'bin' ", name)
 	}
 
 	// must not seek to other position, otherwise the program may panic because formatevent, table map event is skipped
-	if _, err = f.Seek(fileTypeBytes, os.SEEK_SET); err != nil {
-		log.Error(fmt.Sprintf("error seek %s to %d", name, fileTypeBytes))
-		return C_reBreak, errors.Trace(err)
+	var binlog string = TrimBinlogCompressSuffix(filepath.Base(name))
+	isRelay := IsRelayLogFile(filepath.Dir(name), binlog)
+	if isRelay {
+		log.Infof("%s is a relay log, events are located by their position in it", binlog)
 	}
-	var binlog string = filepath.Base(name)
-	return this.MyParseReader(cfg, f, &binlog)
+	return this.MyParseReader(ctx, cfg, f, &binlog, isRelay)
 }
 
-func (this BinFileParser) MyParseReader(cfg *ConfCmd, r io.Reader, binlog *string) (int, error) {
+// MyParseReader parses the events of a binlog file from r, isRelay is true if it is a relay log, see IsRelayLogFile
+func (this BinFileParser) MyParseReader(ctx context.Context, cfg *ConfCmd, r io.Reader, binlog *string, isRelay bool) (int, error) {
 	// process: 0, continue: 1, break: 2, EOF: 3
-	/*
-		var (
-			err       error
-			n         int64
-			db        string = ""
-			tb        string = ""
-			sql       string = ""
-			sqlType   string = ""
-			rowCnt    uint32 = 0
-			trxStatus int    = 0
-			sqlLower  string = ""
-			tbMapPos  uint32 = 0
-		)
-
-		for {
-			headBuf := make([]byte, replication.EventHeaderSize)
+	var (
+		err      error
+		n        int64
+		tbMapPos uint32 = 0
+		lastPos  uint32 = 4 // end position of the last event, it is where the event being read starts
+	)
 
-			if _, err = io.ReadFull(r, headBuf); err == io.EOF {
-				return C_reFileEnd, nil
-			} else if err != nil {
-				log.Error(fmt.Sprintf("fail to read binlog event header of %s %v", *binlog, err))
-				return C_reBreak, errors.Trace(err)
-			}
-
-			var h *replication.EventHeader
-			h, err = this.Parser.ParseHeader(headBuf)
-			if err != nil {
-				log.Error(fmt.Sprintf("fail to parse binlog event header of %s %v", *binlog, err))
-				return C_reBreak, errors.Trace(err)
-			}
-			//fmt.Printf("parsing %s %d %s\n", *binlog, h.LogPos, GetDatetimeStr(int64(h.Timestamp), int64(0), DATETIME_FORMAT))
-
-			if h.EventSize <= uint32(replication.EventHeaderSize) {
-				err = errors.Errorf("invalid event header, event size is %d, too small", h.EventSize)
-				log.Error("%v", err)
-				return C_reBreak, err
-			}
-
-			var buf bytes.Buffer
-			if n, err = io.CopyN(&buf, r, int64(h.EventSize)-int64(replication.EventHeaderSize)); err != nil {
-				err = errors.Errorf("get event body err %v, need %d - %d, but got %d", err, h.EventSize, replication.EventHeaderSize, n)
-				log.Error("%v", err)
-				return C_reBreak, err
-			}
-
-			//h.Dump(os.Stdout)
-
-			data := buf.Bytes()
-			var rawData []byte
-			rawData = append(rawData, headBuf...)
-			rawData = append(rawData, data...)
+	for {
+		if ctx.Err() != nil {
+			log.Infof("stop parsing, reached %s:%d", *binlog, lastPos)
+			return C_reBreak, nil
+		}
+		headBuf := make([]byte, replication.EventHeaderSize)
+
+		if _, err = io.ReadFull(r, headBuf); err == io.EOF {
+			return C_reFileEnd, nil
+		} else if err != nil {
+			log.Error(fmt.Sprintf("fail to read binlog event header of %s %v", *binlog, err))
+			return C_reBreak, NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+				"fail to read binlog event header %v", err)
+		}
 
-			eventLen := int(h.EventSize) - replication.EventHeaderSize
+		h := &replication.EventHeader{}
+		err = h.Decode(headBuf)
+		if err != nil {
+			log.Error(fmt.Sprintf("fail to parse binlog event header of %s %v", *binlog, err))
+			return C_reBreak, NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+				"fail to parse binlog event header %v", err)
+		}
+		//fmt.Printf("parsing %s %d %s\n", *binlog, h.LogPos, GetDatetimeStr(int64(h.Timestamp), int64(0), DATETIME_FORMAT))
 
-			if len(data) != eventLen {
-				err = errors.Errorf("invalid data size %d in event %s, less event length %d", len(data), h.EventType, eventLen)
-				log.Errorf("%v", err)
-				return C_reBreak, err
-			}
+		if h.EventSize <= uint32(replication.EventHeaderSize) {
+			err = NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+				"invalid event header, event size is %d, too small", h.EventSize)
+			log.Errorf("%v", err)
+			return C_reBreak, err
+		}
 
-			var e replication.Event
-			e, err = this.Parser.ParseEvent(h, data, rawData)
-			if err != nil {
-				log.Error(fmt.Sprintf("fail to parse binlog event body of %s %v", *binlog, err))
-				return C_reBreak, errors.Trace(err)
-			}
-			if h.EventType == replication.TABLE_MAP_EVENT {
-				tbMapPos = h.LogPos - h.EventSize // avoid mysqlbing mask the row event as unknown table row event
-			}
+		var buf bytes.Buffer
+		if n, err = io.CopyN(&buf, r, int64(h.EventSize)-int64(replication.EventHeaderSize)); err != nil {
+			err = NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+				"get event body err %v, need %d - %d, but got %d", err, h.EventSize, replication.EventHeaderSize, n)
+			log.Errorf("%v", err)
+			return C_reBreak, err
+		}
 
-			//e.Dump(os.Stdout)
-			//can not advance this check, because we need to parse table map event or table may not found. Also we must seek ahead the read file position
-			chRe := CheckBinHeaderCondition(cfg, h, *binlog)
-			if chRe == C_reBreak {
-				return C_reBreak, nil
-			} else if chRe == C_reContinue {
-				continue
-			} else if chRe == C_reFileEnd {
-				return C_reFileEnd, nil
-			}
+		var rawData []byte
+		rawData = append(rawData, headBuf...)
+		rawData = append(rawData, buf.Bytes()...)
 
-			//binEvent := &replication.BinlogEvent{RawData: rawData, Header: h, Event: e}
-			binEvent := &replication.BinlogEvent{Header: h, Event: e} // we donnot need raw data
-			oneMyEvent := &MyBinEvent{MyPos: mysql.Position{Name: *binlog, Pos: h.LogPos},
-				StartPos: tbMapPos}
-			//StartPos: h.LogPos - h.EventSize}
-			chRe = oneMyEvent.CheckBinEvent(cfg, binEvent, binlog)
-			if chRe == C_reBreak {
-				return C_reBreak, nil
-			} else if chRe == C_reContinue {
-				continue
-			} else if chRe == C_reFileEnd {
-				return C_reFileEnd, nil
+		// the parser keeps the format description and table map events it has seen,
+		// so every event must go through it even if it is filtered out below
+		var binEvent *replication.BinlogEvent
+		binEvent, err = this.Parser.Parse(rawData)
+		if err != nil {
+			log.Error(fmt.Sprintf("fail to parse binlog event body of %s %v", *binlog, err))
+			return C_reBreak, NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+				"fail to parse binlog event body %v", err)
+		}
+		binEvent.RawData = []byte{} // we donnot need raw data
+		h = binEvent.Header
+		if h.EventType == replication.FORMAT_DESCRIPTION_EVENT {
+			if err = cfg.SetPayloadFormat(binEvent.Event.(*replication.FormatDescriptionEvent)); err != nil {
+				return C_reBreak, NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+					"fail to take the format description event %v", err)
 			}
-
-			db, tb, sqlType, sql, rowCnt = GetDbTbAndQueryAndRowCntFromBinevent(binEvent)
-			if sqlType == "query" {
-				sqlLower = strings.ToLower(sql)
-				if sqlLower == "begin" {
-					trxStatus = C_trxBegin
-					fileTrxIndex++
-				} else if sqlLower == "commit" {
-					trxStatus = C_trxCommit
-				} else if sqlLower == "rollback" {
-					trxStatus = C_trxRollback
-				} else if oneMyEvent.QuerySql != nil {
-					trxStatus = C_trxProcess
-					rowCnt = 1
-				}
-			} else {
-				trxStatus = C_trxProcess
+		}
+		if h.LogPos != lastPos+h.EventSize {
+			if !isRelay {
+				return C_reBreak, NewEngineError(ErrCategoryDecode, mysql.Position{Name: *binlog, Pos: lastPos},
+					"event of %d bytes starting at %d ends at %d, the file is broken, or it is a relay log not named as one", h.EventSize, lastPos, h.LogPos)
 			}
+			// events a replica receives keep the positions of the source binlog in the relay log,
+			// they are located by their position in the relay log instead
+			h.LogPos = lastPos + h.EventSize
+		}
+		lastPos = h.LogPos
 
-			if cfg.WorkType != "stats" {
-				ifSendEvent := false
-				if oneMyEvent.IfRowsEvent {
+		if h.EventType == replication.TABLE_MAP_EVENT {
+			tbMapPos = h.LogPos - h.EventSize // avoid mysqlbing mask the row event as unknown table row event
+		}
 
-					tbKey := GetAbsTableName(string(oneMyEvent.BinEvent.Table.Schema),
-						string(oneMyEvent.BinEvent.Table.Table))
-					_, err = G_TablesColumnsInfo.GetTableInfoJson(string(oneMyEvent.BinEvent.Table.Schema),
-						string(oneMyEvent.BinEvent.Table.Table))
-					if err != nil {
-						log.Fatalf(fmt.Sprintf("no table struct found for %s, it maybe dropped, skip it. RowsEvent position:%s",
-							tbKey, oneMyEvent.MyPos.String()))
-					}
-					ifSendEvent = true
-				}
+		//can not advance this check, because we need to parse table map event or table may not found. Also we must seek ahead the read file position
+		chRe := CheckBinHeaderCondition(cfg, h, *binlog)
+		if chRe == C_reBreak {
+			return C_reBreak, nil
+		} else if chRe == C_reContinue {
+			continue
+		} else if chRe == C_reFileEnd {
+			return C_reFileEnd, nil
+		}
 
-				if ifSendEvent {
-					fileBinEventHandlingIndex++
-					oneMyEvent.EventIdx = fileBinEventHandlingIndex
-					oneMyEvent.SqlType = sqlType
-					oneMyEvent.Timestamp = h.Timestamp
-					oneMyEvent.TrxIndex = fileTrxIndex
-					oneMyEvent.TrxStatus = trxStatus
-					cfg.EventChan <- *oneMyEvent
+		if h.EventType == replication.TRANSACTION_PAYLOAD_EVENT {
+			eventBinlog := *binlog
+			chRe, err = cfg.DispatchPayloadEvent(ctx, binEvent, &eventBinlog)
+			if err != nil {
+				if ctx.Err() != nil {
+					log.Infof("stop parsing, reached %s:%d", *binlog, lastPos)
+					return C_reBreak, nil
 				}
-
+				return C_reBreak, err
 			}
-
-			//output analysis result whatever the WorkType is
-			if sqlType != "" {
-				if sqlType == "query" {
-					cfg.StatChan <- BinEventStats{Timestamp: h.Timestamp, Binlog: *binlog, StartPos: h.LogPos - h.EventSize, StopPos: h.LogPos,
-						Database: db, Table: tb, QuerySql: sql, RowCnt: rowCnt, QueryType: sqlType}
-				} else {
-					cfg.StatChan <- BinEventStats{Timestamp: h.Timestamp, Binlog: *binlog, StartPos: tbMapPos, StopPos: h.LogPos,
-						Database: db, Table: tb, QuerySql: sql, RowCnt: rowCnt, QueryType: sqlType}
-				}
+			if chRe == C_reBreak || chRe == C_reFileEnd {
+				return chRe, nil
 			}
+			continue
+		}
 
+		oneMyEvent := &MyBinEvent{MyPos: mysql.Position{Name: *binlog, Pos: h.LogPos},
+			StartPos: tbMapPos}
+		// the name of a local binlog is its file name, the rotate events of the source in a relay log must not change it.
+		// the rotate event at the end of the file is handled by MyParseAllBinlogFiles
+		eventBinlog := *binlog
+		chRe = oneMyEvent.CheckBinEvent(cfg, binEvent, &eventBinlog)
+		if chRe == C_reBreak {
+			return C_reBreak, nil
+		} else if chRe == C_reContinue {
+			continue
+		} else if chRe == C_reFileEnd {
+			return C_reFileEnd, nil
 		}
 
-		return C_reFileEnd, nil*/
-	return 0, nil
+		if err = cfg.DispatchBinEvent(ctx, binEvent, oneMyEvent, *binlog, tbMapPos); err != nil {
+			if ctx.Err() != nil {
+				log.Infof("stop parsing, reached %s:%d", *binlog, lastPos)
+				return C_reBreak, nil
+			}
+			return C_reBreak, err
+		}
+	}
 }
@@ -0,0 +1,310 @@
+package base
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	w, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil)
+}
+
+func TestOpenBinlogFile(t *testing.T) {
+	dir := t.TempDir()
+	content := append([]byte("\xfebin"), bytes.Repeat([]byte("event"), 1000)...)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "mysql-bin.000001", data: content},
+		{name: "mysql-bin.000002.gz", data: gzipBytes(t, content)},
+		{name: "mysql-bin.000003.zst", data: zstdBytes(t, content)},
+		// the compression is detected by the magic bytes, not by the suffix
+		{name: "mysql-bin.000004", data: gzipBytes(t, content)},
+		{name: "mysql-bin.000005.gz", data: content},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(fileName, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			r, err := OpenBinlogFile(fileName)
+			if err != nil {
+				t.Fatalf("OpenBinlogFile() error = %v", err)
+			}
+			got, err := io.ReadAll(r)
+			if cerr := r.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				t.Fatalf("fail to read %s %v", tt.name, err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("content of %s is not the binlog, %d bytes read", tt.name, len(got))
+			}
+		})
+	}
+
+	if _, err := OpenBinlogFile(filepath.Join(dir, "mysql-bin.000009")); err == nil {
+		t.Errorf("OpenBinlogFile() opens a missing file")
+	}
+	// a file with the magic bytes of gzip but broken
+	broken := filepath.Join(dir, "mysql-bin.000010.gz")
+	if err := os.WriteFile(broken, []byte{0x1f, 0x8b, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBinlogFile(broken); err == nil {
+		t.Errorf("OpenBinlogFile() opens a broken gzip file")
+	}
+}
+
+func TestTrimBinlogCompressSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "mysql-bin.000001", want: "mysql-bin.000001"},
+		{name: "mysql-bin.000001.gz", want: "mysql-bin.000001"},
+		{name: "mysql-bin.000001.zst", want: "mysql-bin.000001"},
+		{name: "mysql-bin.000001.bz2", want: "mysql-bin.000001.bz2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimBinlogCompressSuffix(tt.name); got != tt.want {
+				t.Errorf("TrimBinlogCompressSuffix() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBinlogFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"mysql-bin.000001", "mysql-bin.000002.gz", "mysql-bin.000003.zst"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		binlog string
+		want   string
+	}{
+		{binlog: "mysql-bin.000001", want: "mysql-bin.000001"},
+		{binlog: "mysql-bin.000002", want: "mysql-bin.000002.gz"},
+		{binlog: "mysql-bin.000002.gz", want: "mysql-bin.000002.gz"},
+		{binlog: "mysql-bin.000003", want: "mysql-bin.000003.zst"},
+		{binlog: "mysql-bin.000004", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.binlog, func(t *testing.T) {
+			want := tt.want
+			if want != "" {
+				want = filepath.Join(dir, want)
+			}
+			if got := FindBinlogFile(dir, tt.binlog); got != want {
+				t.Errorf("FindBinlogFile() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetFirstBinlogInDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{name: "sorted by index", files: map[string]string{"mysql-bin.000010": "", "mysql-bin.000009": "", "mysql-bin.000011": ""},
+			want: "mysql-bin.000009"},
+		{name: "differently padded", files: map[string]string{"mysql-bin.100": "", "mysql-bin.99": ""}, want: "mysql-bin.99"},
+		{name: "compressed", files: map[string]string{"mysql-bin.000003.gz": "", "mysql-bin.000004.zst": "", "mysql-bin.000005": ""},
+			want: "mysql-bin.000003.gz"},
+		{name: "other files are ignored", files: map[string]string{"mysql-bin.000002": "", "mysql-bin.log": "", "a.000001.sql": ""},
+			want: "mysql-bin.000002"},
+		{name: "first listed in index file", files: map[string]string{"mysql-bin.index": "./mysql-bin.000005\n./mysql-bin.000006\n",
+			"mysql-bin.000004": "", "mysql-bin.000005": "", "mysql-bin.000006": ""}, want: "mysql-bin.000005"},
+		{name: "purged binlogs in index file", files: map[string]string{"relay.index": "/data/relay.000001\n/data/relay.000002.gz\n",
+			"relay.000002.gz": ""}, want: "relay.000002.gz"},
+		{name: "no binlog", files: map[string]string{"a.txt": ""}, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			got, err := GetFirstBinlogInDir(dir)
+			want := tt.want
+			if want != "" {
+				want = filepath.Join(dir, want)
+			}
+			if (err != nil) != (want == "") || got != want {
+				t.Errorf("GetFirstBinlogInDir() = %q, %v, want %q", got, err, want)
+			}
+		})
+	}
+}
+
+func TestReadBinlogIndex(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"mysql-bin.index":  "./mysql-bin.000001\r\n\r\n.\\mysql-bin.000002\n/var/lib/mysql/mysql-bin.000003\nmysql-bin.000004\n",
+		"mysql-bin.000002": "", "mysql-bin.000003.gz": "", "mysql-bin.000004": "",
+	})
+	got := readBinlogIndex(dir, "mysql-bin.index")
+	want := []string{"mysql-bin.000002", "mysql-bin.000003", "mysql-bin.000004"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("readBinlogIndex() = %v, want %v", got, want)
+	}
+	if got = readBinlogIndex(dir, "missing.index"); got != nil {
+		t.Errorf("readBinlogIndex() of missing index file = %v", got)
+	}
+}
+
+func TestGetNextBinlogFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		binlog string
+		want   string
+	}{
+		{name: "next index", files: map[string]string{"mysql-bin.000001": "", "mysql-bin.000002": ""},
+			binlog: "mysql-bin.000001", want: "mysql-bin.000002"},
+		{name: "last one", files: map[string]string{"mysql-bin.000001": "", "mysql-bin.000002": ""},
+			binlog: "mysql-bin.000002", want: ""},
+		{name: "gap", files: map[string]string{"mysql-bin.000001": "", "mysql-bin.000004": ""},
+			binlog: "mysql-bin.000001", want: "mysql-bin.000004"},
+		{name: "differently padded", files: map[string]string{"mysql-bin.999999": "", "mysql-bin.1000000": ""},
+			binlog: "mysql-bin.999999", want: "mysql-bin.1000000"},
+		{name: "compressed", files: map[string]string{"mysql-bin.000001.gz": "", "mysql-bin.000002.zst": ""},
+			binlog: "mysql-bin.000001.gz", want: "mysql-bin.000002.zst"},
+		{name: "other base names are ignored", files: map[string]string{"mysql-bin.000001": "", "relay-bin.000002": "", "mysql-bin.000003": ""},
+			binlog: "mysql-bin.000001", want: "mysql-bin.000003"},
+		{name: "base name with dots", files: map[string]string{"db1.bin.000001": "", "db1.bin.000002": ""},
+			binlog: "db1.bin.000001", want: "db1.bin.000002"},
+		{name: "order of index file", files: map[string]string{"mysql-bin.index": "./mysql-bin.000003\n./mysql-bin.000001\n",
+			"mysql-bin.000001": "", "mysql-bin.000003": ""}, binlog: "mysql-bin.000003", want: "mysql-bin.000001"},
+		{name: "not in index file", files: map[string]string{"mysql-bin.index": "./mysql-bin.000003\n",
+			"mysql-bin.000001": "", "mysql-bin.000003": ""}, binlog: "mysql-bin.000001", want: "mysql-bin.000003"},
+		{name: "binlog removed", files: map[string]string{"mysql-bin.000001": "", "mysql-bin.000003": ""},
+			binlog: "mysql-bin.000002", want: "mysql-bin.000003"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			got, err := GetNextBinlogFile(dir, filepath.Join(dir, tt.binlog))
+			if err != nil {
+				t.Fatalf("GetNextBinlogFile() error = %v", err)
+			}
+			want := tt.want
+			if want != "" {
+				want = filepath.Join(dir, want)
+			}
+			if got != want {
+				t.Errorf("GetNextBinlogFile() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestIsRelayLogFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"host-relay-bin.000001": "", "relay.000001": "", "mysql-bin.000001": "", "repl.000001": "",
+		"host-relay-bin.index": "./repl.000001\n",
+	})
+	tests := []struct {
+		binlog string
+		want   bool
+	}{
+		{binlog: "host-relay-bin.000001", want: true},
+		{binlog: "relay.000001.gz", want: true},
+		{binlog: "repl.000001", want: true},
+		{binlog: "mysql-bin.000001", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.binlog, func(t *testing.T) {
+			if got := IsRelayLogFile(dir, tt.binlog); got != tt.want {
+				t.Errorf("IsRelayLogFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// xidEventData returns the raw data of a xid event ending at logPos
+func xidEventData(logPos uint32) []byte {
+	data := make([]byte, replication.EventHeaderSize+8)
+	binary.LittleEndian.PutUint32(data[0:], 1700000000)
+	data[4] = byte(replication.XID_EVENT)
+	binary.LittleEndian.PutUint32(data[5:], 1)
+	binary.LittleEndian.PutUint32(data[9:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	return data
+}
+
+func TestMyParseReaderPositions(t *testing.T) {
+	// positions of the source binlog, as the events a replica writes into its relay log
+	var data []byte
+	data = append(data, xidEventData(1027)...)
+	data = append(data, xidEventData(2027)...)
+	tests := []struct {
+		name       string
+		isRelay    bool
+		wantResult int
+		wantErr    bool
+	}{
+		{name: "relay log", isRelay: true, wantResult: C_reFileEnd},
+		{name: "binlog", isRelay: false, wantResult: C_reBreak, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// every event is before the start position, nothing is dispatched
+			cfg := &ConfCmd{IfSetStartFilePos: true, StartFilePos: mysql.Position{Name: "relay.000002", Pos: 4}}
+			binlog := "relay.000001"
+			result, err := BinFileParser{Parser: replication.NewBinlogParser()}.MyParseReader(context.Background(), cfg, bytes.NewReader(data), &binlog, tt.isRelay)
+			if result != tt.wantResult || (err != nil) != tt.wantErr {
+				t.Fatalf("MyParseReader() = %d, %v, want %d, error %v", result, err, tt.wantResult, tt.wantErr)
+			}
+			if err != nil {
+				if ee, ok := err.(*EngineError); !ok || ee.Category != ErrCategoryDecode || ee.Pos.Pos != 4 {
+					t.Errorf("MyParseReader() error = %v, want a decode error at 4", err)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,7 +18,7 @@ import (
 func IntSliceToString(iArr []int, sep string, prefix string) string {
 	sArr := make([]string, len(iArr))
 	for _, v := range iArr {
-		sArr = append(sArr, string(v))
+		sArr = append(sArr, strconv.Itoa(v))
 	}
 
 	return prefix + " " + strings.Join(sArr, sep)
@@ -71,17 +72,17 @@ func CheckIsDir(fd string) (bool, string) {
 	}
 }
 
-func GetBinlogBasenameAndIndex(binlog string) (string, int) {
-	binlogFile := filepath.Base(binlog)
+func GetBinlogBasenameAndIndex(binlog string) (string, int, error) {
+	binlogFile := TrimBinlogCompressSuffix(filepath.Base(binlog))
 	arr := strings.Split(binlogFile, ".")
 	cnt := len(arr)
 	n, err := strconv.ParseUint(arr[cnt-1], 10, 32)
 	if err != nil {
-		log.Fatalf("parse binlog file index number error %v", err)
+		return "", 0, NewConfigError("parse binlog file index number of %s error %v", binlogFile, err)
 	}
 	indx := int(n)
-	baseName := strings.Join(arr[0:cnt-1], "")
-	return baseName, indx
+	baseName := strings.Join(arr[0:cnt-1], ".")
+	return baseName, indx, nil
 }
 
 func GetFiledType(filed string) string {
@@ -92,6 +93,45 @@ func GetFiledType(filed string) string {
 	return arr[0]
 }
 
+// GetEnumSetValues returns the labels of enum or set type like SHOW COLUMNS, ex: enum('a','b'), nil for other types.
+// a quote in the label is doubled
+func GetEnumSetValues(filed string) []string {
+	tp := strings.ToLower(GetFiledType(filed))
+	if tp != "enum" && tp != "set" {
+		return nil
+	}
+	var (
+		values  []string
+		label   strings.Builder
+		inQuote bool
+	)
+	body := filed[strings.Index(filed, "(")+1:]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if !inQuote {
+			if c == '\'' {
+				inQuote = true
+				label.Reset()
+			} else if c == ')' {
+				break
+			}
+			continue
+		}
+		if c == '\'' {
+			if i+1 < len(body) && body[i+1] == '\'' {
+				label.WriteByte(c)
+				i++
+				continue
+			}
+			inQuote = false
+			values = append(values, label.String())
+			continue
+		}
+		label.WriteByte(c)
+	}
+	return values
+}
+
 func IsUnsigned(filed string) bool {
 	return strings.Contains(strings.ToLower(filed), "unsigned")
 }
@@ -103,6 +143,186 @@ func GetNextBinlog(baseName string, indx int) string {
 	return baseName + "." + idxStr
 }
 
+// GetFirstBinlogInDir returns the binlog file with the smallest index in dir,
+// binlog files are recognized by their numeric suffix, ex: mysql-bin.000001.
+// if there is an index file in dir, ex: mysql-bin.index, relay-log.index, the first binlog listed in it is returned
+func GetFirstBinlogInDir(dir string) (string, error) {
+	files, err := toolkits.FilesUnder(dir)
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if filepath.Ext(f) != BinlogIndexSuffix {
+			continue
+		}
+		if binlogs := readBinlogIndex(dir, f); len(binlogs) > 0 {
+			return FindBinlogFile(dir, binlogs[0]), nil
+		}
+	}
+
+	var binlogs []string
+	for _, f := range files {
+		if !isBinlogFileName(TrimBinlogCompressSuffix(f)) {
+			continue
+		}
+		binlogs = append(binlogs, f)
+	}
+	if len(binlogs) == 0 {
+		return "", fmt.Errorf("no binlog file found in %s", dir)
+	}
+	sort.Slice(binlogs, func(i, j int) bool {
+		return MyPos.CompareBinlogFileName(TrimBinlogCompressSuffix(binlogs[i]), TrimBinlogCompressSuffix(binlogs[j])) < 0
+	})
+	return filepath.Join(dir, binlogs[0]), nil
+}
+
+// isBinlogFileName returns true if name ends with a numeric suffix, ex: mysql-bin.000001, relay-bin.12
+func isBinlogFileName(name string) bool {
+	ext := filepath.Ext(name)
+	if len(ext) < 2 {
+		return false
+	}
+	_, err := strconv.ParseUint(ext[1:], 10, 32)
+	return err == nil
+}
+
+// readBinlogIndex returns the binlogs listed in the index file which exist in dir, in the order of the index file.
+// the index file lists one binlog a line, with the path mysqld writes it by, ex: ./mysql-bin.000001
+func readBinlogIndex(dir string, indexFile string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		log.Errorf("fail to read binlog index file %s %v", filepath.Join(dir, indexFile), err)
+		return nil
+	}
+	var binlogs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// the index file may be copied from a windows server
+		binlog := filepath.Base(strings.ReplaceAll(line, "\\", "/"))
+		if FindBinlogFile(dir, binlog) == "" {
+			// purged or not copied
+			continue
+		}
+		binlogs = append(binlogs, TrimBinlogCompressSuffix(binlog))
+	}
+	return binlogs
+}
+
+// ListBinlogFiles returns the binlogs of dir in order which have the same base name as binlog.
+// the order is taken from the index file <base name>.index if it exists and lists binlog,
+// otherwise the binlogs are sorted by their numeric suffix, so gaps and different padding are allowed
+func ListBinlogFiles(dir string, binlog string) ([]string, error) {
+	binlog = TrimBinlogCompressSuffix(filepath.Base(binlog))
+	baseName, _, err := GetBinlogBasenameAndIndex(binlog)
+	if err != nil {
+		return nil, err
+	}
+	indexFile := baseName + BinlogIndexSuffix
+	if toolkits.IsFile(filepath.Join(dir, indexFile)) {
+		binlogs := readBinlogIndex(dir, indexFile)
+		for _, b := range binlogs {
+			if b == binlog {
+				return binlogs, nil
+			}
+		}
+		log.Warnf("%s is not in index file %s, sort binlogs of %s instead", binlog, indexFile, dir)
+	}
+
+	files, err := toolkits.FilesUnder(dir)
+	if err != nil {
+		return nil, err
+	}
+	var binlogs []string
+	found := make(map[string]bool)
+	for _, f := range files {
+		name := TrimBinlogCompressSuffix(f)
+		if found[name] || !isBinlogFileName(name) || strings.TrimSuffix(name, filepath.Ext(name)) != baseName {
+			continue
+		}
+		found[name] = true
+		binlogs = append(binlogs, name)
+	}
+	sort.Slice(binlogs, func(i, j int) bool {
+		return MyPos.CompareBinlogFileName(binlogs[i], binlogs[j]) < 0
+	})
+	return binlogs, nil
+}
+
+// IsRelayLogFile returns true if binlog in dir is a relay log, decided by its name or the name of the index file listing it,
+// ex: mysqld-relay-bin.000001, or any binlog listed in mysqld-relay-bin.index
+func IsRelayLogFile(dir string, binlog string) bool {
+	binlog = TrimBinlogCompressSuffix(filepath.Base(binlog))
+	if baseName, _, err := GetBinlogBasenameAndIndex(binlog); err == nil && strings.Contains(strings.ToLower(baseName), "relay") {
+		return true
+	}
+	files, err := toolkits.FilesUnder(dir)
+	if err != nil {
+		return false
+	}
+	for _, f := range files {
+		if filepath.Ext(f) != BinlogIndexSuffix || !strings.Contains(strings.ToLower(f), "relay") {
+			continue
+		}
+		for _, b := range readBinlogIndex(dir, f) {
+			if b == binlog {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetNextBinlogFile returns the path of the binlog following binlog in dir, "" if binlog is the last one
+func GetNextBinlogFile(dir string, binlog string) (string, error) {
+	binlogs, err := ListBinlogFiles(dir, binlog)
+	if err != nil {
+		return "", err
+	}
+	binlog = TrimBinlogCompressSuffix(filepath.Base(binlog))
+	for i, b := range binlogs {
+		if b == binlog {
+			if i+1 < len(binlogs) {
+				return FindBinlogFile(dir, binlogs[i+1]), nil
+			}
+			return "", nil
+		}
+	}
+	// binlog is not listed, take the first one after it
+	for _, b := range binlogs {
+		if MyPos.CompareBinlogFileName(b, binlog) > 0 {
+			return FindBinlogFile(dir, b), nil
+		}
+	}
+	return "", nil
+}
+
+// TrimBinlogCompressSuffix returns the binlog name of a compressed binlog file, ex: mysql-bin.000001 for mysql-bin.000001.gz
+func TrimBinlogCompressSuffix(name string) string {
+	for _, suffix := range BinlogCompressSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// FindBinlogFile returns the path of binlog in dir, it is either the binlog itself or compressed with one of BinlogCompressSuffixes.
+// it returns "" if none exists
+func FindBinlogFile(dir string, binlog string) string {
+	binlog = TrimBinlogCompressSuffix(binlog)
+	for _, suffix := range append([]string{""}, BinlogCompressSuffixes...) {
+		fileName := filepath.Join(dir, binlog+suffix)
+		if toolkits.IsFile(fileName) {
+			return fileName
+		}
+	}
+	return ""
+}
+
 func GetDatetimeStr(sec int64, nsec int64, timeFmt string) string {
 	return time.Unix(sec, nsec).Format(timeFmt)
 }
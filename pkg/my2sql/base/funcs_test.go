@@ -0,0 +1,26 @@
+package base
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetEnumSetValues(t *testing.T) {
+	tests := []struct {
+		filed string
+		want  []string
+	}{
+		{filed: "enum('a','b','c')", want: []string{"a", "b", "c"}},
+		{filed: "set('x','y')", want: []string{"x", "y"}},
+		{filed: "ENUM('small','large')", want: []string{"small", "large"}},
+		{filed: "enum('it''s','a,b','(c)')", want: []string{"it's", "a,b", "(c)"}},
+		{filed: "enum('')", want: []string{""}},
+		{filed: "varchar(20)"},
+		{filed: "int unsigned"},
+	}
+	for _, tt := range tests {
+		if got := GetEnumSetValues(tt.filed); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetEnumSetValues(%s) = %#v, want %#v", tt.filed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package base
+
+import (
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/siddontang/go-log/log"
+)
+
+// ParseGtidOptions parses -start-gtid -stop-gtid -include-gtids -exclude-gtids
+// in the gtid format of MysqlType, such as 3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5 for mysql, 0-1-100 for mariadb
+func (this *ConfCmd) ParseGtidOptions() error {
+	var err error
+	if this.StartGtidSet, err = parseGtidOption(this.MysqlType, "start-gtid", this.StartGtid); err != nil {
+		return err
+	}
+	if this.StopGtidSet, err = parseGtidOption(this.MysqlType, "stop-gtid", this.StopGtid); err != nil {
+		return err
+	}
+	if this.StopGtidSet != nil {
+		// keep parsing the following binlogs until the stop gtid is reached
+		this.IfSetStopParsPoint = true
+	}
+	if this.StartGtidSet != nil {
+		// the transactions in -start-gtid count as seen for -stop-gtid, with -mode=repl mysql does not send them
+		this.seenGtidSet = this.StartGtidSet.Clone()
+	}
+	if this.IncludeGtidSet, err = parseGtidOption(this.MysqlType, "include-gtids", this.IncludeGtids); err != nil {
+		return err
+	}
+	if this.ExcludeGtidSet, err = parseGtidOption(this.MysqlType, "exclude-gtids", this.ExcludeGtids); err != nil {
+		return err
+	}
+	if this.StartGtidSet != nil && this.StopGtidSet != nil && this.StartGtidSet.Contain(this.StopGtidSet) {
+		return NewConfigError("-start-gtid %s already contains -stop-gtid %s, nothing to parse", this.StartGtid, this.StopGtid)
+	}
+	return nil
+}
+
+// parseGtidOption returns nil if the option is not set
+func parseGtidOption(flavor string, opt string, val string) (mysql.GTIDSet, error) {
+	if val == "" {
+		return nil, nil
+	}
+	gset, err := mysql.ParseGTIDSet(flavor, val)
+	if err != nil {
+		return nil, NewConfigError("invalid -%s %s for %s: %v", opt, val, flavor, err)
+	}
+	if gset.IsEmpty() {
+		return nil, nil
+	}
+	return gset, nil
+}
+
+// CheckGtidEvent decides by the gtid options whether the transaction started by the gtid event is parsed,
+// the result applies to all the events of the transaction until the next gtid event.
+// it returns C_reBreak once all the transactions of -stop-gtid have been seen, as mysqlbinlog does
+func (this *ConfCmd) CheckGtidEvent(ev *replication.BinlogEvent) int {
+	this.trxGtid = ""
+	this.skipTrx = false
+
+	if this.StopGtidSet != nil && this.seenGtidSet != nil && this.seenGtidSet.Contain(this.StopGtidSet) {
+		log.Infof("stop to get event. StopGtid set. all of StopGtid %s are seen", this.StopGtid)
+		return C_reBreak
+	}
+
+	if ev.Header.EventType == replication.ANONYMOUS_GTID_EVENT {
+		// gtid_mode=off, the transaction has no gtid
+		this.skipTrx = this.IncludeGtidSet != nil
+		return C_reProcess
+	}
+
+	gev, ok := ev.Event.(mysql.BinlogGTIDEvent)
+	if !ok {
+		return C_reProcess
+	}
+	gtid, err := gev.GTIDNext()
+	if err != nil {
+		log.Errorf("fail to get gtid of event at %d %v", ev.Header.LogPos, err)
+		return C_reProcess
+	}
+	this.trxGtid = gtid.String()
+	if this.StopGtidSet != nil {
+		this.seenGtidSet = AddGtidToSet(this.MysqlType, this.seenGtidSet, this.trxGtid)
+	}
+
+	if this.StartGtidSet != nil && this.StartGtidSet.Contain(gtid) {
+		this.skipTrx = true
+	} else if this.IncludeGtidSet != nil && !this.IncludeGtidSet.Contain(gtid) {
+		this.skipTrx = true
+	} else if this.ExcludeGtidSet != nil && this.ExcludeGtidSet.Contain(gtid) {
+		this.skipTrx = true
+	}
+	return C_reProcess
+}
+
+// AddGtidToSet adds the gtid of one transaction to gset, gset is created if it is nil
+func AddGtidToSet(flavor string, gset mysql.GTIDSet, gtid string) mysql.GTIDSet {
+	if gtid == "" {
+		return gset
+	}
+	if gset == nil {
+		var err error
+		if gset, err = mysql.ParseGTIDSet(flavor, ""); err != nil {
+			return nil
+		}
+	}
+	if err := gset.Update(gtid); err != nil {
+		log.Errorf("fail to add gtid %s into %s %v", gtid, gset.String(), err)
+	}
+	return gset
+}
@@ -0,0 +1,165 @@
+package base
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+const (
+	testUuidA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	testUuidB = "5b1e3c2a-0c3d-11ee-8c2a-0242ac120002"
+)
+
+func gtidEvent(t *testing.T, sid string, gno int64) *replication.BinlogEvent {
+	u, err := hex.DecodeString(strings.ReplaceAll(sid, "-", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &replication.BinlogEvent{Header: &replication.EventHeader{EventType: replication.GTID_EVENT},
+		Event: &replication.GTIDEvent{SID: u, GNO: gno}}
+}
+
+func TestCheckGtidEventStopGtid(t *testing.T) {
+	tests := []struct {
+		name      string
+		startGtid string
+		stopGtid  string
+		trxs      []*replication.BinlogEvent
+		wantCnt   int // count of the transactions parsed before the stop
+	}{
+		{
+			name:     "two uuids interleaved",
+			stopGtid: testUuidA + ":1-2," + testUuidB + ":1",
+			trxs: []*replication.BinlogEvent{gtidEvent(t, testUuidA, 1), gtidEvent(t, testUuidB, 1),
+				gtidEvent(t, testUuidA, 2), gtidEvent(t, testUuidB, 2), gtidEvent(t, testUuidA, 3)},
+			wantCnt: 3,
+		},
+		{
+			// a uuid missing from the stop set does not stop the job
+			name:     "uuid not in stop set",
+			stopGtid: testUuidA + ":1-2",
+			trxs: []*replication.BinlogEvent{gtidEvent(t, testUuidB, 10), gtidEvent(t, testUuidA, 1),
+				gtidEvent(t, testUuidB, 11), gtidEvent(t, testUuidA, 2), gtidEvent(t, testUuidB, 12)},
+			wantCnt: 4,
+		},
+		{
+			// nor does a gtid greater than the stop set before all the stop set is seen
+			name:     "uuid beyond before the other is done",
+			stopGtid: testUuidA + ":1," + testUuidB + ":1",
+			trxs: []*replication.BinlogEvent{gtidEvent(t, testUuidA, 1), gtidEvent(t, testUuidA, 2),
+				gtidEvent(t, testUuidB, 1), gtidEvent(t, testUuidA, 3)},
+			wantCnt: 3,
+		},
+		{
+			name:      "start gtid counts as seen",
+			startGtid: testUuidA + ":1-5",
+			stopGtid:  testUuidA + ":1-6," + testUuidB + ":1",
+			trxs: []*replication.BinlogEvent{gtidEvent(t, testUuidB, 1), gtidEvent(t, testUuidA, 6),
+				gtidEvent(t, testUuidA, 7)},
+			wantCnt: 2,
+		},
+		{
+			name:     "stop set never completed",
+			stopGtid: testUuidA + ":1-3",
+			trxs:     []*replication.BinlogEvent{gtidEvent(t, testUuidA, 1), gtidEvent(t, testUuidA, 3)},
+			wantCnt:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ConfCmd{MysqlType: "mysql", StartGtid: tt.startGtid, StopGtid: tt.stopGtid}
+			if err := cfg.ParseGtidOptions(); err != nil {
+				t.Fatalf("ParseGtidOptions() error = %v", err)
+			}
+			cnt := 0
+			for _, ev := range tt.trxs {
+				if cfg.CheckGtidEvent(ev) == C_reBreak {
+					break
+				}
+				cnt++
+			}
+			if cnt != tt.wantCnt {
+				t.Errorf("%d transactions parsed, want %d", cnt, tt.wantCnt)
+			}
+		})
+	}
+}
+
+func TestCheckGtidEventSkip(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *ConfCmd
+		ev       *replication.BinlogEvent
+		wantSkip bool
+		wantGtid string
+	}{
+		{name: "no gtid option", cfg: &ConfCmd{}, ev: gtidEvent(t, testUuidA, 1), wantGtid: testUuidA + ":1"},
+		{name: "in start gtid", cfg: &ConfCmd{StartGtid: testUuidA + ":1-5"}, ev: gtidEvent(t, testUuidA, 5), wantSkip: true, wantGtid: testUuidA + ":5"},
+		{name: "after start gtid", cfg: &ConfCmd{StartGtid: testUuidA + ":1-5"}, ev: gtidEvent(t, testUuidA, 6), wantGtid: testUuidA + ":6"},
+		{name: "in include gtids", cfg: &ConfCmd{IncludeGtids: testUuidB + ":3-4"}, ev: gtidEvent(t, testUuidB, 3), wantGtid: testUuidB + ":3"},
+		{name: "not in include gtids", cfg: &ConfCmd{IncludeGtids: testUuidB + ":3-4"}, ev: gtidEvent(t, testUuidA, 3), wantSkip: true, wantGtid: testUuidA + ":3"},
+		{name: "in exclude gtids", cfg: &ConfCmd{ExcludeGtids: testUuidA + ":2"}, ev: gtidEvent(t, testUuidA, 2), wantSkip: true, wantGtid: testUuidA + ":2"},
+		{name: "anonymous with include gtids", cfg: &ConfCmd{IncludeGtids: testUuidA + ":2"},
+			ev: &replication.BinlogEvent{Header: &replication.EventHeader{EventType: replication.ANONYMOUS_GTID_EVENT}, Event: &replication.GTIDEvent{}}, wantSkip: true},
+		{name: "anonymous", cfg: &ConfCmd{},
+			ev: &replication.BinlogEvent{Header: &replication.EventHeader{EventType: replication.ANONYMOUS_GTID_EVENT}, Event: &replication.GTIDEvent{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.MysqlType = "mysql"
+			if err := tt.cfg.ParseGtidOptions(); err != nil {
+				t.Fatalf("ParseGtidOptions() error = %v", err)
+			}
+			if tt.cfg.CheckGtidEvent(tt.ev) != C_reProcess {
+				t.Fatalf("CheckGtidEvent() stops the job")
+			}
+			if tt.cfg.skipTrx != tt.wantSkip || tt.cfg.trxGtid != tt.wantGtid {
+				t.Errorf("skip, gtid = %v, %q, want %v, %q", tt.cfg.skipTrx, tt.cfg.trxGtid, tt.wantSkip, tt.wantGtid)
+			}
+		})
+	}
+}
+
+func TestParseGtidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *ConfCmd
+		wantErr bool
+	}{
+		{name: "mysql", cfg: &ConfCmd{MysqlType: "mysql", StartGtid: testUuidA + ":1-5", StopGtid: testUuidA + ":1-9"}},
+		{name: "mariadb", cfg: &ConfCmd{MysqlType: "mariadb", IncludeGtids: "0-1-100,1-2-5"}},
+		{name: "invalid", cfg: &ConfCmd{MysqlType: "mysql", ExcludeGtids: "0-1-100"}, wantErr: true},
+		{name: "start contains stop", cfg: &ConfCmd{MysqlType: "mysql", StartGtid: testUuidA + ":1-5", StopGtid: testUuidA + ":2-3"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.ParseGtidOptions()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseGtidOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if ee, ok := err.(*EngineError); !ok || ee.Category != ErrCategoryConfig {
+					t.Errorf("ParseGtidOptions() error = %v, want a config error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestAddGtidToSet(t *testing.T) {
+	var gset mysql.GTIDSet
+	for _, gtid := range []string{testUuidA + ":1", "", testUuidA + ":2", testUuidB + ":7", testUuidA + ":4"} {
+		gset = AddGtidToSet("mysql", gset, gtid)
+	}
+	want := testUuidA + ":1-2:4," + testUuidB + ":7"
+	if gset == nil || gset.String() != want {
+		t.Errorf("AddGtidToSet() = %v, want %s", gset, want)
+	}
+	if AddGtidToSet("mysql", nil, "") != nil {
+		t.Errorf("AddGtidToSet() of no gtid creates a set")
+	}
+}
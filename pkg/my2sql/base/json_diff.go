@@ -0,0 +1,283 @@
+package base
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	SQL "my-wails-app/pkg/my2sql/sqlbuilder"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/siddontang/go-log/log"
+)
+
+// partial json update(binlog_row_value_options=PARTIAL_JSON): the after image of a json column
+// may be the diffs of the before image instead of the whole document, they are decoded into JsonDiffVector
+// by DecodePartialJsonDiffs
+
+// jsonPathLeg is one leg of a json path, a member name or an array index
+type jsonPathLeg struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJsonPath parses the json path of a json diff, ex: $.a."b c"[2]
+func parseJsonPath(path string) ([]jsonPathLeg, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid json path %s", path)
+	}
+	var legs []jsonPathLeg
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+			if i < len(path) && path[i] == '"' {
+				end := i + 1
+				for end < len(path) && path[end] != '"' {
+					if path[end] == '\\' {
+						end++
+					}
+					end++
+				}
+				if end >= len(path) {
+					return nil, fmt.Errorf("invalid json path %s, quote not closed", path)
+				}
+				var key string
+				if err := json.Unmarshal([]byte(path[i:end+1]), &key); err != nil {
+					return nil, fmt.Errorf("invalid json path %s %v", path, err)
+				}
+				legs = append(legs, jsonPathLeg{key: key})
+				i = end + 1
+			} else {
+				end := i
+				for end < len(path) && path[end] != '.' && path[end] != '[' {
+					end++
+				}
+				if end == i {
+					return nil, fmt.Errorf("invalid json path %s, empty member name", path)
+				}
+				legs = append(legs, jsonPathLeg{key: path[i:end]})
+				i = end
+			}
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid json path %s, bracket not closed", path)
+			}
+			idx, err := strconv.Atoi(strings.TrimSpace(path[i+1 : i+end]))
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid json path %s, only array index is supported", path)
+			}
+			legs = append(legs, jsonPathLeg{index: idx, isIndex: true})
+			i += end + 1
+		case ' ':
+			i++
+		default:
+			return nil, fmt.Errorf("invalid json path %s", path)
+		}
+	}
+	return legs, nil
+}
+
+// applyJsonDiffOp applies the diff to node at legs and returns the new node
+func applyJsonDiffOp(node interface{}, legs []jsonPathLeg, diff *replication.JsonDiff, value interface{}) (interface{}, error) {
+	if len(legs) == 0 {
+		if diff.Op == replication.JsonDiffOperationRemove {
+			return nil, fmt.Errorf("can not remove the json document itself")
+		}
+		return value, nil
+	}
+	leg := legs[0]
+	last := len(legs) == 1
+	if leg.isIndex {
+		arr, ok := node.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: not an array", diff.Path)
+		}
+		if last && diff.Op == replication.JsonDiffOperationInsert {
+			// like JSON_ARRAY_INSERT, the value is appended if the index is beyond the array
+			if leg.index >= len(arr) {
+				return append(arr, value), nil
+			}
+			arr = append(arr[:leg.index], append([]interface{}{value}, arr[leg.index:]...)...)
+			return arr, nil
+		}
+		if leg.index >= len(arr) {
+			return nil, fmt.Errorf("%s: array index out of range", diff.Path)
+		}
+		if last && diff.Op == replication.JsonDiffOperationRemove {
+			return append(arr[:leg.index], arr[leg.index+1:]...), nil
+		}
+		child, err := applyJsonDiffOp(arr[leg.index], legs[1:], diff, value)
+		if err != nil {
+			return nil, err
+		}
+		arr[leg.index] = child
+		return arr, nil
+	}
+
+	obj, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: not an object", diff.Path)
+	}
+	if last {
+		switch diff.Op {
+		case replication.JsonDiffOperationRemove:
+			delete(obj, leg.key)
+		default:
+			obj[leg.key] = value
+		}
+		return obj, nil
+	}
+	child, ok := obj[leg.key]
+	if !ok {
+		return nil, fmt.Errorf("%s: member %s not found", diff.Path, leg.key)
+	}
+	child, err := applyJsonDiffOp(child, legs[1:], diff, value)
+	if err != nil {
+		return nil, err
+	}
+	obj[leg.key] = child
+	return obj, nil
+}
+
+func decodeJsonDocument(doc string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	// keep numbers as they are, ex: 1.0 and big integers
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ApplyJsonDiff returns the json document after the diffs are applied to doc in order
+func ApplyJsonDiff(doc string, diffs JsonDiffVector) (string, error) {
+	node, err := decodeJsonDocument(doc)
+	if err != nil {
+		return "", fmt.Errorf("invalid json document %v", err)
+	}
+	for _, diff := range diffs {
+		legs, err := parseJsonPath(diff.Path)
+		if err != nil {
+			return "", err
+		}
+		var value interface{}
+		if diff.Op != replication.JsonDiffOperationRemove {
+			if value, err = decodeJsonDocument(diff.Value); err != nil {
+				return "", fmt.Errorf("invalid json value of %s %v", diff.Path, err)
+			}
+		}
+		if node, err = applyJsonDiffOp(node, legs, diff, value); err != nil {
+			return "", err
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(node); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// ResolvePartialJsonRows replaces the json diffs in the after images of a partial update rows event
+// with the whole documents, if the documents are in the before images.
+// the diffs whose documents are not logged are kept, see JsonDiffExpression
+func ResolvePartialJsonRows(rEv *replication.RowsEvent) {
+	for i := 0; i+1 < len(rEv.Rows); i += 2 {
+		before, after := rEv.Rows[i], rEv.Rows[i+1]
+		for ci, v := range after {
+			diffs, ok := v.(JsonDiffVector)
+			if !ok || ci >= len(before) {
+				continue
+			}
+			doc, ok := before[ci].(string)
+			if !ok {
+				continue
+			}
+			newDoc, err := ApplyJsonDiff(doc, diffs)
+			if err != nil {
+				log.Warnf("fail to apply %s to json document, keep it as json function %v", diffs.String(), err)
+				continue
+			}
+			after[ci] = newDoc
+		}
+	}
+}
+
+// JsonDiffExpression returns the expression to apply the json diffs to the column one by one,
+// JSON_REPLACE for replace, JSON_ARRAY_INSERT or JSON_SET for insert, JSON_REMOVE for remove
+func JsonDiffExpression(col SQL.NonAliasColumn, diffs JsonDiffVector) SQL.Expression {
+	var doc SQL.Expression = col
+	for _, diff := range diffs {
+		path := SQL.Literal(diff.Path)
+		switch diff.Op {
+		case replication.JsonDiffOperationRemove:
+			doc = SQL.SqlFunc("JSON_REMOVE", doc, path)
+		case replication.JsonDiffOperationInsert:
+			value := SQL.Cast(SQL.Literal(diff.Value), "JSON")
+			if strings.HasSuffix(diff.Path, "]") {
+				doc = SQL.SqlFunc("JSON_ARRAY_INSERT", doc, path, value)
+			} else {
+				doc = SQL.SqlFunc("JSON_SET", doc, path, value)
+			}
+		default:
+			doc = SQL.SqlFunc("JSON_REPLACE", doc, path, SQL.Cast(SQL.Literal(diff.Value), "JSON"))
+		}
+	}
+	return doc
+}
+
+// DropPartialJsonRows removes the rows of a partial update rows event whose sqls can not be generated:
+// the json diffs of a column are not all decoded, go-mysql decodes only the first diff, see DecodePartialJsonDiffs.
+// or for rollback, the json document before the diffs is not logged, it can not be reverted.
+// it returns why and the count of the rows removed, the sqls of the other rows are generated
+func DropPartialJsonRows(rEv *replication.RowsEvent, ifRollback bool, colDefs []SQL.NonAliasColumn) (string, int) {
+	var (
+		reason   string
+		dropped  int
+		rows     [][]interface{}
+		skipped  [][]int
+		keepSkip bool = len(rEv.SkippedColumns) == len(rEv.Rows)
+	)
+	for i := 0; i+1 < len(rEv.Rows); i += 2 {
+		rowReason := ""
+		for ci, v := range rEv.Rows[i+1] {
+			if ci >= len(colDefs) {
+				break
+			}
+			if _, ok := v.(*replication.JsonDiff); ok {
+				rowReason = fmt.Sprintf("partial json update: diffs of column %s can not be decoded", colDefs[ci].Name())
+				break
+			}
+			if _, ok := v.(JsonDiffVector); ok && ifRollback {
+				rowReason = fmt.Sprintf("rollback of partial json update: document of column %s is not in the before image, can not revert it",
+					colDefs[ci].Name())
+				break
+			}
+		}
+		if rowReason != "" {
+			if reason == "" {
+				reason = rowReason
+			}
+			dropped++
+			continue
+		}
+		rows = append(rows, rEv.Rows[i], rEv.Rows[i+1])
+		if keepSkip {
+			skipped = append(skipped, rEv.SkippedColumns[i], rEv.SkippedColumns[i+1])
+		}
+	}
+	if dropped > 0 {
+		rEv.Rows = rows
+		if keepSkip {
+			rEv.SkippedColumns = skipped
+		}
+	}
+	return reason, dropped
+}
@@ -0,0 +1,359 @@
+package base
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	SQL "my-wails-app/pkg/my2sql/sqlbuilder"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func jsonDiff(op replication.JsonDiffOperation, path string, value string) *replication.JsonDiff {
+	return &replication.JsonDiff{Op: op, Path: path, Value: value}
+}
+
+func TestApplyJsonDiff(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		diffs   JsonDiffVector
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "replace member",
+			doc:   `{"a":1,"b":2}`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.a", "10")},
+			want:  `{"a":10,"b":2}`,
+		},
+		{
+			name:  "insert member",
+			doc:   `{"a":1}`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationInsert, "$.b", `"x"`)},
+			want:  `{"a":1,"b":"x"}`,
+		},
+		{
+			name:  "insert array element",
+			doc:   `{"a":[1,3]}`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationInsert, "$.a[1]", "2")},
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "insert array element beyond the end",
+			doc:   `[1]`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationInsert, "$[5]", "2")},
+			want:  `[1,2]`,
+		},
+		{
+			name:  "remove member and array element",
+			doc:   `{"a":[1,2],"b":true}`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationRemove, "$.b", ""), jsonDiff(replication.JsonDiffOperationRemove, "$.a[0]", "")},
+			want:  `{"a":[2]}`,
+		},
+		{
+			name: "diffs applied in order",
+			doc:  `{"a":1,"b":[1],"d":null}`,
+			diffs: JsonDiffVector{
+				jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2"),
+				jsonDiff(replication.JsonDiffOperationRemove, "$.b", ""),
+				jsonDiff(replication.JsonDiffOperationInsert, "$.c", `"hi"`),
+				jsonDiff(replication.JsonDiffOperationReplace, "$.c", `"bye"`),
+			},
+			want: `{"a":2,"c":"bye","d":null}`,
+		},
+		{
+			name:  "quoted member name and big number",
+			doc:   `{"b c":{"d":12345678901234567890}}`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, `$."b c".d`, "1.0")},
+			want:  `{"b c":{"d":1.0}}`,
+		},
+		{
+			name:  "html characters are kept",
+			doc:   `{"a":"<b>"}`,
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.a", `"&"`)},
+			want:  `{"a":"&"}`,
+		},
+		{
+			name:    "member not found",
+			doc:     `{"a":1}`,
+			diffs:   JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.x.y", "1")},
+			wantErr: true,
+		},
+		{
+			name:    "array index out of range",
+			doc:     `[1]`,
+			diffs:   JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$[3]", "1")},
+			wantErr: true,
+		},
+		{
+			name:    "remove the document",
+			doc:     `{"a":1}`,
+			diffs:   JsonDiffVector{jsonDiff(replication.JsonDiffOperationRemove, "$", "")},
+			wantErr: true,
+		},
+		{
+			name:    "wildcard path",
+			doc:     `[1]`,
+			diffs:   JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$[*]", "1")},
+			wantErr: true,
+		},
+		{
+			name:    "second diff fails",
+			doc:     `{"a":1}`,
+			diffs:   JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2"), jsonDiff(replication.JsonDiffOperationReplace, "$.a[0]", "1")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJsonDiff(tt.doc, tt.diffs)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ApplyJsonDiff() = %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyJsonDiff() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyJsonDiff() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJsonDiffExpression(t *testing.T) {
+	col := SQL.StrColumn("doc", SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
+	tests := []struct {
+		name  string
+		diffs JsonDiffVector
+		want  string
+	}{
+		{
+			name:  "replace",
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.a", "1")},
+			want:  "JSON_REPLACE(`doc`,'$.a',CAST('1' AS JSON))",
+		},
+		{
+			name:  "insert member",
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationInsert, "$.a", "1")},
+			want:  "JSON_SET(`doc`,'$.a',CAST('1' AS JSON))",
+		},
+		{
+			name:  "insert array element",
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationInsert, "$.a[0]", "1")},
+			want:  "JSON_ARRAY_INSERT(`doc`,'$.a[0]',CAST('1' AS JSON))",
+		},
+		{
+			name:  "remove",
+			diffs: JsonDiffVector{jsonDiff(replication.JsonDiffOperationRemove, "$.a", "")},
+			want:  "JSON_REMOVE(`doc`,'$.a')",
+		},
+		{
+			name: "diffs nested in order",
+			diffs: JsonDiffVector{
+				jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2"),
+				jsonDiff(replication.JsonDiffOperationRemove, "$.b", ""),
+				jsonDiff(replication.JsonDiffOperationInsert, "$.c", "3"),
+			},
+			want: "JSON_SET(JSON_REMOVE(JSON_REPLACE(`doc`,'$.a',CAST('2' AS JSON)),'$.b'),'$.c',CAST('3' AS JSON))",
+		},
+		{
+			name:  "no diff",
+			diffs: JsonDiffVector{},
+			want:  "`doc`",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := JsonDiffExpression(col, tt.diffs).SerializeSql(&buf); err != nil {
+				t.Fatalf("SerializeSql() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("JsonDiffExpression() = %s, want %s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// binlogEvent returns the raw event of the body, with a 19 bytes header
+func binlogEvent(tp replication.EventType, body []byte) []byte {
+	header := make([]byte, replication.EventHeaderSize)
+	header[4] = byte(tp)
+	binary.LittleEndian.PutUint32(header[9:], uint32(replication.EventHeaderSize+len(body)))
+	return append(header, body...)
+}
+
+// newPartialUpdateParser returns a parser of mysql 8.0 binlog without checksum, which knows table db.t1:
+// id INT, name VARCHAR(40), doc JSON
+func newPartialUpdateParser(t *testing.T) *replication.BinlogParser {
+	parser := replication.NewBinlogParser()
+	fde := []byte{4, 0}
+	serverVersion := make([]byte, 50)
+	copy(serverVersion, "8.0.30")
+	fde = append(fde, serverVersion...)
+	fde = append(fde, 0, 0, 0, 0, replication.EventHeaderSize)
+	fde = append(fde, bytes.Repeat([]byte{10}, int(replication.PARTIAL_UPDATE_ROWS_EVENT))...)
+	fde = append(fde, replication.BINLOG_CHECKSUM_ALG_OFF, 0, 0, 0, 0)
+	if _, err := parser.Parse(binlogEvent(replication.FORMAT_DESCRIPTION_EVENT, fde)); err != nil {
+		t.Fatalf("parse format description event: %v", err)
+	}
+	tableMap := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 'd', 'b', 0, 2, 't', '1', 0,
+		3, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_JSON,
+		3, 40, 0, 4, 0x06}
+	if _, err := parser.Parse(binlogEvent(replication.TABLE_MAP_EVENT, tableMap)); err != nil {
+		t.Fatalf("parse table map event: %v", err)
+	}
+	return parser
+}
+
+// partialUpdateEvent returns a partial update rows event of one row of db.t1, doc is NULL before it
+// and vector is the diff vector of doc after it
+func partialUpdateEvent(vector []byte) []byte {
+	body := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 3, 0x07, 0x07}
+	// before image
+	body = append(body, 0x04, 1, 0, 0, 0, 2, 'a', 'b')
+	// after image: binlog_row_value_options, partial bitmap, null bitmap and the values
+	body = append(body, 1, 0x01, 0x00, 1, 0, 0, 0, 2, 'c', 'd')
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(len(vector)))
+	body = append(body, length...)
+	body = append(body, vector...)
+	return binlogEvent(replication.PARTIAL_UPDATE_ROWS_EVENT, body)
+}
+
+func TestDecodePartialJsonDiffs(t *testing.T) {
+	var (
+		// replace $.a with int16 2
+		replaceA = []byte{byte(replication.JsonDiffOperationReplace), 3, '$', '.', 'a', 3, 0x05, 2, 0}
+		// remove $.b
+		removeB = []byte{byte(replication.JsonDiffOperationRemove), 3, '$', '.', 'b'}
+		// insert $.c with string "hi"
+		insertC = []byte{byte(replication.JsonDiffOperationInsert), 3, '$', '.', 'c', 4, 0x0c, 2, 'h', 'i'}
+		// the value is 9 bytes but 1 is logged
+		truncated = []byte{byte(replication.JsonDiffOperationReplace), 3, '$', '.', 'd', 9, 0x05}
+	)
+	tests := []struct {
+		name    string
+		vector  []byte
+		want    JsonDiffVector
+		wantErr bool
+	}{
+		{
+			name:   "one diff",
+			vector: replaceA,
+			want:   JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2")},
+		},
+		{
+			name:   "multiple diffs",
+			vector: bytes.Join([][]byte{replaceA, removeB, insertC}, nil),
+			want: JsonDiffVector{
+				jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2"),
+				jsonDiff(replication.JsonDiffOperationRemove, "$.b", ""),
+				jsonDiff(replication.JsonDiffOperationInsert, "$.c", `"hi"`),
+			},
+		},
+		{
+			name:    "truncated diff after the first",
+			vector:  bytes.Join([][]byte{replaceA, truncated}, nil),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := newPartialUpdateParser(t).Parse(partialUpdateEvent(tt.vector))
+			if err != nil {
+				t.Fatalf("parse rows event: %v", err)
+			}
+			rEv := ev.Event.(*replication.RowsEvent)
+			err = DecodePartialJsonDiffs(ev)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("DecodePartialJsonDiffs() = nil, want error")
+				}
+				if _, ok := rEv.Rows[1][2].(*replication.JsonDiff); !ok {
+					t.Errorf("doc = %T, want the diff of go-mysql left", rEv.Rows[1][2])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodePartialJsonDiffs() error = %v", err)
+			}
+			if rEv.Rows[1][1] != "cd" {
+				t.Errorf("name = %v, want cd", rEv.Rows[1][1])
+			}
+			got, ok := rEv.Rows[1][2].(JsonDiffVector)
+			if !ok {
+				t.Fatalf("doc = %T, want JsonDiffVector", rEv.Rows[1][2])
+			}
+			if got.String() != tt.want.String() {
+				t.Errorf("doc = %s, want %s", got.String(), tt.want.String())
+			}
+		})
+	}
+}
+
+func TestDropPartialJsonRows(t *testing.T) {
+	colDefs := []SQL.NonAliasColumn{
+		SQL.IntColumn("id", SQL.NotNullable),
+		SQL.StrColumn("doc", SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable),
+	}
+	vector := JsonDiffVector{jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2")}
+	undecoded := jsonDiff(replication.JsonDiffOperationReplace, "$.a", "2")
+	tests := []struct {
+		name        string
+		rows        [][]interface{}
+		ifRollback  bool
+		wantDropped int
+		wantIds     []interface{}
+	}{
+		{
+			name:    "resolved documents",
+			rows:    [][]interface{}{{1, `{"a":1}`}, {1, `{"a":2}`}},
+			wantIds: []interface{}{1, 1},
+		},
+		{
+			name:    "diffs whose document is not logged",
+			rows:    [][]interface{}{{1, nil}, {1, vector}},
+			wantIds: []interface{}{1, 1},
+		},
+		{
+			name:        "rollback of diffs whose document is not logged",
+			rows:        [][]interface{}{{1, nil}, {1, vector}, {2, `{"a":1}`}, {2, `{"a":2}`}},
+			ifRollback:  true,
+			wantDropped: 1,
+			wantIds:     []interface{}{2, 2},
+		},
+		{
+			name:        "diffs not all decoded",
+			rows:        [][]interface{}{{1, `{"a":1}`}, {1, undecoded}, {2, nil}, {2, vector}},
+			wantDropped: 1,
+			wantIds:     []interface{}{2, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rEv := &replication.RowsEvent{Rows: tt.rows, SkippedColumns: make([][]int, len(tt.rows))}
+			reason, dropped := DropPartialJsonRows(rEv, tt.ifRollback, colDefs)
+			if dropped != tt.wantDropped {
+				t.Errorf("DropPartialJsonRows() dropped %d, want %d", dropped, tt.wantDropped)
+			}
+			if (reason != "") != (tt.wantDropped > 0) {
+				t.Errorf("DropPartialJsonRows() reason = %q", reason)
+			}
+			if len(rEv.Rows) != len(tt.wantIds) || len(rEv.SkippedColumns) != len(rEv.Rows) {
+				t.Fatalf("rows = %v, skipped columns = %v", rEv.Rows, rEv.SkippedColumns)
+			}
+			for i, id := range tt.wantIds {
+				if rEv.Rows[i][0] != id {
+					t.Errorf("row %d id = %v, want %v", i, rEv.Rows[i][0], id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package base
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// the after image of a json column in a partial update is a Json_diff_vector: a 4 bytes length and the diffs one by one,
+// each diff is the operation, the json path and the value in json binary except for remove.
+// go-mysql decodes only the first diff of the vector and drops the others, so the vectors are read again
+// from the raw event here. every diff is decoded by go-mysql in a rows event with the column alone
+
+// JsonDiffVector is all the diffs of a json column in a partial update, they are applied in order
+type JsonDiffVector []*replication.JsonDiff
+
+func (this JsonDiffVector) String() string {
+	arr := make([]string, len(this))
+	for i, diff := range this {
+		arr[i] = diff.String()
+	}
+	return strings.Join(arr, ", ")
+}
+
+// partialJsonColumn is the diff vector of a json column in a row image, without its length
+type partialJsonColumn struct {
+	rowIdx  int
+	colIdx  int
+	jsonIdx int
+	data    []byte
+}
+
+// DecodePartialJsonDiffs replaces the json diffs decoded by go-mysql in the after images of a partial update rows event
+// with the JsonDiffVector of all the diffs. nothing is replaced if it returns error, the diffs of go-mysql are left,
+// they are incomplete and no sql is generated for them, see DropPartialJsonRows
+func DecodePartialJsonDiffs(ev *replication.BinlogEvent) error {
+	rEv, ok := ev.Event.(*replication.RowsEvent)
+	if !ok || ev.Header.EventType != replication.PARTIAL_UPDATE_ROWS_EVENT {
+		return nil
+	}
+	if len(ev.RawData) < replication.EventHeaderSize {
+		return fmt.Errorf("raw data of the event is not kept")
+	}
+	body := ev.RawData[replication.EventHeaderSize:]
+	header := *rEv
+	pos, err := header.DecodeHeader(body)
+	if err != nil {
+		return err
+	}
+	columns, err := readPartialJsonColumns(rEv, header.ColumnBitmap1, header.ColumnBitmap2, body[pos:])
+	if err != nil {
+		return err
+	}
+	vectors := make([]JsonDiffVector, len(columns))
+	for i, col := range columns {
+		if vectors[i], err = decodeJsonDiffVector(rEv, body[:pos], col); err != nil {
+			return fmt.Errorf("column %d: %v", col.colIdx+1, err)
+		}
+	}
+	for i, col := range columns {
+		rEv.Rows[col.rowIdx][col.colIdx] = vectors[i]
+	}
+	return nil
+}
+
+// readPartialJsonColumns returns the partial json columns in the after images of data, which is the row images of rEv
+func readPartialJsonColumns(rEv *replication.RowsEvent, beforeBitmap []byte, afterBitmap []byte, data []byte) ([]partialJsonColumn, error) {
+	var (
+		columns []partialJsonColumn
+		pos     int
+		colCnt  int                        = int(rEv.ColumnCount)
+		tbMap   *replication.TableMapEvent = rEv.Table
+	)
+	if len(tbMap.ColumnType) < colCnt || len(tbMap.ColumnMeta) < colCnt {
+		return nil, fmt.Errorf("column count %d in rows event > in table map event %d", colCnt, len(tbMap.ColumnType))
+	}
+	for ri := range rEv.Rows {
+		bitmap := beforeBitmap
+		var partialBitmap []byte
+		if ri%2 == 1 {
+			if pos >= len(data) {
+				return nil, fmt.Errorf("row image %d is not in the event", ri)
+			}
+			bitmap = afterBitmap
+			options, _, n := mysql.LengthEncodedInt(data[pos:])
+			pos += n
+			if replication.EnumBinlogRowValueOptions(options)&replication.EnumBinlogRowValueOptionsPartialJsonUpdates != 0 {
+				size := bitmapSize(int(tbMap.JsonColumnCount()))
+				if pos+size > len(data) {
+					return nil, fmt.Errorf("row image %d is truncated", ri)
+				}
+				partialBitmap = data[pos : pos+size]
+				pos += size
+			}
+		}
+		present := 0
+		for ci := 0; ci < colCnt; ci++ {
+			if isBitOn(bitmap, ci) {
+				present++
+			}
+		}
+		nullBitmap := data[pos:]
+		pos += bitmapSize(present)
+		if pos > len(data) {
+			return nil, fmt.Errorf("row image %d is truncated", ri)
+		}
+		jsonIdx, nullIdx := -1, -1
+		for ci := 0; ci < colCnt; ci++ {
+			if tbMap.ColumnType[ci] == mysql.MYSQL_TYPE_JSON {
+				jsonIdx++
+			}
+			if !isBitOn(bitmap, ci) {
+				continue
+			}
+			nullIdx++
+			if isBitOn(nullBitmap, nullIdx) {
+				continue
+			}
+			n, err := columnValueLength(data[pos:], tbMap.ColumnType[ci], tbMap.ColumnMeta[ci])
+			if err != nil {
+				return nil, fmt.Errorf("row image %d column %d: %v", ri, ci+1, err)
+			}
+			if partialBitmap != nil && tbMap.ColumnType[ci] == mysql.MYSQL_TYPE_JSON && isBitOn(partialBitmap, jsonIdx) {
+				meta := int(tbMap.ColumnMeta[ci])
+				columns = append(columns, partialJsonColumn{rowIdx: ri, colIdx: ci, jsonIdx: jsonIdx, data: data[pos+meta : pos+n]})
+			}
+			pos += n
+		}
+	}
+	return columns, nil
+}
+
+// decodeJsonDiffVector splits the diff vector of col into diffs and decodes them one by one.
+// header is the post header of rEv, with the column count and the bitmaps at the end
+func decodeJsonDiffVector(rEv *replication.RowsEvent, header []byte, col partialJsonColumn) (JsonDiffVector, error) {
+	diffs := JsonDiffVector{}
+	data := col.data
+	for len(data) > 0 {
+		// the operation, the path and the value, see Json_diff_vector::read_binary() of mysql
+		n := 1
+		if n >= len(data) {
+			return nil, fmt.Errorf("json diff %d is truncated", len(diffs)+1)
+		}
+		pathLen, _, m := mysql.LengthEncodedInt(data[n:])
+		n += m + int(pathLen)
+		if replication.JsonDiffOperation(data[0]) != replication.JsonDiffOperationRemove {
+			if n >= len(data) {
+				return nil, fmt.Errorf("json diff %d is truncated", len(diffs)+1)
+			}
+			valueLen, _, m := mysql.LengthEncodedInt(data[n:])
+			n += m + int(valueLen)
+		}
+		if n > len(data) {
+			return nil, fmt.Errorf("json diff %d is truncated", len(diffs)+1)
+		}
+		diff, err := decodeJsonDiff(rEv, header, col, data[:n])
+		if err != nil {
+			return nil, fmt.Errorf("json diff %d: %v", len(diffs)+1, err)
+		}
+		diffs = append(diffs, diff)
+		data = data[n:]
+	}
+	return diffs, nil
+}
+
+// decodeJsonDiff decodes one diff by go-mysql, in a partial update rows event of one row
+// in which col is the only column of the after image
+func decodeJsonDiff(rEv *replication.RowsEvent, header []byte, col partialJsonColumn, diff []byte) (*replication.JsonDiff, error) {
+	var (
+		bitmapLen = bitmapSize(int(rEv.ColumnCount))
+		meta      = int(rEv.Table.ColumnMeta[col.colIdx])
+		data      = append([]byte{}, header[:len(header)-2*bitmapLen]...)
+	)
+	// no column in the before image, col in the after image
+	data = append(data, make([]byte, 2*bitmapLen)...)
+	setBitOn(data[len(data)-bitmapLen:], col.colIdx)
+	// binlog_row_value_options, the partial bitmap of the json columns and the null bitmap of the after image
+	data = append(data, byte(replication.EnumBinlogRowValueOptionsPartialJsonUpdates))
+	partialBitmap := make([]byte, bitmapSize(int(rEv.Table.JsonColumnCount())))
+	setBitOn(partialBitmap, col.jsonIdx)
+	data = append(data, partialBitmap...)
+	data = append(data, 0)
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(diff)))
+	data = append(data, length[:meta]...)
+	data = append(data, diff...)
+
+	one := *rEv
+	one.Rows, one.SkippedColumns = nil, nil
+	if err := one.Decode(data); err != nil {
+		return nil, err
+	}
+	if len(one.Rows) != 2 {
+		return nil, fmt.Errorf("%d row images are decoded", len(one.Rows))
+	}
+	v, ok := one.Rows[1][col.colIdx].(*replication.JsonDiff)
+	if !ok {
+		return nil, fmt.Errorf("it is decoded as %T", one.Rows[1][col.colIdx])
+	}
+	return v, nil
+}
+
+// columnValueLength returns the bytes of the column value at the start of data in a row image,
+// like RowsEvent.decodeValue of go-mysql
+func columnValueLength(data []byte, tp byte, meta uint16) (int, error) {
+	length := 0
+	if tp == mysql.MYSQL_TYPE_STRING {
+		if meta >= 256 {
+			b0, b1 := uint8(meta>>8), uint8(meta&0xFF)
+			if b0&0x30 != 0x30 {
+				length = int(uint16(b1) | (uint16((b0&0x30)^0x30) << 4))
+				tp = b0 | 0x30
+			} else {
+				length = int(meta & 0xFF)
+				tp = b0
+			}
+		} else {
+			length = int(meta)
+		}
+	}
+	n := 0
+	switch tp {
+	case mysql.MYSQL_TYPE_NULL:
+		return 0, nil
+	case mysql.MYSQL_TYPE_TINY, mysql.MYSQL_TYPE_YEAR:
+		n = 1
+	case mysql.MYSQL_TYPE_SHORT:
+		n = 2
+	case mysql.MYSQL_TYPE_INT24, mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_TIME:
+		n = 3
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_FLOAT, mysql.MYSQL_TYPE_TIMESTAMP:
+		n = 4
+	case mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_DOUBLE, mysql.MYSQL_TYPE_DATETIME:
+		n = 8
+	case mysql.MYSQL_TYPE_NEWDECIMAL:
+		n = decimalBinSize(int(meta>>8), int(meta&0xFF))
+	case mysql.MYSQL_TYPE_BIT:
+		n = int((meta>>8)*8+meta&0xFF+7) / 8
+	case mysql.MYSQL_TYPE_TIMESTAMP2:
+		n = 4 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_DATETIME2:
+		n = 5 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_TIME2:
+		n = 3 + int(meta+1)/2
+	case mysql.MYSQL_TYPE_ENUM, mysql.MYSQL_TYPE_SET:
+		n = int(meta & 0xFF)
+	case mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_GEOMETRY, mysql.MYSQL_TYPE_VECTOR, mysql.MYSQL_TYPE_JSON:
+		return lengthPrefixedSize(data, int(meta))
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if meta < 256 {
+			return lengthPrefixedSize(data, 1)
+		}
+		return lengthPrefixedSize(data, 2)
+	case mysql.MYSQL_TYPE_STRING:
+		if length < 256 {
+			return lengthPrefixedSize(data, 1)
+		}
+		return lengthPrefixedSize(data, 2)
+	default:
+		return 0, fmt.Errorf("unknown column type %d", tp)
+	}
+	if n > len(data) {
+		return 0, fmt.Errorf("value is truncated")
+	}
+	return n, nil
+}
+
+// lengthPrefixedSize returns the bytes of the value after its length of prefix bytes
+func lengthPrefixedSize(data []byte, prefix int) (int, error) {
+	if prefix < 1 || prefix > 4 || prefix > len(data) {
+		return 0, fmt.Errorf("invalid length of %d bytes", prefix)
+	}
+	n := prefix + int(mysql.FixedLengthInt(data[:prefix]))
+	if n > len(data) {
+		return 0, fmt.Errorf("value is truncated")
+	}
+	return n, nil
+}
+
+// decimalBinSize returns the bytes of a decimal in binlog, 9 digits are stored in 4 bytes
+func decimalBinSize(precision int, scale int) int {
+	digitBytes := []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+	integral := precision - scale
+	return integral/9*4 + digitBytes[integral%9] + scale/9*4 + digitBytes[scale%9]
+}
+
+func bitmapSize(bits int) int {
+	return (bits + 7) / 8
+}
+
+func isBitOn(bitmap []byte, i int) bool {
+	return i>>3 < len(bitmap) && bitmap[i>>3]&(1<<(uint(i)&7)) != 0
+}
+
+func setBitOn(bitmap []byte, i int) {
+	bitmap[i>>3] |= 1 << (uint(i) & 7)
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	toolkits "my-wails-app/pkg/my2sql/toolkits"
 	"strings"
+	"sync"
 
+	"github.com/go-mysql-org/go-mysql/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/juju/errors"
 	"github.com/siddontang/go-log/log"
@@ -19,10 +21,6 @@ const (
 	KEY_NONE_BINLOG    = "_"
 )
 
-var (
-	G_TablesColumnsInfo TablesColumnsInfo
-)
-
 type DdlPosInfo struct {
 	Binlog   string `json:"binlog"`
 	StartPos uint32 `json:"start_position"`
@@ -39,6 +37,23 @@ type FieldInfo struct {
 	FieldName  string `json:"column_name"`
 	FieldType  string `json:"column_type"`
 	IsUnsigned bool   `json:"is_unsigned"`
+	// labels of enum or set, in the order of the definition
+	EnumSetValues []string `json:"enum_set_values,omitempty"`
+	// charset of char, varchar, text, enum and set, see ConvertCharsetValue
+	Charset string `json:"charset,omitempty"`
+	// generated columns are logged in rows events, but they can not be inserted or updated
+	IsGenerated bool `json:"is_generated,omitempty"`
+	IsVirtual   bool `json:"is_virtual,omitempty"` // VIRTUAL generated column, the others are STORED
+	IsInvisible bool `json:"is_invisible,omitempty"`
+}
+
+// SetExtra sets the attributes of the column in Extra of SHOW COLUMNS, ex: VIRTUAL GENERATED, STORED GENERATED, INVISIBLE.
+// DEFAULT_GENERATED is the column with a default expression, it is not a generated column
+func (this *FieldInfo) SetExtra(extra string) {
+	extra = strings.ToUpper(extra)
+	this.IsVirtual = strings.Contains(extra, "VIRTUAL GENERATED")
+	this.IsGenerated = this.IsVirtual || strings.Contains(extra, "STORED GENERATED")
+	this.IsInvisible = strings.Contains(extra, "INVISIBLE")
 }
 
 type TblInfoJson struct {
@@ -47,12 +62,36 @@ type TblInfoJson struct {
 	Columns    []FieldInfo `json:"columns"`
 	PrimaryKey KeyInfo     `json:"primary_key"`
 	UniqueKeys []KeyInfo   `json:"unique_keys"`
-	//	DdlInfo    DdlPosInfo  `json:"ddl_info"`
+	// names of UniqueKeys, to apply drop index
+	UniqueKeyNames []string `json:"unique_key_names,omitempty"`
+	// the ddl this version is created by, nil for the snapshot
+	DdlInfo *DdlPosInfo `json:"ddl_info,omitempty"`
+	// the ddl after the snapshot which can not be undone from the definition in mysql, see snapshotTable
+	notUndone *DdlPosInfo
+	// taken from the table map event, binlog_row_metadata=FULL
+	FromTableMap bool `json:"-"`
+	// default charset of the table, for the columns added by ddl without charset
+	Charset string `json:"charset,omitempty"`
 }
 
+// TablesColumnsInfo is shared by the binlog reader and the workers, the maps are guarded by lock
 type TablesColumnsInfo struct {
-	//lock       *sync.RWMutex
-	tableInfos map[string]*TblInfoJson //{db.tb:TblInfoJson}}
+	lock       sync.RWMutex
+	tableInfos map[string]*TblInfoJson   //{db.tb:TblInfoJson}}, the current version
+	history    map[string][]*TblInfoJson //{db.tb:[TblInfoJson]}, all the versions from the oldest
+	dropped    map[string]*DdlPosInfo    //{db.tb:DdlPosInfo}, the tables dropped or renamed away by ddl
+	// the ddls after the events read so far, found by reading the binlogs ahead, in the order of the binlogs
+	pendingDdls []*pendingDdl
+	// {db.tb:tableMapInfo}, the definition in the last table map event of the table
+	tableMapInfos map[string]*tableMapInfo
+	// {db.tb:tableDefFetch}, the tables taken from mysql when they are met, each one is fetched only once
+	fetches map[string]*tableDefFetch
+}
+
+// tableDefFetch is the fetch of a table definition from mysql, done is closed when it finishes
+type tableDefFetch struct {
+	done chan struct{}
+	err  error
 }
 
 type column struct {
@@ -79,6 +118,25 @@ func GetMysqlUrl(cfg *ConfCmd) string {
 
 }
 
+// GetGeographicSrids returns the SRIDs of the geographic spatial reference systems of mysql 8.0,
+// it returns error for mysql 5.7 and mariadb which have no ST_SPATIAL_REFERENCE_SYSTEMS
+func GetGeographicSrids(db *sql.DB) (map[uint32]bool, error) {
+	rows, err := db.Query("SELECT SRS_ID FROM information_schema.ST_SPATIAL_REFERENCE_SYSTEMS WHERE DEFINITION LIKE 'GEOGCS%'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	srids := map[uint32]bool{}
+	for rows.Next() {
+		var srid uint32
+		if err = rows.Scan(&srid); err != nil {
+			return nil, err
+		}
+		srids[srid] = true
+	}
+	return srids, rows.Err()
+}
+
 func CreateMysqlCon(mysqlUrl string) (*sql.DB, error) {
 	db, err := sql.Open("mysql", mysqlUrl)
 
@@ -101,19 +159,23 @@ func CreateMysqlCon(mysqlUrl string) (*sql.DB, error) {
 	return db, nil
 }
 
-func (this *TablesColumnsInfo) GetTbDefFromDb(cfg *ConfCmd, dbname string, tbname string) {
+// GetTbDefFromDb queries the definition of the table from mysql, nil if the table does not exist.
+// the result is not cached, see GetTableInfoJson
+func (this *TablesColumnsInfo) GetTbDefFromDb(cfg *ConfCmd, dbname string, tbname string) (*TblInfoJson, error) {
 	//get table columns from DB
-	var err error
-	if cfg.FromDB == nil {
-		sqlUrl := GetMysqlUrl(cfg)
-		cfg.FromDB, err = CreateMysqlCon(sqlUrl)
-		if err != nil {
-			log.Fatalf("fail to connect to mysql %v", err)
-		}
+	db, err := cfg.GetFromDB()
+	if err != nil {
+		return nil, err
 	}
 
-	this.GetTableColumns(cfg.FromDB, dbname, tbname)
-	this.GetTableKeysInfo(cfg.FromDB, dbname, tbname)
+	// filled without lock, only this call sees it
+	tbDefs := &TablesColumnsInfo{}
+	if err = tbDefs.GetTableColumns(db, dbname, tbname); err != nil {
+		// the table may be dropped, GetTableInfoJson reports it as not found
+		return nil, nil
+	}
+	tbDefs.GetTableKeysInfo(db, dbname, tbname)
+	return tbDefs.tableInfos[GetAbsTableName(dbname, tbname)], nil
 }
 
 func (this *TablesColumnsInfo) GetTableKeysInfo(db *sql.DB, dbName string, tbName string) error {
@@ -218,6 +280,7 @@ func (this *TablesColumnsInfo) GetTableKeysInfo(db *sql.DB, dbName string, tbNam
 	}
 	this.tableInfos[tbKey].PrimaryKey = KeyInfo{}
 	this.tableInfos[tbKey].UniqueKeys = []KeyInfo{}
+	this.tableInfos[tbKey].UniqueKeyNames = []string{}
 	for kname, kcolumn := range dbTbKeysInfo[dbName][tbName] {
 		isPrimay = false
 		_, ok = primaryKeys[dbName]
@@ -234,6 +297,7 @@ func (this *TablesColumnsInfo) GetTableKeysInfo(db *sql.DB, dbName string, tbNam
 			this.tableInfos[tbKey].PrimaryKey = kcolumn
 		} else {
 			this.tableInfos[tbKey].UniqueKeys = append(this.tableInfos[tbKey].UniqueKeys, kcolumn)
+			this.tableInfos[tbKey].UniqueKeyNames = append(this.tableInfos[tbKey].UniqueKeyNames, kname)
 		}
 	}
 	return nil
@@ -250,7 +314,8 @@ func (this *TablesColumnsInfo) GetTableColumns(db *sql.DB, dbname string, tbname
 		return errors.New(er)
 	}
 
-	query := fmt.Sprintf("SHOW COLUMNS FROM `%s`.`%s`", dbname, tbname)
+	// SHOW FULL COLUMNS has Collation after Type
+	query := fmt.Sprintf("SHOW FULL COLUMNS FROM `%s`.`%s`", dbname, tbname)
 	rows, err := db.Query(query)
 	if err != nil {
 		log.Errorf("%v fail to query mysql: "+query, err)
@@ -294,29 +359,219 @@ func (this *TablesColumnsInfo) GetTableColumns(db *sql.DB, dbname string, tbname
 		if !ok {
 			dbTbFieldsInfo[tbKey] = []FieldInfo{}
 		}
-		dbTbFieldsInfo[tbKey] = append(dbTbFieldsInfo[tbKey], FieldInfo{FieldName: string(data[0]), FieldType: GetFiledType(string(data[1])), IsUnsigned: IsUnsigned(string(data[1]))})
+		f := FieldInfo{FieldName: string(data[0]), FieldType: GetFiledType(string(data[1])),
+			IsUnsigned: IsUnsigned(string(data[1])), EnumSetValues: GetEnumSetValues(string(data[1])), Charset: GetCharsetOfCollation(string(data[2]))}
+		if len(data) > 6 {
+			// Extra
+			f.SetExtra(string(data[6]))
+		}
+		dbTbFieldsInfo[tbKey] = append(dbTbFieldsInfo[tbKey], f)
 	}
 	if len(this.tableInfos) < 1 {
 		this.tableInfos = map[string]*TblInfoJson{}
 	}
-	this.tableInfos[tbKey] = &TblInfoJson{Database: dbname, Table: tbname, Columns: dbTbFieldsInfo[tbKey]}
+	tb := &TblInfoJson{Database: dbname, Table: tbname, Columns: dbTbFieldsInfo[tbKey]}
+	// the default charset of the table is for the columns added by ddl without a charset
+	var collation string
+	if db.QueryRow("SELECT IFNULL(TABLE_COLLATION, '') FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		dbname, tbname).Scan(&collation) == nil {
+		tb.Charset = GetCharsetOfCollation(collation)
+	}
+	this.tableInfos[tbKey] = tb
 	return nil
 
 }
 
-func (this *TablesColumnsInfo) GetTableInfoJson(schema string, table string) (*TblInfoJson, error) {
+// the columns and the unique keys of the base tables of a database, the columns go before the keys of each table
+const preloadTableDefsSql = "SELECT 'C' AS kind, c.TABLE_NAME AS tb, c.COLUMN_NAME AS col, c.COLUMN_TYPE AS col_type, c.ORDINAL_POSITION AS seq, '' AS idx," +
+	" IFNULL(c.CHARACTER_SET_NAME, '') AS cs, IFNULL(t.TABLE_COLLATION, '') AS tb_collation, c.EXTRA AS extra" +
+	" FROM information_schema.COLUMNS c JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME" +
+	" WHERE c.TABLE_SCHEMA = ? AND t.TABLE_TYPE = 'BASE TABLE'" +
+	" UNION ALL SELECT 'K', TABLE_NAME, COLUMN_NAME, '', SEQ_IN_INDEX, INDEX_NAME, '', '', ''" +
+	" FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = ? AND NON_UNIQUE = 0" +
+	" ORDER BY tb, kind, idx, seq"
+
+// PreloadTableDefs takes the definitions of the selected tables of databases from information_schema, one query for each database,
+// it returns the count of the tables loaded. the tables already known or changed by the ddls read ahead are not loaded,
+// they are fetched when they are met
+func (this *TablesColumnsInfo) PreloadTableDefs(cfg *ConfCmd, databases []string) (int, error) {
+	if len(databases) == 0 {
+		return 0, nil
+	}
+	db, err := cfg.GetFromDB()
+	if err != nil {
+		return 0, err
+	}
+	var cnt int
+	for _, dbName := range databases {
+		defs, err := queryDatabaseTableDefs(db, dbName)
+		if err != nil {
+			return cnt, err
+		}
+		this.lock.Lock()
+		for _, tb := range defs {
+			tbKey := GetAbsTableName(tb.Database, tb.Table)
+			if !cfg.IsTargetTable(tb.Database, tb.Table) {
+				continue
+			}
+			if _, ok := this.tableInfos[tbKey]; ok {
+				continue
+			}
+			if _, dropped := this.dropped[tbKey]; dropped {
+				continue
+			}
+			if this.isChangedByPendingDdls(tbKey) {
+				// the definition at the position is made from it when the table is met, see snapshotTable
+				continue
+			}
+			this.setTableVersion(tbKey, tb)
+			cnt++
+		}
+		this.lock.Unlock()
+	}
+	log.Infof("definitions of %d tables are preloaded from information_schema", cnt)
+	return cnt, nil
+}
+
+// queryDatabaseTableDefs returns the definitions of the base tables of dbName.
+// the unique keys with an expression part(functional key parts of mysql 8.0.13+) are skipped
+func queryDatabaseTableDefs(db *sql.DB, dbName string) ([]*TblInfoJson, error) {
+	rows, err := db.Query(preloadTableDefsSql, dbName, dbName)
+	if err != nil {
+		return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to query table definitions of %s %v", dbName, err)
+	}
+	defer rows.Close()
+
+	var (
+		defs    []*TblInfoJson
+		tables  map[string]*TblInfoJson = map[string]*TblInfoJson{}
+		keyTb   *TblInfoJson
+		keyName string
+		key     KeyInfo
+		skipKey bool
+	)
+	addKey := func() {
+		if keyTb == nil || skipKey || len(key) == 0 {
+			return
+		}
+		if keyName == "PRIMARY" {
+			keyTb.PrimaryKey = key
+		} else {
+			keyTb.UniqueKeys = append(keyTb.UniqueKeys, key)
+			keyTb.UniqueKeyNames = append(keyTb.UniqueKeyNames, keyName)
+		}
+	}
+	for rows.Next() {
+		var (
+			kind, tbName, colType, idxName, cs, tbCollation, extra string
+			colName                                                sql.NullString
+			seq                                                    int
+		)
+		if err = rows.Scan(&kind, &tbName, &colName, &colType, &seq, &idxName, &cs, &tbCollation, &extra); err != nil {
+			return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to query table definitions of %s %v", dbName, err)
+		}
+		tb, ok := tables[tbName]
+		if !ok {
+			tb = &TblInfoJson{Database: dbName, Table: tbName, Columns: []FieldInfo{},
+				PrimaryKey: KeyInfo{}, UniqueKeys: []KeyInfo{}, UniqueKeyNames: []string{}}
+			tables[tbName] = tb
+			defs = append(defs, tb)
+		}
+		if kind == "C" {
+			f := FieldInfo{FieldName: colName.String, FieldType: GetFiledType(colType),
+				IsUnsigned: IsUnsigned(colType), EnumSetValues: GetEnumSetValues(colType), Charset: cs}
+			f.SetExtra(extra)
+			tb.Columns = append(tb.Columns, f)
+			tb.Charset = GetCharsetOfCollation(tbCollation)
+			continue
+		}
+		if tb != keyTb || idxName != keyName {
+			addKey()
+			keyTb, keyName, key, skipKey = tb, idxName, KeyInfo{}, false
+		}
+		if !colName.Valid {
+			skipKey = true
+			continue
+		}
+		key = append(key, colName.String)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to query table definitions of %s %v", dbName, err)
+	}
+	addKey()
+
+	// the tables only met in the keys are not base tables
+	tbDefs := defs[:0]
+	for _, tb := range defs {
+		if len(tb.Columns) > 0 {
+			tbDefs = append(tbDefs, tb)
+		}
+	}
+	return tbDefs, nil
+}
+
+// GetTableInfoJson returns the current definition of the table, it is taken from mysql if the table is not known.
+// it is safe to call from the reader and the workers at the same time, a missing table is fetched only once
+func (this *TablesColumnsInfo) GetTableInfoJson(cfg *ConfCmd, schema string, table string) (*TblInfoJson, error) {
 	tbKey := GetAbsTableName(schema, table)
+	this.lock.RLock()
 	tbDefsJson, ok := this.tableInfos[tbKey]
-	if !ok {
-		this.GetTbDefFromDb(GConfCmd, schema, table)
-		tbDefsJson, ok = this.tableInfos[tbKey]
-		if !ok {
-			return &TblInfoJson{}, fmt.Errorf("table struct not found for %s, maybe it was dropped. Skip it", tbKey)
+	this.lock.RUnlock()
+	if ok {
+		return tbDefsJson, nil
+	}
+
+	this.lock.Lock()
+	if tbDefsJson, ok = this.tableInfos[tbKey]; ok {
+		this.lock.Unlock()
+		return tbDefsJson, nil
+	}
+	if ddlInfo, dropped := this.dropped[tbKey]; dropped {
+		this.lock.Unlock()
+		return &TblInfoJson{}, NewEngineError(ErrCategorySchema, mysql.Position{},
+			"table %s was dropped or renamed at %s/%d by: %s", tbKey, ddlInfo.Binlog, ddlInfo.StartPos, ddlInfo.DdlSql)
+	}
+	if cfg.OnlyColFromFile {
+		this.lock.Unlock()
+		return &TblInfoJson{}, NewEngineError(ErrCategorySchema, mysql.Position{},
+			"table struct not found for %s in %s, -only-col-from-file is set", tbKey, cfg.ReadTblDefJsonFile)
+	}
+	fetch, fetching := this.fetches[tbKey]
+	if !fetching {
+		fetch = &tableDefFetch{done: make(chan struct{})}
+		if this.fetches == nil {
+			this.fetches = map[string]*tableDefFetch{}
 		}
+		this.fetches[tbKey] = fetch
+	}
+	this.lock.Unlock()
+
+	if !fetching {
+		this.fetchTableDef(cfg, schema, table, fetch)
+	}
+	<-fetch.done
+	if fetch.err != nil {
+		return &TblInfoJson{}, fetch.err
+	}
+	this.lock.RLock()
+	tbDefsJson, ok = this.tableInfos[tbKey]
+	this.lock.RUnlock()
+	if !ok {
+		// dropped by a ddl after it is fetched
+		return this.GetTableInfoJson(cfg, schema, table)
 	}
 	return tbDefsJson, nil
 }
 
+// fetchTableDef takes the definition of the table from mysql as its snapshot, the error is kept in fetch
+func (this *TablesColumnsInfo) fetchTableDef(cfg *ConfCmd, schema string, table string, fetch *tableDefFetch) {
+	defer close(fetch.done)
+	_, fetch.err = this.snapshotTable(GetAbsTableName(schema, table), func(schema string, table string) (*TblInfoJson, error) {
+		// the definition in mysql, it may be of the name the table is renamed to by the ddls after
+		return this.GetTbDefFromDb(cfg, schema, table)
+	})
+}
+
 func (this *TblInfoJson) GetOneUniqueKey(uniqueFirst bool) KeyInfo {
 	if uniqueFirst {
 		if len(this.UniqueKeys) > 0 {
@@ -332,6 +587,17 @@ func (this *TblInfoJson) GetOneUniqueKey(uniqueFirst bool) KeyInfo {
 	}
 }
 
+// GetGeneratedColIndex returns the indexes of the generated columns, they are left out of INSERT and UPDATE SET
+func GetGeneratedColIndex(columns []FieldInfo) []int {
+	arr := []int{}
+	for i, f := range columns {
+		if f.IsGenerated {
+			arr = append(arr, i)
+		}
+	}
+	return arr
+}
+
 func GetColIndexFromKey(ki KeyInfo, columns []FieldInfo) []int {
 	arr := make([]int, len(ki))
 	for j, colName := range ki {
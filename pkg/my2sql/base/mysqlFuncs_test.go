@@ -0,0 +1,101 @@
+package base
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetTableInfoJsonFetchOnce(t *testing.T) {
+	fake := fakeMysqlOfT1()
+	// the fetch is slow enough that the goroutines meet the table missing at the same time
+	fake.delay = 20 * time.Millisecond
+	cfg := &ConfCmd{FromDB: fake.open()}
+	tc := &TablesColumnsInfo{}
+
+	const n = 50
+	var (
+		wg     sync.WaitGroup
+		tables = make([]*TblInfoJson, n)
+		errs   = make([]error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tables[i], errs[i] = tc.GetTableInfoJson(cfg, "db", "t1")
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		if errs[i] != nil || tables[i] != tables[0] {
+			t.Fatalf("GetTableInfoJson() #%d = %p, %v, want the definition fetched once %p", i, tables[i], errs[i], tables[0])
+		}
+	}
+	if cnt := fake.queried("SHOW FULL COLUMNS FROM `db`.`t1`"); cnt != 1 {
+		t.Errorf("SHOW FULL COLUMNS is queried %d times, want 1", cnt)
+	}
+	if len(tables[0].Columns) != 2 || !reflect.DeepEqual(tables[0].PrimaryKey, KeyInfo{"id"}) {
+		t.Errorf("GetTableInfoJson() = %+v", tables[0])
+	}
+}
+
+func TestQueryDatabaseTableDefs(t *testing.T) {
+	fake := &fakeDB{results: map[string]fakeResult{
+		preloadTableDefsSql: {columns: preloadColumns, rows: [][]driver.Value{
+			{"C", "t1", "id", "int(10) unsigned", "1", "", "", "latin1_swedish_ci", ""},
+			{"C", "t1", "a", "varchar(20)", "2", "", "utf8mb4", "latin1_swedish_ci", ""},
+			{"C", "t1", "b", "int", "3", "", "", "latin1_swedish_ci", "VIRTUAL GENERATED"},
+			{"K", "t1", "id", "", "1", "PRIMARY", "", "", ""},
+			{"K", "t1", "a", "", "1", "uk_ab", "", "", ""},
+			{"K", "t1", "b", "", "2", "uk_ab", "", "", ""},
+			// a functional key part has no column
+			{"K", "t1", nil, "", "1", "uk_expr", "", "", ""},
+			{"K", "t1", "b", "", "2", "uk_expr", "", "", ""},
+			{"K", "t1", "b", "", "1", "uk_b", "", "", ""},
+			{"C", "t2", "a", "bigint", "1", "", "", "utf8mb4_0900_ai_ci", ""},
+			// a table only in the keys is not a base table
+			{"K", "v1", "a", "", "1", "PRIMARY", "", "", ""}}},
+	}}
+
+	defs, err := queryDatabaseTableDefs(fake.open(), "db")
+	if err != nil {
+		t.Fatalf("queryDatabaseTableDefs() error = %v", err)
+	}
+	want := []*TblInfoJson{
+		{Database: "db", Table: "t1",
+			Columns: []FieldInfo{{FieldName: "id", FieldType: "int", IsUnsigned: true}, {FieldName: "a", FieldType: "varchar", Charset: "utf8mb4"},
+				{FieldName: "b", FieldType: "int", IsGenerated: true, IsVirtual: true}},
+			PrimaryKey: KeyInfo{"id"}, UniqueKeys: []KeyInfo{{"a", "b"}, {"b"}}, UniqueKeyNames: []string{"uk_ab", "uk_b"}, Charset: "latin1"},
+		{Database: "db", Table: "t2", Columns: []FieldInfo{{FieldName: "a", FieldType: "bigint"}},
+			PrimaryKey: KeyInfo{}, UniqueKeys: []KeyInfo{}, UniqueKeyNames: []string{}, Charset: "utf8mb4"},
+	}
+	if !reflect.DeepEqual(defs, want) {
+		t.Errorf("queryDatabaseTableDefs() =")
+		for _, tb := range defs {
+			t.Errorf("  %+v", tb)
+		}
+	}
+}
+
+func TestPreloadTableDefs(t *testing.T) {
+	fake := fakeMysqlOfT1()
+	cfg := &ConfCmd{FromDB: fake.open()}
+
+	tc := &TablesColumnsInfo{}
+	if cnt, err := tc.PreloadTableDefs(cfg, []string{"db"}); err != nil || cnt != 1 {
+		t.Fatalf("PreloadTableDefs() = %d, %v, want 1 table", cnt, err)
+	}
+	if _, err := tc.GetTableInfoJson(cfg, "db", "t1"); err != nil || fake.queried("SHOW FULL COLUMNS") != 0 {
+		t.Errorf("GetTableInfoJson() of a preloaded table = %v, queries %v", err, fake.queried("SHOW FULL COLUMNS"))
+	}
+
+	// the definition in mysql is after the ddl read ahead, it is not the one at the start position
+	tc = &TablesColumnsInfo{}
+	addPendingDdls(tc, "ALTER TABLE t1 ADD COLUMN c int")
+	if cnt, err := tc.PreloadTableDefs(cfg, []string{"db"}); err != nil || cnt != 0 {
+		t.Errorf("PreloadTableDefs() with a ddl read ahead = %d, %v, want no table", cnt, err)
+	}
+}
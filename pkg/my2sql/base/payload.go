@@ -0,0 +1,86 @@
+package base
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/klauspost/compress/zstd"
+)
+
+// go-mysql decodes the events compressed in a transaction payload event with a parser of its own, which has the
+// default options: TIMESTAMP in the local time zone and DECIMAL as float64. the payload is decoded again by the parser
+// of the job here, the events in it have no checksum, so the parser takes the format description without it
+
+// NewJobBinlogParser returns the parser of the binlog files of the job: datetime/time columns are kept as strings,
+// decimal as decimal.Decimal for the exact values, TIMESTAMP columns are written in the time zone of the job
+func NewJobBinlogParser(cfg *ConfCmd) *replication.BinlogParser {
+	parser := replication.NewBinlogParser()
+	// donot parse mysql datetime/time column into go time structure, take it as string
+	parser.SetParseTime(false)
+	parser.SetUseDecimal(true)
+	parser.SetTimestampStringLocation(cfg.BinlogTimeLoc)
+	return parser
+}
+
+// SetPayloadFormat takes the format description event of the binlog for the transaction payload events after it
+func (this *ConfCmd) SetPayloadFormat(fde *replication.FormatDescriptionEvent) error {
+	if this.payloadParser == nil {
+		this.payloadParser = NewJobBinlogParser(this)
+	}
+	// post header: binlog version, server version, create timestamp, header length, post header lengths,
+	// then the checksum algorithm and the checksum
+	body := make([]byte, 2+50+4+1, 2+50+4+1+len(fde.EventTypeHeaderLengths)+1+replication.BinlogChecksumLength)
+	binary.LittleEndian.PutUint16(body, fde.Version)
+	copy(body[2:52], fde.ServerVersion)
+	binary.LittleEndian.PutUint32(body[52:], fde.CreateTimestamp)
+	body[56] = fde.EventHeaderLength
+	body = append(body, fde.EventTypeHeaderLengths...)
+	body = append(body, replication.BINLOG_CHECKSUM_ALG_OFF, 0, 0, 0, 0)
+
+	data := make([]byte, replication.EventHeaderSize, replication.EventHeaderSize+len(body))
+	data[4] = byte(replication.FORMAT_DESCRIPTION_EVENT)
+	binary.LittleEndian.PutUint32(data[9:], uint32(replication.EventHeaderSize+len(body)))
+	data = append(data, body...)
+	_, err := this.payloadParser.Parse(data)
+	return err
+}
+
+// decodePayloadEvents returns the events compressed in the transaction payload event, decoded as the other events of the job
+func (this *ConfCmd) decodePayloadEvents(payloadEvent *replication.TransactionPayloadEvent) ([]*replication.BinlogEvent, error) {
+	if this.payloadParser == nil {
+		return nil, fmt.Errorf("no format description event before the transaction payload event")
+	}
+	payload := payloadEvent.Payload
+	if payloadEvent.CompressionType == replication.ZSTD {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		if payload, err = decoder.DecodeAll(payloadEvent.Payload, nil); err != nil {
+			return nil, err
+		}
+	} else if payloadEvent.CompressionType != replication.NONE {
+		return nil, fmt.Errorf("unknown compression type %d of the transaction payload", payloadEvent.CompressionType)
+	}
+
+	var events []*replication.BinlogEvent
+	for offset := 0; offset < len(payload); {
+		size := 0
+		if offset+replication.EventHeaderSize <= len(payload) {
+			size = int(binary.LittleEndian.Uint32(payload[offset+9:]))
+		}
+		if size < replication.EventHeaderSize || offset+size > len(payload) {
+			return nil, fmt.Errorf("broken event at %d of the transaction payload of %d bytes", offset, len(payload))
+		}
+		ev, err := this.payloadParser.Parse(payload[offset : offset+size])
+		if err != nil {
+			return nil, err
+		}
+		ev.RawData = []byte{} // we donnot need raw data
+		events = append(events, ev)
+		offset += size
+	}
+	return events, nil
+}
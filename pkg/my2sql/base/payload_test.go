@@ -0,0 +1,145 @@
+package base
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/shopspring/decimal"
+)
+
+// testFormatDescription is the format description of a binlog of mysql 8.0 with checksum
+func testFormatDescription() *replication.FormatDescriptionEvent {
+	lengths := make([]byte, replication.PARTIAL_UPDATE_ROWS_EVENT)
+	lengths[replication.QUERY_EVENT-1] = 13
+	lengths[replication.TABLE_MAP_EVENT-1] = 8
+	lengths[replication.WRITE_ROWS_EVENTv2-1] = 10
+	return &replication.FormatDescriptionEvent{Version: 4, ServerVersion: "8.0.36", EventHeaderLength: replication.EventHeaderSize,
+		EventTypeHeaderLengths: lengths, ChecksumAlgorithm: replication.BINLOG_CHECKSUM_ALG_CRC32}
+}
+
+// eventData returns the event of body without checksum, as the events in a transaction payload
+func eventData(tp replication.EventType, logPos uint32, body []byte) []byte {
+	data := make([]byte, replication.EventHeaderSize, replication.EventHeaderSize+len(body))
+	data[4] = byte(tp)
+	binary.LittleEndian.PutUint32(data[5:], 1)
+	binary.LittleEndian.PutUint32(data[9:], uint32(replication.EventHeaderSize+len(body)))
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	return append(data, body...)
+}
+
+// payloadData returns the events of a transaction inserting into db.tb(id int, ts timestamp(3), amount decimal(5,2))
+// the row (1, 1700000000.123 in unix time, 123.45)
+func payloadData() []byte {
+	query := []byte{0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0}
+	query = append(query, "db\x00BEGIN"...)
+
+	tbMap := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2}
+	tbMap = append(tbMap, "db\x00\x02tb\x00"...)
+	tbMap = append(tbMap, 3, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_TIMESTAMP2, mysql.MYSQL_TYPE_NEWDECIMAL)
+	// metadata: fsp of timestamp, precision and scale of decimal, then the null bitmap
+	tbMap = append(tbMap, 3, 3, 5, 2, 0x06)
+
+	rows := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 3, 0x07, 0x00}
+	rows = binary.LittleEndian.AppendUint32(rows, 1)
+	rows = binary.BigEndian.AppendUint32(rows, 1700000000)
+	rows = binary.BigEndian.AppendUint16(rows, 1230)
+	rows = append(rows, 0x80, 0x7b, 0x2d)
+
+	var data []byte
+	data = append(data, eventData(replication.QUERY_EVENT, 90, query)...)
+	data = append(data, eventData(replication.TABLE_MAP_EVENT, 130, tbMap)...)
+	data = append(data, eventData(replication.WRITE_ROWS_EVENTv2, 180, rows)...)
+	data = append(data, eventData(replication.XID_EVENT, 211, make([]byte, 8))...)
+	return data
+}
+
+// payloadEvent returns a transaction payload event ending at 1000 of 300 bytes, the events of payloadData are compressed in it
+func payloadEvent(t *testing.T) *replication.BinlogEvent {
+	return &replication.BinlogEvent{
+		Header: &replication.EventHeader{EventType: replication.TRANSACTION_PAYLOAD_EVENT, Timestamp: 1700000000, LogPos: 1000, EventSize: 300},
+		Event:  &replication.TransactionPayloadEvent{CompressionType: replication.ZSTD, Payload: zstdBytes(t, payloadData())},
+	}
+}
+
+func TestDecodePayloadEvents(t *testing.T) {
+	// go-mysql decodes the payload in the local time zone and the decimals as float64
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	tests := []struct {
+		name     string
+		noFormat bool
+		payload  *replication.TransactionPayloadEvent
+		wantRow  []interface{}
+		wantErr  bool
+	}{
+		{
+			name:    "zstd",
+			payload: payloadEvent(t).Event.(*replication.TransactionPayloadEvent),
+			wantRow: []interface{}{int32(1), "2023-11-15 07:13:20.123", decimal.RequireFromString("123.45")},
+		},
+		{
+			name:    "not compressed",
+			payload: &replication.TransactionPayloadEvent{CompressionType: replication.NONE, Payload: payloadData()},
+			wantRow: []interface{}{int32(1), "2023-11-15 07:13:20.123", decimal.RequireFromString("123.45")},
+		},
+		{name: "no format description", noFormat: true, payload: payloadEvent(t).Event.(*replication.TransactionPayloadEvent), wantErr: true},
+		{
+			name:    "truncated",
+			payload: &replication.TransactionPayloadEvent{CompressionType: replication.NONE, Payload: payloadData()[:100]},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ConfCmd{BinlogTimeLoc: tokyo}
+			if !tt.noFormat {
+				if err := cfg.SetPayloadFormat(testFormatDescription()); err != nil {
+					t.Fatalf("SetPayloadFormat() error = %v", err)
+				}
+			}
+			events, err := cfg.decodePayloadEvents(tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodePayloadEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var types []replication.EventType
+			for _, ev := range events {
+				types = append(types, ev.Header.EventType)
+			}
+			wantTypes := []replication.EventType{replication.QUERY_EVENT, replication.TABLE_MAP_EVENT, replication.WRITE_ROWS_EVENTv2, replication.XID_EVENT}
+			if !reflect.DeepEqual(types, wantTypes) {
+				t.Fatalf("events = %v, want %v", types, wantTypes)
+			}
+			rows := events[2].Event.(*replication.RowsEvent).Rows
+			if len(rows) != 1 || !reflect.DeepEqual(rows[0], tt.wantRow) {
+				t.Errorf("rows = %#v, want %#v", rows, tt.wantRow)
+			}
+		})
+	}
+}
+
+func TestDispatchPayloadEventBroken(t *testing.T) {
+	cfg := &ConfCmd{WorkType: "stats", StatChan: make(chan BinEventStats, 10)}
+	if err := cfg.SetPayloadFormat(testFormatDescription()); err != nil {
+		t.Fatal(err)
+	}
+	binlog := "mysql-bin.000001"
+	ev := payloadEvent(t)
+	ev.Event.(*replication.TransactionPayloadEvent).Payload = []byte("not zstd")
+	result, err := cfg.DispatchPayloadEvent(context.Background(), ev, &binlog)
+	var ee *EngineError
+	if result != C_reBreak || !errors.As(err, &ee) || ee.Category != ErrCategoryDecode || ee.Pos.Pos != 1000 {
+		t.Errorf("DispatchPayloadEvent() of a broken payload = %d, %v, want a decode error at 1000", result, err)
+	}
+}
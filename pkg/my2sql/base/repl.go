@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
@@ -13,7 +13,7 @@ import (
 	//"github.com/siddontang/go-log/log"
 )
 
-func ParserAllBinEventsFromRepl(cfg *ConfCmd) {
+func ParserAllBinEventsFromRepl(ctx context.Context, cfg *ConfCmd) error {
 	defer cfg.CloseChan()
 
 	/*
@@ -25,19 +25,45 @@ func ParserAllBinEventsFromRepl(cfg *ConfCmd) {
 			startFile := findStartFile(cfg, files)
 			cfg.StartFile = startFile
 		}*/
-	files, err := getBinlogFiles(cfg)
+	var err error
+	// 指定了 start-gtid 时由 mysql 根据 gtid 定位起始 binlog, 指定了 start-file 时直接从该文件开始,
+	// 否则按开始时间二分查找起始 binlog
+	if cfg.StartGtidSet == nil && !cfg.IfSetStartFilePos {
+		files, err := getBinlogFiles(ctx, cfg)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return NewEngineError(ErrCategoryConnection, mysql.Position{}, "无法获取 Binlog 列表: %v", err)
+		}
+		startFile := findStartFile(ctx, cfg, files)
+		cfg.StartFile = startFile
+	}
+	PrepareTableDefs(ctx, cfg, ScanDdlsFromRepl)
+	cfg.BinlogStreamer, err = NewReplBinlogStreamer(cfg)
 	if err != nil {
-		log.Fatalf("无法获取 Binlog 列表: %v", err)
+		return err
 	}
-	startFile := findStartFile(cfg, files)
-	cfg.StartFile = startFile
-	cfg.BinlogStreamer = NewReplBinlogStreamer(cfg)
+	// closing the syncer also closes the replication connection to mysql
+	defer cfg.BinlogSyncer.Close()
 	log.Println("start to get binlog from mysql")
-	SendBinlogEventRepl(cfg)
+	err = SendBinlogEventRepl(ctx, cfg)
 	log.Println("finish getting binlog from mysql")
+	return err
 }
 
-func NewReplBinlogStreamer(cfg *ConfCmd) *replication.BinlogStreamer {
+func NewReplBinlogStreamer(cfg *ConfCmd) (*replication.BinlogStreamer, error) {
+	replSyncer := replication.NewBinlogSyncer(newReplSyncerConfig(cfg))
+	replStreamer, err := startReplSync(cfg, replSyncer)
+	if err != nil {
+		return nil, err
+	}
+	cfg.BinlogSyncer = replSyncer
+	return replStreamer, nil
+}
+
+// newReplSyncerConfig returns the config of the syncer of the job
+func newReplSyncerConfig(cfg *ConfCmd) replication.BinlogSyncerConfig {
 	replCfg := replication.BinlogSyncerConfig{
 		ServerID:                uint32(cfg.ServerId),
 		Flavor:                  cfg.MysqlType,
@@ -45,69 +71,88 @@ func NewReplBinlogStreamer(cfg *ConfCmd) *replication.BinlogStreamer {
 		Port:                    uint16(cfg.Port),
 		User:                    cfg.User,
 		Password:                cfg.Passwd,
-		Charset:                 "utf8",
+		Charset:                 "utf8mb4", // names and queries, the row values are the bytes in the charsets of the columns
 		SemiSyncEnabled:         false,
-		TimestampStringLocation: GBinlogTimeLocation,
+		TimestampStringLocation: cfg.BinlogTimeLoc,
 		ParseTime:               false, //donot parse mysql datetime/time column into go time structure, take it as string
-		UseDecimal:              false, // sqlbuilder not support decimal type
+		UseDecimal:              true,  // decimal.Decimal, exact values in the sqls
 	}
+	if cfg.Follow {
+		// heartbeats keep the idle connection alive, and a broken connection is found by the read timeout and reconnected
+		replCfg.HeartbeatPeriod = FollowHeartbeatPeriod
+		replCfg.ReadTimeout = 3 * FollowHeartbeatPeriod
+	}
+	if cfg.WorkType == "archive" {
+		// events are saved as they are, only the rotate and format description events are decoded
+		replCfg.RawModeEnabled = true
+	}
+	return replCfg
+}
 
-	replSyncer := replication.NewBinlogSyncer(replCfg)
-
-	syncPosition := mysql.Position{Name: cfg.StartFile, Pos: uint32(cfg.StartPos)}
-	replStreamer, err := replSyncer.StartSync(syncPosition)
+// startReplSync starts syncing the binlogs from the start of the job, the syncer is closed if it fails
+func startReplSync(cfg *ConfCmd, replSyncer *replication.BinlogSyncer) (*replication.BinlogStreamer, error) {
+	var (
+		replStreamer *replication.BinlogStreamer
+		err          error
+	)
+	// always sync from the beginning of the start file, the table map events before StartPos are needed
+	// to parse the rows events after it. events before StartFilePos are skipped by CheckBinEvent
+	syncPosition := mysql.Position{Name: cfg.StartFile, Pos: 4}
+	if cfg.StartGtidSet != nil && !cfg.IfSetStartFilePos {
+		// the first event is a fake rotate event, which tells which binlog the gtid set ends in
+		syncPosition = mysql.Position{}
+		replStreamer, err = replSyncer.StartSyncGTID(cfg.StartGtidSet)
+	} else {
+		replStreamer, err = replSyncer.StartSync(syncPosition)
+	}
 	if err != nil {
-		log.Fatalf(fmt.Sprintf("error replication from master %s:%d %v", cfg.Host, cfg.Port, err))
+		replSyncer.Close()
+		return nil, NewEngineError(ErrCategoryConnection, syncPosition, "error replication from master %s:%d %v", cfg.Host, cfg.Port, err)
 	}
-	return replStreamer
+	return replStreamer, nil
 }
 
-func SendBinlogEventRepl(cfg *ConfCmd) {
+func SendBinlogEventRepl(ctx context.Context, cfg *ConfCmd) error {
 	var (
 		err           error
 		ev            *replication.BinlogEvent
 		chkRe         int
 		currentBinlog string = cfg.StartFile
-		binEventIdx   uint64 = 0
-		trxIndex      uint64 = 0
-		trxStatus     int    = 0
-		sqlLower      string = ""
-
-		db      string = ""
-		tb      string = ""
-		sql     string = ""
-		sqlType string = ""
-		rowCnt  uint32 = 0
 
 		tbMapPos uint32 = 0
+		lastPos  uint32 = 4 // end position of the last event received
 
 		//justStart   bool = true
 		//orgSqlEvent *replication.RowsQueryEvent
 	)
 	for {
-		if cfg.IsStopped {
-			log.Println("停止解析")
-			break
-		}
-		if cfg.OutputToScreen {
-			ev, err = cfg.BinlogStreamer.GetEvent(context.Background())
-			if err != nil {
-				log.Fatalf(fmt.Sprintf("error to get binlog event"))
-				break
-			}
-		} else {
-			ctx, cancel := context.WithTimeout(context.Background(), EventTimeout)
+		if cfg.OutputToScreen || cfg.Follow {
 			ev, err = cfg.BinlogStreamer.GetEvent(ctx)
+		} else {
+			evCtx, cancel := context.WithTimeout(ctx, EventTimeout)
+			ev, err = cfg.BinlogStreamer.GetEvent(evCtx)
 			cancel()
-			if err == context.Canceled {
-				log.Println("ready to quit! [%v]", err)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Printf("停止解析, 已读取到 %s:%d", currentBinlog, lastPos)
 				break
 			} else if err == context.DeadlineExceeded {
 				log.Println("deadline exceeded.")
 				break
-			} else if err != nil {
-				log.Fatalf(fmt.Sprintf("error to get binlog event %v", err))
-				break
+			} else {
+				return NewEngineError(ErrCategoryConnection, mysql.Position{Name: currentBinlog, Pos: lastPos}, "error to get binlog event %v", err)
+			}
+		}
+
+		if ev.Header.EventType == replication.HEARTBEAT_EVENT || ev.Header.EventType == replication.HEARTBEAT_LOG_EVENT_V2 {
+			// mysql has no new binlog event, nothing to parse
+			continue
+		}
+
+		if ev.Header.EventType == replication.FORMAT_DESCRIPTION_EVENT {
+			if err = cfg.SetPayloadFormat(ev.Event.(*replication.FormatDescriptionEvent)); err != nil {
+				return NewEngineError(ErrCategoryDecode, mysql.Position{Name: currentBinlog, Pos: lastPos}, "fail to take the format description event %v", err)
 			}
 		}
 
@@ -116,6 +161,24 @@ func SendBinlogEventRepl(cfg *ConfCmd) {
 			// avoid mysqlbing mask the row event as unknown table row event
 		}
 		ev.RawData = []byte{} // we donnot need raw data
+		if ev.Header.LogPos > 0 {
+			lastPos = ev.Header.LogPos
+		}
+
+		if ev.Header.EventType == replication.TRANSACTION_PAYLOAD_EVENT {
+			chkRe, err = cfg.DispatchPayloadEvent(ctx, ev, &currentBinlog)
+			if err != nil {
+				if ctx.Err() != nil {
+					log.Printf("停止解析, 已读取到 %s:%d", currentBinlog, lastPos)
+					break
+				}
+				return err
+			}
+			if chkRe == C_reBreak {
+				break
+			}
+			continue
+		}
 
 		oneMyEvent := &MyBinEvent{MyPos: mysql.Position{Name: currentBinlog, Pos: ev.Header.LogPos}, StartPos: tbMapPos}
 		chkRe = oneMyEvent.CheckBinEvent(cfg, ev, &currentBinlog)
@@ -128,93 +191,47 @@ func SendBinlogEventRepl(cfg *ConfCmd) {
 			continue
 		}
 
-		db, tb, sqlType, sql, rowCnt = GetDbTbAndQueryAndRowCntFromBinevent(ev)
-		//if find := strings.Contains(db, "#"); find {
-		//	log.Fatalf(fmt.Sprintf("Unsupported database name %s contains special character '#'", db))
-		//	break
-		//}
-		//if find := strings.Contains(tb, "#"); find {
-		//	log.Fatalf(fmt.Sprintf("Unsupported table name %s.%s contains special character '#'", db, tb))
-		//	break
-		//}
-
-		if sqlType == "query" {
-			sqlLower = strings.ToLower(sql)
-			if sqlLower == "begin" {
-				trxStatus = C_trxBegin
-				trxIndex++
-			} else if sqlLower == "commit" {
-				trxStatus = C_trxCommit
-			} else if sqlLower == "rollback" {
-				trxStatus = C_trxRollback
-			} else if oneMyEvent.QuerySql != nil {
-				trxStatus = C_trxProcess
-				rowCnt = 1
-			}
-
-		} else {
-			trxStatus = C_trxProcess
-		}
-
-		if cfg.WorkType != "stats" {
-			ifSendEvent := false
-			if cfg.PrintDDL && sqlType == "query" && isDDLKeyword(sql) {
-				oneMyEvent.OrgSql = sql
-				ifSendEvent = true
-			}
-			if !cfg.PrintDDL && oneMyEvent.IfRowsEvent {
-				tbKey := GetAbsTableName(string(oneMyEvent.BinEvent.Table.Schema),
-					string(oneMyEvent.BinEvent.Table.Table))
-				_, err = G_TablesColumnsInfo.GetTableInfoJson(string(oneMyEvent.BinEvent.Table.Schema),
-					string(oneMyEvent.BinEvent.Table.Table))
-				if err != nil {
-					log.Fatalf(fmt.Sprintf("no table struct found for %s, it maybe dropped, skip it. RowsEvent position:%s",
-						tbKey, oneMyEvent.MyPos.String()))
-				}
-				ifSendEvent = true
-			}
-			if ifSendEvent {
-				binEventIdx++
-				oneMyEvent.EventIdx = binEventIdx
-				oneMyEvent.SqlType = sqlType
-				oneMyEvent.Timestamp = ev.Header.Timestamp
-				oneMyEvent.TrxIndex = trxIndex
-				oneMyEvent.TrxStatus = trxStatus
-				cfg.EventChan <- *oneMyEvent
-			}
-		}
-
-		//output analysis result whatever the WorkType is
-		if sqlType != "" {
-			if sqlType == "query" {
-				cfg.StatChan <- BinEventStats{Timestamp: ev.Header.Timestamp, Binlog: currentBinlog, StartPos: ev.Header.LogPos - ev.Header.EventSize, StopPos: ev.Header.LogPos,
-					Database: db, Table: tb, QuerySql: sql, RowCnt: rowCnt, QueryType: sqlType}
-			} else {
-				cfg.StatChan <- BinEventStats{Timestamp: ev.Header.Timestamp, Binlog: currentBinlog, StartPos: tbMapPos, StopPos: ev.Header.LogPos,
-					Database: db, Table: tb, QuerySql: sql, RowCnt: rowCnt, QueryType: sqlType}
+		if err = cfg.DispatchBinEvent(ctx, ev, oneMyEvent, currentBinlog, tbMapPos); err != nil {
+			if ctx.Err() != nil {
+				log.Printf("停止解析, 已读取到 %s:%d", currentBinlog, lastPos)
+				break
 			}
+			return err
 		}
-
 	}
+	return nil
 }
 
 // 获取数据库所有 binlog 文件名列表
-func getBinlogFiles(cfg *ConfCmd) ([]string, error) {
+func getBinlogFiles(ctx context.Context, cfg *ConfCmd) ([]string, error) {
+	logs, err := showBinaryLogs(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, len(logs))
+	for i, l := range logs {
+		files[i] = l.Name
+	}
+	return files, nil
+}
+
+// showBinaryLogs 返回 SHOW BINARY LOGS 的结果, Pos 为文件大小, 即该 binlog 当前的结束位置
+func showBinaryLogs(ctx context.Context, cfg *ConfCmd) ([]mysql.Position, error) {
 
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/mysql", cfg.User, cfg.Passwd, cfg.Host, cfg.Port)
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer db.Close()
-	rows, err := db.Query("SHOW BINARY LOGS")
+	rows, err := db.QueryContext(ctx, "SHOW BINARY LOGS")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	cols, _ := rows.Columns()
-	var files []string
+	var logs []mysql.Position
 	for rows.Next() {
 		// 创建一个对应列数的数组
 		values := make([]interface{}, len(cols))
@@ -228,18 +245,30 @@ func getBinlogFiles(cfg *ConfCmd) ([]string, error) {
 			return nil, err
 		}
 
-		// 第一个字段 [0] 永远是 Log_name
+		// 第一个字段 [0] 永远是 Log_name, 第二个字段 [1] 是 File_size
+		var l mysql.Position
 		if val, ok := values[0].([]byte); ok {
-			files = append(files, string(val))
+			l.Name = string(val)
 		} else if val, ok := values[0].(string); ok {
-			files = append(files, val)
+			l.Name = val
+		} else {
+			continue
+		}
+		if len(values) > 1 {
+			size := fmt.Sprint(values[1])
+			if val, ok := values[1].([]byte); ok {
+				size = string(val)
+			}
+			n, _ := strconv.ParseUint(size, 10, 32)
+			l.Pos = uint32(n)
 		}
+		logs = append(logs, l)
 	}
-	return files, nil
+	return logs, nil
 }
 
 // 获取单个 binlog 文件的起始时间
-func getFileStartTime(cfg *ConfCmd, filename string) time.Time {
+func getFileStartTime(ctx context.Context, cfg *ConfCmd, filename string) time.Time {
 	cfg_single := replication.BinlogSyncerConfig{
 		ServerID: uint32(time.Now().UnixNano()%10000) + 2000,
 		Host:     cfg.Host, Port: uint16(cfg.Port), User: cfg.User, Password: cfg.Passwd, Flavor: "mysql",
@@ -252,17 +281,17 @@ func getFileStartTime(cfg *ConfCmd, filename string) time.Time {
 		return time.Time{}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	evCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
 	// 1. 获取第一个事件 (通常是 RotateEvent 或 FormatDescription)
-	ev, err := streamer.GetEvent(ctx)
+	ev, err := streamer.GetEvent(evCtx)
 	if err != nil {
 		return time.Time{}
 	}
 
 	// 2. 获取第二个事件 (真实的业务开始时间)
-	ev, err = streamer.GetEvent(ctx)
+	ev, err = streamer.GetEvent(evCtx)
 	if err != nil {
 		return time.Time{}
 	}
@@ -270,7 +299,7 @@ func getFileStartTime(cfg *ConfCmd, filename string) time.Time {
 	return time.Unix(int64(ev.Header.Timestamp), 0)
 }
 
-func findStartFile(cfg *ConfCmd, files []string) string {
+func findStartFile(ctx context.Context, cfg *ConfCmd, files []string) string {
 
 	if len(files) == 0 {
 		return ""
@@ -286,7 +315,10 @@ func findStartFile(cfg *ConfCmd, files []string) string {
 
 	for low <= high {
 		mid := (low + high) / 2
-		midTime := getFileStartTime(cfg, files[mid])
+		if ctx.Err() != nil {
+			break
+		}
+		midTime := getFileStartTime(ctx, cfg, files[mid])
 
 		// 如果中间文件的时间早于目标时间，说明起点可能在后面，也可能就是当前这个
 		if midTime.Before(targetTime) {
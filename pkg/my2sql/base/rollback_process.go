@@ -1,31 +1,64 @@
 package base
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
 
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/siddontang/go-log/log"
 )
 
-func ReverseFileGo(threadIdx int, rollbackFileChan chan map[string]string, bytesCntFiles map[string][][]int, keepTrx bool, wg *sync.WaitGroup) {
+// ReverseRollbackFiles reverts the content order of the rollback tmp files into rollback sql files by cfg.Threads threads
+func ReverseRollbackFiles(ctx context.Context, cfg *ConfCmd, rollbackFiles []map[string]string, bytesCntFiles map[string][][]int) {
+	var reWg sync.WaitGroup
+	filesChan := make(chan map[string]string, cfg.Threads)
+	threadNum := GetMinValue(int(cfg.Threads), len(rollbackFiles))
+	for i := 1; i <= threadNum; i++ {
+		reWg.Add(1)
+		go ReverseFileGo(ctx, i, cfg, filesChan, bytesCntFiles, &reWg)
+	}
+	for _, tmpArr := range rollbackFiles {
+		if ctx.Err() != nil {
+			break
+		}
+		filesChan <- tmpArr
+	}
+	close(filesChan)
+	reWg.Wait()
+}
+
+func ReverseFileGo(ctx context.Context, threadIdx int, cfg *ConfCmd, rollbackFileChan chan map[string]string, bytesCntFiles map[string][][]int, wg *sync.WaitGroup) {
 	defer wg.Done()
 	log.Infof("start thread %d to revert rollback sql files", threadIdx)
 	for arr := range rollbackFileChan {
+		if ctx.Err() != nil {
+			continue
+		}
 		//ReverseFileToNewFile(arr["tmp"], arr["rollback"], batchLines)
 		//ReverseFileToNewFileOneByOneLineAndKeepTrx(arr["tmp"], arr["rollback"])
-		ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(arr["tmp"], arr["rollback"], bytesCntFiles[arr["tmp"]], keepTrx)
-		err := os.Remove(arr["tmp"])
+		err := ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(ctx, arr["tmp"], arr["rollback"], bytesCntFiles[arr["tmp"]], cfg.KeepTrx, cfg.SqlFilePreamble())
+		if err != nil {
+			// keep the tmp file, the rollback sql is still in it
+			if ctx.Err() != nil {
+				log.Infof("stop reverting %s, rollback sql is left in it", arr["tmp"])
+				continue
+			}
+			cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to revert %s into %s %v", arr["tmp"], arr["rollback"], err))
+			continue
+		}
+		err = os.Remove(arr["tmp"])
 		if err != nil {
-			log.Fatalf("fail to remove tmp file %s", arr["tmp"])
+			cfg.SetJobError(NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to remove tmp file %s %v", arr["tmp"], err))
 		}
 	}
 	log.Infof(fmt.Sprintf("exit thread %d to revert rollback sql files", threadIdx))
 }
 
-func ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(srcFile string, destFile string, trxPoses [][]int, keepTrx bool) error {
+func ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(ctx context.Context, srcFile string, destFile string, trxPoses [][]int, keepTrx bool, preamble string) error {
 	var (
 		srcFH            *os.File
 		destFH           *os.File
@@ -57,6 +90,11 @@ func ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(srcFile string, destFil
 		return err
 	}
 
+	if _, err = destFH.WriteString(preamble); err != nil {
+		log.Errorf("fail to write file %s", destFile)
+		return err
+	}
+
 	srcInfo, err = srcFH.Stat()
 	if err != nil {
 		log.Errorf("fail to stat file %s", srcFile)
@@ -74,6 +112,9 @@ func ReverseFileToNewFileOneByOneLineAndKeepTrxBatchRead(srcFile string, destFil
 	}
 
 	for batchIdx := len(trxPoses) - 1; batchIdx >= 0; batchIdx-- {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
 		startPos, err := srcFH.Seek(-int64(trxPoses[batchIdx][0]), os.SEEK_CUR)
 		if err != nil {
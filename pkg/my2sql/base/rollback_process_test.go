@@ -0,0 +1,41 @@
+package base
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReverseRollbackFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &ConfCmd{Threads: 2}
+	var rollbackFiles []map[string]string
+	bytesCntFiles := map[string][][]int{}
+	for _, name := range []string{"db.tb1", "db.tb2"} {
+		tmp := filepath.Join(dir, name+".tmp")
+		// the rollback sqls of two transactions, in binlog order
+		if err := os.WriteFile(tmp, []byte("delete 1;\ndelete 2;\ninsert 3;\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rollbackFiles = append(rollbackFiles, map[string]string{"tmp": tmp, "rollback": filepath.Join(dir, name+".sql")})
+		bytesCntFiles[tmp] = [][]int{{20, 1}, {10, 2}}
+	}
+
+	ReverseRollbackFiles(context.Background(), cfg, rollbackFiles, bytesCntFiles)
+	if err := cfg.JobError(); err != nil {
+		t.Fatalf("ReverseRollbackFiles() error = %v", err)
+	}
+	for _, arr := range rollbackFiles {
+		got, err := os.ReadFile(arr["rollback"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := cfg.SqlFilePreamble() + "insert 3;\ndelete 2;\ndelete 1;\n"; string(got) != want {
+			t.Errorf("%s = %q, want %q", arr["rollback"], got, want)
+		}
+		if _, err := os.Stat(arr["tmp"]); !os.IsNotExist(err) {
+			t.Errorf("tmp file %s is not removed", arr["tmp"])
+		}
+	}
+}
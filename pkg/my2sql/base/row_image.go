@@ -0,0 +1,214 @@
+package base
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	SQL "my-wails-app/pkg/my2sql/sqlbuilder"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/siddontang/go-log/log"
+)
+
+// with binlog_row_image=MINIMAL or NOBLOB, only part of the columns are logged in the row images.
+// the columns not logged are decoded as nil, they must not be taken as NULL in sql
+
+const RowImageWarningFileName = "row_image_warnings.txt"
+
+// ColumnsInImage returns whether each column is logged in the row image rEv.Rows[rowIdx],
+// nil means all the columns are logged
+func ColumnsInImage(rEv *replication.RowsEvent, rowIdx int) []bool {
+	if rowIdx >= len(rEv.SkippedColumns) || len(rEv.SkippedColumns[rowIdx]) == 0 {
+		return nil
+	}
+	present := make([]bool, len(rEv.Rows[rowIdx]))
+	for i := range present {
+		present[i] = true
+	}
+	for _, idx := range rEv.SkippedColumns[rowIdx] {
+		if idx < len(present) {
+			present[idx] = false
+		}
+	}
+	return present
+}
+
+// IsColumnInImage returns true if column idx is logged, present is returned by ColumnsInImage
+func IsColumnInImage(present []bool, idx int) bool {
+	return present == nil || (idx < len(present) && present[idx])
+}
+
+// areColumnsInImage returns true if all the columns of idxes are logged
+func areColumnsInImage(present []bool, idxes []int) bool {
+	for _, idx := range idxes {
+		if !IsColumnInImage(present, idx) {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeUpdateImages returns the row after update with its logged columns: the column logged in the after image,
+// or the column not updated and logged in the before image
+func MergeUpdateImages(before []interface{}, beforePresent []bool, after []interface{}, afterPresent []bool) ([]interface{}, []bool) {
+	if afterPresent == nil {
+		return after, nil
+	}
+	merged := make([]interface{}, len(after))
+	present := make([]bool, len(after))
+	for i := range after {
+		if IsColumnInImage(afterPresent, i) {
+			merged[i] = after[i]
+			present[i] = true
+		} else if IsColumnInImage(beforePresent, i) && i < len(before) {
+			merged[i] = before[i]
+			present[i] = true
+		}
+	}
+	return merged, present
+}
+
+func missingColumnNames(colDefs []SQL.NonAliasColumn, present []bool, idxes []int) string {
+	var names []string
+	for _, idx := range idxes {
+		if !IsColumnInImage(present, idx) && idx < len(colDefs) {
+			names = append(names, colDefs[idx].Name())
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func allColumnIdxes(colCnt int) []int {
+	idxes := make([]int, colCnt)
+	for i := range idxes {
+		idxes[i] = i
+	}
+	return idxes
+}
+
+// CheckRowImageForSql returns why the sql of the rows event can not be generated from its row images, "" if it can.
+// the rows of one event log the same columns, so the first row is checked.
+// forward sqls are built from the logged columns, rollback sqls need the column values before the change
+// and the columns to locate the row, which are a unique key or all the columns
+func CheckRowImageForSql(rEv *replication.RowsEvent, sqlType string, ifRollback bool, colDefs []SQL.NonAliasColumn, uniKey []int) string {
+	if len(rEv.Rows) == 0 {
+		return ""
+	}
+	colCnt := len(rEv.Rows[0])
+	canLocate := func(present []bool) bool {
+		return (len(uniKey) > 0 && areColumnsInImage(present, uniKey)) || areColumnsInImage(present, allColumnIdxes(colCnt))
+	}
+	image := ColumnsInImage(rEv, 0)
+	switch sqlType {
+	case "insert":
+		if ifRollback && !canLocate(image) {
+			return fmt.Sprintf("rollback of insert: unique key columns %s are not in the row image, can not locate the row to delete",
+				missingColumnNames(colDefs, image, uniKey))
+		}
+	case "delete":
+		if ifRollback && image != nil {
+			return fmt.Sprintf("rollback of delete: columns %s are not in the row image, can not insert the row back",
+				missingColumnNames(colDefs, image, allColumnIdxes(colCnt)))
+		}
+	case "update":
+		if !ifRollback || len(rEv.Rows) < 2 {
+			return ""
+		}
+		after := ColumnsInImage(rEv, 1)
+		var updated []int
+		for i := 0; i < colCnt; i++ {
+			if IsColumnInImage(after, i) {
+				updated = append(updated, i)
+			}
+		}
+		if !areColumnsInImage(image, updated) {
+			return fmt.Sprintf("rollback of update: columns %s are not in the before image, can not revert them",
+				missingColumnNames(colDefs, image, updated))
+		}
+		_, merged := MergeUpdateImages(rEv.Rows[0], image, rEv.Rows[1], after)
+		if !canLocate(merged) {
+			return fmt.Sprintf("rollback of update: unique key columns %s are not in the row images, can not locate the row",
+				missingColumnNames(colDefs, merged, uniKey))
+		}
+	}
+	return ""
+}
+
+// RowImageWarning counts the rows events of one table whose sqls are not generated for the same reason
+type RowImageWarning struct {
+	Reason   string
+	Events   int
+	Rows     int
+	FirstPos mysql.Position
+	LastPos  mysql.Position
+}
+
+// AddRowImageWarning records a rows event whose sqls are not generated, they are written by WriteRowImageWarnings
+func (this *ConfCmd) AddRowImageWarning(table string, reason string, pos mysql.Position, rowCnt int) {
+	this.rowImageWarningsLock.Lock()
+	defer this.rowImageWarningsLock.Unlock()
+	if this.rowImageWarnings == nil {
+		this.rowImageWarnings = make(map[string]map[string]*RowImageWarning)
+	}
+	if this.rowImageWarnings[table] == nil {
+		this.rowImageWarnings[table] = make(map[string]*RowImageWarning)
+	}
+	w, ok := this.rowImageWarnings[table][reason]
+	if !ok {
+		w = &RowImageWarning{Reason: reason, FirstPos: pos}
+		this.rowImageWarnings[table][reason] = w
+		log.Warnf("%s %s, first at %s", table, reason, pos.String())
+	}
+	w.Events++
+	w.Rows += rowCnt
+	w.LastPos = pos
+}
+
+// WriteRowImageWarnings writes the per table report of the rows events whose sqls are not generated
+// because of binlog_row_image=MINIMAL or NOBLOB or the partial json updates into OutputDir, nothing is written if there is none
+func (this *ConfCmd) WriteRowImageWarnings() error {
+	this.rowImageWarningsLock.Lock()
+	defer this.rowImageWarningsLock.Unlock()
+	if len(this.rowImageWarnings) == 0 {
+		return nil
+	}
+	tables := make([]string, 0, len(this.rowImageWarnings))
+	for table := range this.rowImageWarnings {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-40s %-10s %-10s %-30s %-30s %s\n", "table", "events", "rows", "first", "last", "reason"))
+	for _, table := range tables {
+		reasons := make([]string, 0, len(this.rowImageWarnings[table]))
+		for reason := range this.rowImageWarnings[table] {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			w := this.rowImageWarnings[table][reason]
+			sb.WriteString(fmt.Sprintf("%-40s %-10d %-10d %-30s %-30s %s\n", table, w.Events, w.Rows,
+				w.FirstPos.String(), w.LastPos.String(), w.Reason))
+		}
+	}
+	fileName := filepath.Join(this.OutputDir, RowImageWarningFileName)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if this.resumeFrom != nil {
+		// keep the warnings before the checkpoint
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	fh, err := os.OpenFile(fileName, flag, 0644)
+	if err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to open file %s %v", fileName, err)
+	}
+	defer fh.Close()
+	if _, err = fh.WriteString(sb.String()); err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to write file %s %v", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package base
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	SQL "my-wails-app/pkg/my2sql/sqlbuilder"
+
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+func TestMergeUpdateImages(t *testing.T) {
+	tests := []struct {
+		name          string
+		before        []interface{}
+		beforePresent []bool
+		after         []interface{}
+		afterPresent  []bool
+		want          []interface{}
+		wantPresent   []bool
+	}{
+		{
+			name:   "full after image",
+			before: []interface{}{int32(1), "a", "b"},
+			after:  []interface{}{int32(1), "x", "b"},
+			want:   []interface{}{int32(1), "x", "b"},
+		},
+		{
+			name:          "columns not updated from before image",
+			before:        []interface{}{int32(1), "a", "b"},
+			beforePresent: nil,
+			after:         []interface{}{nil, "x", nil},
+			afterPresent:  []bool{false, true, false},
+			want:          []interface{}{int32(1), "x", "b"},
+			wantPresent:   []bool{true, true, true},
+		},
+		{
+			name:          "minimal images",
+			before:        []interface{}{int32(1), nil, nil},
+			beforePresent: []bool{true, false, false},
+			after:         []interface{}{nil, "x", nil},
+			afterPresent:  []bool{false, true, false},
+			want:          []interface{}{int32(1), "x", nil},
+			wantPresent:   []bool{true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, present := MergeUpdateImages(tt.before, tt.beforePresent, tt.after, tt.afterPresent)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("row = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(present, tt.wantPresent) {
+				t.Errorf("present = %v, want %v", present, tt.wantPresent)
+			}
+		})
+	}
+}
+
+func TestCheckRowImageForSql(t *testing.T) {
+	colDefs := []SQL.NonAliasColumn{
+		SQL.IntColumn("id", SQL.NotNullable),
+		SQL.StrColumn("a", SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.Nullable),
+		SQL.StrColumn("b", SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.Nullable),
+	}
+	full := []interface{}{int32(1), "a", "b"}
+	tests := []struct {
+		name       string
+		sqlType    string
+		ifRollback bool
+		rows       [][]interface{}
+		skipped    [][]int
+		uniKey     []int
+		want       string // part of the reason, "" if the sql can be generated
+	}{
+		{
+			name:    "full image",
+			sqlType: "delete", ifRollback: true,
+			rows: [][]interface{}{full},
+		},
+		{
+			name:    "forward insert of minimal image",
+			sqlType: "insert",
+			rows:    [][]interface{}{{int32(1), nil, nil}}, skipped: [][]int{{1, 2}},
+		},
+		{
+			name:    "rollback of insert located by unique key",
+			sqlType: "insert", ifRollback: true,
+			rows: [][]interface{}{{int32(1), nil, "b"}}, skipped: [][]int{{1}}, uniKey: []int{0},
+		},
+		{
+			name:    "rollback of insert without unique key",
+			sqlType: "insert", ifRollback: true,
+			rows: [][]interface{}{{nil, "a", "b"}}, skipped: [][]int{{0}}, uniKey: []int{0},
+			want: "unique key columns id are not in the row image",
+		},
+		{
+			name:    "rollback of delete of minimal image",
+			sqlType: "delete", ifRollback: true,
+			rows: [][]interface{}{{int32(1), nil, nil}}, skipped: [][]int{{1, 2}}, uniKey: []int{0},
+			want: "columns a,b are not in the row image",
+		},
+		{
+			name:    "forward update of minimal images",
+			sqlType: "update",
+			rows:    [][]interface{}{{int32(1), nil, nil}, {nil, "x", nil}}, skipped: [][]int{{1, 2}, {0, 2}},
+		},
+		{
+			name:    "rollback of update with noblob before image",
+			sqlType: "update", ifRollback: true,
+			rows: [][]interface{}{{int32(1), "a", nil}, {int32(1), "x", nil}}, skipped: [][]int{{2}, {2}}, uniKey: []int{0},
+		},
+		{
+			name:    "rollback of update of minimal images",
+			sqlType: "update", ifRollback: true,
+			rows: [][]interface{}{{int32(1), nil, nil}, {nil, "x", nil}}, skipped: [][]int{{1, 2}, {0, 2}}, uniKey: []int{0},
+			want: "columns a are not in the before image",
+		},
+		{
+			name:    "rollback of update without unique key",
+			sqlType: "update", ifRollback: true,
+			rows: [][]interface{}{{nil, "a", nil}, {nil, "x", nil}}, skipped: [][]int{{0, 2}, {0, 2}},
+			want: "can not locate the row",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rEv := &replication.RowsEvent{Rows: tt.rows, SkippedColumns: tt.skipped}
+			got := CheckRowImageForSql(rEv, tt.sqlType, tt.ifRollback, colDefs, tt.uniKey)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("CheckRowImageForSql() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
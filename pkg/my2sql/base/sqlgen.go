@@ -3,16 +3,22 @@ package base
 import (
 	"fmt"
 	SQL "my-wails-app/pkg/my2sql/sqlbuilder"
+	"my-wails-app/pkg/my2sql/sqltypes"
 	toolkits "my-wails-app/pkg/my2sql/toolkits"
 	"strings"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
-	"github.com/siddontang/go-log/log"
+	"github.com/shopspring/decimal"
 )
 
 var G_Bytes_Column_Types []string = []string{"blob", "json", "geometry", C_unknownColType}
 
+func init() {
+	// decimals in the json documents are numbers, not quoted strings
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
 func GetPosStr(name string, spos uint32, epos uint32) string {
 	return fmt.Sprintf("%s %d-%d", name, spos, epos)
 }
@@ -33,18 +39,18 @@ func GetAllFieldNamesWithDroppedFields(rowLen int, colNames []FieldInfo) []Field
 	return arr
 }
 
-func GetSqlFieldsEXpressions(colCnt int, colNames []FieldInfo, tbMap *replication.TableMapEvent) ([]SQL.NonAliasColumn, []string) {
+func GetSqlFieldsEXpressions(colCnt int, colNames []FieldInfo, tbMap *replication.TableMapEvent, geographicSrids map[uint32]bool) ([]SQL.NonAliasColumn, []string) {
 	colDefExps := make([]SQL.NonAliasColumn, colCnt)
 	colTypeNames := make([]string, colCnt)
 	for i := 0; i < colCnt; i++ {
-		typeName, colDef := GetMysqlDataTypeNameAndSqlColumn(colNames[i].FieldType, colNames[i].FieldName, tbMap.ColumnType[i], tbMap.ColumnMeta[i])
+		typeName, colDef := GetMysqlDataTypeNameAndSqlColumn(colNames[i].FieldType, colNames[i].FieldName, tbMap.ColumnType[i], tbMap.ColumnMeta[i], geographicSrids)
 		colDefExps[i] = colDef
 		colTypeNames[i] = typeName
 	}
 	return colDefExps, colTypeNames
 }
 
-func GetMysqlDataTypeNameAndSqlColumn(tpDef string, colName string, tp byte, meta uint16) (string, SQL.NonAliasColumn) {
+func GetMysqlDataTypeNameAndSqlColumn(tpDef string, colName string, tp byte, meta uint16, geographicSrids map[uint32]bool) (string, SQL.NonAliasColumn) {
 	// for unkown type, defaults to BytesColumn
 
 	//get real string type
@@ -79,14 +85,14 @@ func GetMysqlDataTypeNameAndSqlColumn(tpDef string, colName string, tp byte, met
 		return "bigint", SQL.IntColumn(colName, SQL.NotNullable)
 
 	case mysql.MYSQL_TYPE_NEWDECIMAL:
-		return "decimal", SQL.DoubleColumn(colName, SQL.NotNullable)
+		return "decimal", SQL.DecimalColumn(colName, SQL.NotNullable)
 
 	case mysql.MYSQL_TYPE_FLOAT:
 		return "float", SQL.DoubleColumn(colName, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_DOUBLE:
 		return "double", SQL.DoubleColumn(colName, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_BIT:
-		return "bit", SQL.IntColumn(colName, SQL.NotNullable)
+		return "bit", SQL.BitColumn(colName, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_TIMESTAMP:
 		//return "timestamp", SQL.DateTimeColumn(colName, SQL.NotNullable)
 		return "timestamp", SQL.StrColumn(colName, SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
@@ -109,9 +115,9 @@ func GetMysqlDataTypeNameAndSqlColumn(tpDef string, colName string, tp byte, met
 	case mysql.MYSQL_TYPE_YEAR:
 		return "year", SQL.IntColumn(colName, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_ENUM:
-		return "enum", SQL.IntColumn(colName, SQL.NotNullable)
+		return "enum", SQL.StrColumn(colName, SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_SET:
-		return "set", SQL.IntColumn(colName, SQL.NotNullable)
+		return "set", SQL.StrColumn(colName, SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_BLOB:
 		//text is stored as blob
 		if strings.Contains(strings.ToLower(tpDef), "text") {
@@ -120,22 +126,76 @@ func GetMysqlDataTypeNameAndSqlColumn(tpDef string, colName string, tp byte, met
 		return "blob", SQL.BytesColumn(colName, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_VARCHAR,
 		mysql.MYSQL_TYPE_VAR_STRING:
-
+		// varbinary is logged as varchar
+		if strings.Contains(strings.ToLower(tpDef), "binary") {
+			return "varchar", SQL.BytesColumn(colName, SQL.NotNullable)
+		}
 		return "varchar", SQL.StrColumn(colName, SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_STRING:
+		// binary is logged as char
+		if strings.Contains(strings.ToLower(tpDef), "binary") {
+			return "char", SQL.BytesColumn(colName, SQL.NotNullable)
+		}
 		return "char", SQL.StrColumn(colName, SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
 	case mysql.MYSQL_TYPE_JSON:
 		//return "json", SQL.BytesColumn(colName, SQL.NotNullable)
 		return "json", SQL.StrColumn(colName, SQL.UTF8, SQL.UTF8CaseInsensitive, SQL.NotNullable)
 
 	case mysql.MYSQL_TYPE_GEOMETRY:
-		return "geometry", SQL.BytesColumn(colName, SQL.NotNullable)
+		return "geometry", SQL.GeometryColumn(colName, SQL.NotNullable, geographicSrids)
 	default:
 		return C_unknownColType, SQL.BytesColumn(colName, SQL.NotNullable)
 	}
 }
 
-func GenInsertSqlsForOneRowsEvent(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, rowsPerSql int, ifRollback bool, ifprefixDb bool, ifIgnorePrimary bool, primaryIdx []int) []string {
+// ConvertEnumSetValue converts the enum index or the set bitmask in binlog into the labels, ex: 'b' and 'a,c'.
+// the value is not changed if labels is unknown or does not have it
+func ConvertEnumSetValue(v interface{}, colType string, labels []string) interface{} {
+	idx, ok := v.(int64)
+	if !ok || len(labels) == 0 {
+		return v
+	}
+	if colType == "enum" {
+		// 0 is the empty string inserted for an invalid value
+		if idx == 0 {
+			return ""
+		}
+		if idx > int64(len(labels)) {
+			return v
+		}
+		return labels[idx-1]
+	}
+	if len(labels) < 64 && uint64(idx)>>uint(len(labels)) != 0 {
+		return v
+	}
+	members := []string{}
+	for i, label := range labels {
+		if uint64(idx)&(1<<uint(i)) != 0 {
+			members = append(members, label)
+		}
+	}
+	return strings.Join(members, ",")
+}
+
+// IsSameValue compares the column values in the before and after images, decimal.Decimal is compared by value,
+// sqltypes.Value of the strings not converted into utf8 is compared by bytes, they are in the charset of the same column
+func IsSameValue(a interface{}, b interface{}) bool {
+	if da, ok := a.(decimal.Decimal); ok {
+		db, ok := b.(decimal.Decimal)
+		return ok && da.Equal(db)
+	}
+	if va, ok := a.(sqltypes.Value); ok {
+		vb, ok := b.(sqltypes.Value)
+		return ok && CompareEquelByteSlice(va.Raw(), vb.Raw())
+	}
+	if _, ok := b.(sqltypes.Value); ok {
+		return false
+	}
+	return a == b
+}
+
+// GenInsertSqlsForOneRowsEvent generates the insert sqls of the rows, the generated columns in generatedIdx are left out
+func GenInsertSqlsForOneRowsEvent(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, rowsPerSql int, ifRollback bool, ifprefixDb bool, ifIgnorePrimary bool, primaryIdx []int, generatedIdx []int) ([]string, error) {
 	var (
 		insertSql  SQL.InsertStatement
 		oneSql     string
@@ -160,34 +220,50 @@ func GenInsertSqlsForOneRowsEvent(posStr string, rEv *replication.RowsEvent, col
 	if len(primaryIdx) == 0 {
 		ifIgnorePrimary = false
 	}
+	// the columns not in the row image are left to their default values
+	ignoreIdx := []int{}
 	if ifIgnorePrimary {
-		newColDefs = GetColDefIgnorePrimary(colDefs, primaryIdx)
+		ignoreIdx = append(ignoreIdx, primaryIdx...)
+	}
+	for _, ci := range generatedIdx {
+		if !toolkits.ContainsInt(ignoreIdx, ci) {
+			ignoreIdx = append(ignoreIdx, ci)
+		}
+	}
+	if image := ColumnsInImage(rEv, 0); image != nil {
+		for ci := range image {
+			if !image[ci] && !toolkits.ContainsInt(ignoreIdx, ci) {
+				ignoreIdx = append(ignoreIdx, ci)
+			}
+		}
+	}
+	ifIgnoreCols := len(ignoreIdx) > 0
+	if ifIgnoreCols {
+		newColDefs = GetColDefIgnorePrimary(colDefs, ignoreIdx)
 	}
 	for i = 0; i < rowCnt; i += rowsPerSql {
 		insertSql = SQL.NewTable(table, newColDefs...).Insert(newColDefs...)
 		endIndex = GetMinValue(rowCnt, i+rowsPerSql)
-		oneSql, err = GenInsertSqlForRows(rEv.Rows[i:endIndex], insertSql, schema, ifprefixDb, ifIgnorePrimary, primaryIdx)
+		oneSql, err = GenInsertSqlForRows(rEv.Rows[i:endIndex], colDefs, insertSql, schema, ifprefixDb, ifIgnoreCols, ignoreIdx)
 		if err != nil {
-			log.Fatalf(fmt.Sprintf("Fail to generate %s sql for %s %s \n\terror: %v\n\trows data:%v",
-				sqlType, GetAbsTableName(schema, table), posStr, err, rEv.Rows[i:endIndex]))
-		} else {
-			sqlArr = append(sqlArr, oneSql)
+			return sqlArr, fmt.Errorf("Fail to generate %s sql for %s %s \n\terror: %v\n\trows data:%v",
+				sqlType, GetAbsTableName(schema, table), posStr, err, rEv.Rows[i:endIndex])
 		}
+		sqlArr = append(sqlArr, oneSql)
 
 	}
 
 	if endIndex < rowCnt {
 		insertSql = SQL.NewTable(table, newColDefs...).Insert(newColDefs...)
-		oneSql, err = GenInsertSqlForRows(rEv.Rows[endIndex:rowCnt], insertSql, schema, ifprefixDb, ifIgnorePrimary, primaryIdx)
+		oneSql, err = GenInsertSqlForRows(rEv.Rows[endIndex:rowCnt], colDefs, insertSql, schema, ifprefixDb, ifIgnoreCols, ignoreIdx)
 		if err != nil {
-			log.Fatalf(fmt.Sprintf("Fail to generate %s sql for %s %s \n\terror: %s\n\trows data:%v",
-				sqlType, GetAbsTableName(schema, table), posStr, err, rEv.Rows[endIndex:rowCnt]))
-		} else {
-			sqlArr = append(sqlArr, oneSql)
+			return sqlArr, fmt.Errorf("Fail to generate %s sql for %s %s \n\terror: %s\n\trows data:%v",
+				sqlType, GetAbsTableName(schema, table), posStr, err, rEv.Rows[endIndex:rowCnt])
 		}
+		sqlArr = append(sqlArr, oneSql)
 	}
 	//fmt.Println("one insert sqlArr", sqlArr)
-	return sqlArr
+	return sqlArr, nil
 
 }
 
@@ -202,7 +278,8 @@ func GetColDefIgnorePrimary(colDefs []SQL.NonAliasColumn, primaryIdx []int) []SQ
 	return m
 }
 
-func ConvertRowToExpressRow(row []interface{}, ifIgnorePrimary bool, primaryIdx []int) []SQL.Expression {
+// ConvertRowToExpressRow returns the literals of the row values, written as the types of colDefs, see SQL.ColumnLiteral
+func ConvertRowToExpressRow(row []interface{}, colDefs []SQL.NonAliasColumn, ifIgnorePrimary bool, primaryIdx []int) []SQL.Expression {
 
 	valueInserted := []SQL.Expression{}
 	for i, val := range row {
@@ -211,16 +288,16 @@ func ConvertRowToExpressRow(row []interface{}, ifIgnorePrimary bool, primaryIdx
 				continue
 			}
 		}
-		vExp := SQL.Literal(val)
+		vExp := SQL.ColumnLiteral(colDefs[i], val)
 		valueInserted = append(valueInserted, vExp)
 	}
 	return valueInserted
 }
 
-func GenInsertSqlForRows(rows [][]interface{}, insertSql SQL.InsertStatement, schema string, ifprefixDb bool, ifIgnorePrimary bool, primaryIdx []int) (string, error) {
+func GenInsertSqlForRows(rows [][]interface{}, colDefs []SQL.NonAliasColumn, insertSql SQL.InsertStatement, schema string, ifprefixDb bool, ifIgnorePrimary bool, primaryIdx []int) (string, error) {
 
 	for _, row := range rows {
-		valuesInserted := ConvertRowToExpressRow(row, ifIgnorePrimary, primaryIdx)
+		valuesInserted := ConvertRowToExpressRow(row, colDefs, ifIgnorePrimary, primaryIdx)
 		insertSql.Add(valuesInserted...)
 	}
 	if !ifprefixDb {
@@ -231,11 +308,11 @@ func GenInsertSqlForRows(rows [][]interface{}, insertSql SQL.InsertStatement, sc
 
 }
 
-func GenDeleteSqlsForOneRowsEventRollbackInsert(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, ifprefixDb bool) []string {
-	return GenDeleteSqlsForOneRowsEvent(posStr, rEv, colDefs, uniKey, ifFullImage, true, ifprefixDb)
+func GenDeleteSqlsForOneRowsEventRollbackInsert(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, ifprefixDb bool, generatedIdx []int) ([]string, error) {
+	return GenDeleteSqlsForOneRowsEvent(posStr, rEv, colDefs, uniKey, ifFullImage, true, ifprefixDb, generatedIdx)
 }
 
-func GenDeleteSqlsForOneRowsEvent(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, ifRollback bool, ifprefixDb bool) []string {
+func GenDeleteSqlsForOneRowsEvent(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, ifRollback bool, ifprefixDb bool, generatedIdx []int) ([]string, error) {
 	rowCnt := len(rEv.Rows)
 	sqlArr := make([]string, rowCnt)
 	//var sqlArr []string
@@ -253,40 +330,49 @@ func GenDeleteSqlsForOneRowsEvent(posStr string, rEv *replication.RowsEvent, col
 		sqlType = "delete"
 	}
 	for i, row := range rEv.Rows {
-		whereCond := GenEqualConditions(row, colDefs, uniKey, ifFullImage)
+		whereCond := GenEqualConditions(row, colDefs, uniKey, ifFullImage, ColumnsInImage(rEv, i), generatedIdx)
 
 		sql, err := SQL.NewTable(table, colDefs...).Delete().Where(SQL.And(whereCond...)).String(schemaInSql)
 		if err != nil {
-			log.Fatalf(fmt.Sprintf("Fail to generate %s sql for %s %s \n\terror: %s\n\trows data:%v",
-				sqlType, GetAbsTableName(schema, table), posStr, err, row))
-			//continue
+			return sqlArr[:i], fmt.Errorf("Fail to generate %s sql for %s %s \n\terror: %s\n\trows data:%v",
+				sqlType, GetAbsTableName(schema, table), posStr, err, row)
 		}
 		sqlArr[i] = sql
 		//sqlArr = append(sqlArr, sql)
 	}
-	return sqlArr
+	return sqlArr, nil
 }
 
-func GenEqualConditions(row []interface{}, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool) []SQL.BoolExpression {
-	if !ifFullImage && len(uniKey) > 0 {
+// GenEqualConditions locates the row by the unique key, or by all the columns if ifFullImage is set or the key is not logged.
+// present tells the columns logged in the row image, see ColumnsInImage. the generated columns in generatedIdx are
+// compared only if they are in the unique key, they are computed from the other columns
+func GenEqualConditions(row []interface{}, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, present []bool, generatedIdx []int) []SQL.BoolExpression {
+	if !ifFullImage && len(uniKey) > 0 && areColumnsInImage(present, uniKey) {
 		expArrs := make([]SQL.BoolExpression, len(uniKey))
 		for k, idx := range uniKey {
-			expArrs[k] = SQL.EqL(colDefs[idx], row[idx])
+			expArrs[k] = SQL.EqCL(colDefs[idx], row[idx])
 		}
 		return expArrs
 	}
-	expArrs := make([]SQL.BoolExpression, len(row))
+	expArrs := make([]SQL.BoolExpression, 0, len(row))
 	for i, v := range row {
-		expArrs[i] = SQL.EqL(colDefs[i], v)
+		if !IsColumnInImage(present, i) || toolkits.ContainsInt(generatedIdx, i) {
+			continue
+		}
+		if _, ok := v.(JsonDiffVector); ok {
+			// the json document after a partial update is unknown
+			continue
+		}
+		expArrs = append(expArrs, SQL.EqCL(colDefs[i], v))
 	}
 	return expArrs
 }
 
-func GenInsertSqlsForOneRowsEventRollbackDelete(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, rowsPerSql int, ifprefixDb bool) []string {
-	return GenInsertSqlsForOneRowsEvent(posStr, rEv, colDefs, rowsPerSql, true, ifprefixDb, false, []int{})
+func GenInsertSqlsForOneRowsEventRollbackDelete(posStr string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, rowsPerSql int, ifprefixDb bool, generatedIdx []int) ([]string, error) {
+	return GenInsertSqlsForOneRowsEvent(posStr, rEv, colDefs, rowsPerSql, true, ifprefixDb, false, []int{}, generatedIdx)
 }
 
-func GenUpdateSqlsForOneRowsEvent(posStr string, colsTypeNameFromMysql []string, colsTypeName []string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, ifRollback bool, ifprefixDb bool) []string {
+func GenUpdateSqlsForOneRowsEvent(posStr string, colsTypeNameFromMysql []string, colsTypeName []string, rEv *replication.RowsEvent, colDefs []SQL.NonAliasColumn, uniKey []int, ifFullImage bool, ifRollback bool, ifprefixDb bool, generatedIdx []int) ([]string, error) {
 	//colsTypeNameFromMysql: for text type, which is stored as blob
 	var (
 		rowCnt      int    = len(rEv.Rows)
@@ -311,34 +397,47 @@ func GenUpdateSqlsForOneRowsEvent(posStr string, colsTypeNameFromMysql []string,
 	}
 	for i := 0; i < rowCnt; i += 2 {
 		upSql := SQL.NewTable(table, colDefs...).Update()
+		// only the columns in the after image are updated, with binlog_row_image=MINIMAL or NOBLOB
+		beforePresent := ColumnsInImage(rEv, i)
+		afterPresent := ColumnsInImage(rEv, i+1)
 		if ifRollback {
-			upSql = GenUpdateSetPart(colsTypeNameFromMysql, colsTypeName, upSql, colDefs, rEv.Rows[i], rEv.Rows[i+1], ifFullImage)
-			wherePart = GenEqualConditions(rEv.Rows[i+1], colDefs, uniKey, ifFullImage)
+			upSql = GenUpdateSetPart(colsTypeNameFromMysql, colsTypeName, upSql, colDefs, rEv.Rows[i], rEv.Rows[i+1], ifFullImage, afterPresent, generatedIdx)
+			rowAfter, present := MergeUpdateImages(rEv.Rows[i], beforePresent, rEv.Rows[i+1], afterPresent)
+			wherePart = GenEqualConditions(rowAfter, colDefs, uniKey, ifFullImage, present, generatedIdx)
 		} else {
-			upSql = GenUpdateSetPart(colsTypeNameFromMysql, colsTypeName, upSql, colDefs, rEv.Rows[i+1], rEv.Rows[i], ifFullImage)
-			wherePart = GenEqualConditions(rEv.Rows[i], colDefs, uniKey, ifFullImage)
+			upSql = GenUpdateSetPart(colsTypeNameFromMysql, colsTypeName, upSql, colDefs, rEv.Rows[i+1], rEv.Rows[i], ifFullImage, afterPresent, generatedIdx)
+			wherePart = GenEqualConditions(rEv.Rows[i], colDefs, uniKey, ifFullImage, beforePresent, generatedIdx)
 		}
 
 		upSql.Where(SQL.And(wherePart...))
 		sql, err = upSql.String(schemaInSql)
 		if err != nil {
-			log.Fatalf(fmt.Sprintf("Fail to generate %s sql for %s %s \n\terror: %s\n\trows data:%v\n%v",
-				sqlType, GetAbsTableName(schema, table), posStr, err, rEv.Rows[i], rEv.Rows[i+1]))
-		} else {
-			sqlArr = append(sqlArr, sql)
+			return sqlArr, fmt.Errorf("Fail to generate %s sql for %s %s \n\terror: %s\n\trows data:%v\n%v",
+				sqlType, GetAbsTableName(schema, table), posStr, err, rEv.Rows[i], rEv.Rows[i+1])
 		}
+		sqlArr = append(sqlArr, sql)
 
 	}
 	//fmt.Println(sqlArr)
-	return sqlArr
+	return sqlArr, nil
 
 }
 
-func GenUpdateSetPart(colsTypeNameFromMysql []string, colTypeNames []string, updateSql SQL.UpdateStatement, colDefs []SQL.NonAliasColumn, rowAfter []interface{}, rowBefore []interface{}, ifFullImage bool) SQL.UpdateStatement {
+// GenUpdateSetPart sets the columns to rowAfter, present tells the columns updated, which are logged in the after image.
+// the generated columns in generatedIdx are computed by mysql, they are not set
+func GenUpdateSetPart(colsTypeNameFromMysql []string, colTypeNames []string, updateSql SQL.UpdateStatement, colDefs []SQL.NonAliasColumn, rowAfter []interface{}, rowBefore []interface{}, ifFullImage bool, present []bool, generatedIdx []int) SQL.UpdateStatement {
 
 	ifUpdateCol := false
 	for i, v := range rowAfter {
 		ifUpdateCol = false
+		if !IsColumnInImage(present, i) || toolkits.ContainsInt(generatedIdx, i) {
+			continue
+		}
+		if diffs, ok := v.(JsonDiffVector); ok {
+			// partial json update whose document before it is not logged, the rollback of it is dropped by DropPartialJsonRows
+			updateSql.Set(colDefs[i], JsonDiffExpression(colDefs[i], diffs))
+			continue
+		}
 		//fmt.Printf("type: %s\nbefore: %v\nafter: %v\n", colTypeNames[i], rowBefore[i], v)
 
 		if !ifFullImage {
@@ -361,7 +460,7 @@ func GenUpdateSetPart(colsTypeNameFromMysql []string, colTypeNames []string, upd
 				}
 
 			} else {
-				if v == rowBefore[i] {
+				if IsSameValue(v, rowBefore[i]) {
 					//fmt.Println("compare equal")
 					ifUpdateCol = false
 				} else {
@@ -374,7 +473,7 @@ func GenUpdateSetPart(colsTypeNameFromMysql []string, colTypeNames []string, upd
 		}
 
 		if ifUpdateCol {
-			updateSql.Set(colDefs[i], SQL.Literal(v))
+			updateSql.Set(colDefs[i], SQL.ColumnLiteral(colDefs[i], v))
 		}
 	}
 	return updateSql
@@ -0,0 +1,45 @@
+package base
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConvertEnumSetValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		colType string
+		labels  []string
+		want    interface{}
+	}{
+		{name: "enum label", v: int64(2), colType: "enum", labels: []string{"a", "b", "c"}, want: "b"},
+		{name: "enum first label", v: int64(1), colType: "enum", labels: []string{"a", "b", "c"}, want: "a"},
+		{name: "enum invalid value", v: int64(0), colType: "enum", labels: []string{"a", "b"}, want: ""},
+		{name: "enum index beyond labels", v: int64(3), colType: "enum", labels: []string{"a", "b"}, want: int64(3)},
+		{name: "enum labels unknown", v: int64(1), colType: "enum", want: int64(1)},
+		{name: "set members", v: int64(5), colType: "set", labels: []string{"a", "b", "c"}, want: "a,c"},
+		{name: "set empty", v: int64(0), colType: "set", labels: []string{"a", "b"}, want: ""},
+		{name: "set all members", v: int64(7), colType: "set", labels: []string{"a", "b", "c"}, want: "a,b,c"},
+		{name: "set bit beyond labels", v: int64(8), colType: "set", labels: []string{"a", "b", "c"}, want: int64(8)},
+		{name: "set of 64 members", v: int64(-1 << 63), colType: "set", labels: make64Labels(), want: "m63"},
+		{name: "label with quote", v: int64(2), colType: "enum", labels: []string{"x", "it's"}, want: "it's"},
+		{name: "not decoded as index", v: "a", colType: "enum", labels: []string{"a"}, want: "a"},
+		{name: "null", v: nil, colType: "set", labels: []string{"a"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ConvertEnumSetValue(tt.v, tt.colType, tt.labels); got != tt.want {
+				t.Errorf("ConvertEnumSetValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func make64Labels() []string {
+	labels := make([]string, 64)
+	for i := range labels {
+		labels[i] = "m" + strconv.Itoa(i)
+	}
+	return labels
+}
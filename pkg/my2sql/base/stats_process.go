@@ -1,15 +1,18 @@
 package base
 
 import (
-	//"os"
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"sync"
+	"time"
 
 	//"path/filepath"
 	constvar "my-wails-app/pkg/my2sql/constvar"
 	"my-wails-app/pkg/my2sql/dsql"
 
+	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/replication"
 	"github.com/siddontang/go-log/log"
 )
@@ -17,9 +20,9 @@ import (
 var (
 	//gDdlRegexp *regexp.Regexp = regexp.MustCompile(C_ddlRegexp)
 	Stats_Result_Header_Column_names []string = []string{"binlog", "starttime", "stoptime",
-		"startpos", "stoppos", "inserts", "updates", "deletes", "database", "table"}
+		"startpos", "stoppos", "inserts", "updates", "deletes", "database", "table", "gtids"}
 	Stats_DDL_Header_Column_names        []string = []string{"datetime", "binlog", "startpos", "stoppos", "sql"}
-	Stats_BigLongTrx_Header_Column_names []string = []string{"binlog", "starttime", "stoptime", "startpos", "stoppos", "rows", "duration", "tables"}
+	Stats_BigLongTrx_Header_Column_names []string = []string{"binlog", "starttime", "stoptime", "startpos", "stoppos", "rows", "duration", "gtid", "tables"}
 )
 
 type BinEventStats struct {
@@ -33,6 +36,8 @@ type BinEventStats struct {
 	RowCnt        uint32
 	QuerySql      string        // for type=query
 	ParsedSqlInfo *dsql.SqlInfo // for ddl
+	Gtid          string        // gtid of the transaction
+	TrxIndex      uint64
 }
 
 type OrgSqlPrint struct {
@@ -54,6 +59,7 @@ type BinEventStatsPrint struct {
 	Inserts   uint32
 	Updates   uint32
 	Deletes   uint32
+	Gtids     mysql.GTIDSet // gtids of the transactions, nil if gtid_mode is off
 }
 
 type BigLongTrxInfo struct {
@@ -66,18 +72,19 @@ type BigLongTrxInfo struct {
 	StopPos    uint32
 	RowCnt     uint32                       // total row count for all statement
 	Duration   uint32                       // how long the trx lasts
+	Gtid       string                       // gtid of the transaction
 	Statements map[string]map[string]uint32 // rowcnt for each type statment: insert, update, delete. {db1.tb1:{insert:0, update:2, delete:10}}
 
 }
 
 func GetBigLongTrxPrintHeaderLine(headers []string) string {
-	//{"binlog", "starttime", "stoptime", "startpos", "stoppos", "rows","duration", "tables"}
-	return fmt.Sprintf("%-17s %-19s %-19s %-10s %-10s %-8s %-10s %s\n", ConvertStrArrToIntferfaceArrForPrint(headers)...)
+	//{"binlog", "starttime", "stoptime", "startpos", "stoppos", "rows","duration", "gtid", "tables"}
+	return fmt.Sprintf("%-17s %-19s %-19s %-10s %-10s %-8s %-10s %-40s %s\n", ConvertStrArrToIntferfaceArrForPrint(headers)...)
 }
 
 func GetStatsPrintHeaderLine(headers []string) string {
-	//[binlog, starttime, stoptime, startpos, stoppos, inserts, updates, deletes, database, table,]
-	return fmt.Sprintf("%-17s %-19s %-19s %-10s %-10s %-8s %-8s %-8s %-15s %-20s\n", ConvertStrArrToIntferfaceArrForPrint(headers)...)
+	//[binlog, starttime, stoptime, startpos, stoppos, inserts, updates, deletes, database, table, gtids]
+	return fmt.Sprintf("%-17s %-19s %-19s %-10s %-10s %-8s %-8s %-8s %-15s %-20s %s\n", ConvertStrArrToIntferfaceArrForPrint(headers)...)
 }
 
 func GetDbTbAndQueryAndRowCntFromBinevent(ev *replication.BinlogEvent) (string, string, string, string, uint32) {
@@ -101,7 +108,8 @@ func GetDbTbAndQueryAndRowCntFromBinevent(ev *replication.BinlogEvent) (string,
 		rowCnt = uint32(len(wrEvent.Rows))
 
 	case replication.UPDATE_ROWS_EVENTv1,
-		replication.UPDATE_ROWS_EVENTv2:
+		replication.UPDATE_ROWS_EVENTv2,
+		replication.PARTIAL_UPDATE_ROWS_EVENT:
 
 		wrEvent := ev.Event.(*replication.RowsEvent)
 		db = string(wrEvent.Table.Schema)
@@ -157,10 +165,53 @@ func ProcessBinEventStats(cfg *ConfCmd, wg *sync.WaitGroup) {
 		longTrxSecs     uint32 = uint32(cfg.LongTrxSeconds)
 		dbtbKeyes       []string
 		//ddlSql          string
+		resumed        *CheckpointPart = cfg.ResumedPart(false)
+		lastCheckpoint time.Time       = time.Now()
+		isTrxEnd       bool
 	)
 
+	if resumed != nil {
+		// go on with the stats collected but not printed before the checkpoint
+		lastBinlog = resumed.Binlog
+		lastPrintTime = resumed.PrintTime
+		statsPrintArr = resumed.StatsToPrint(cfg.MysqlType)
+	}
+
+	// in follow mode the stats of a quiet period are printed by the ticker, they may wait for the next event forever otherwise
+	var flushTick <-chan time.Time
+	if cfg.Follow {
+		ticker := time.NewTicker(time.Duration(printInterval) * time.Second)
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
 	log.Info("start thread to analyze statistics from binlog")
-	for st := range cfg.StatChan {
+	for {
+		var (
+			st BinEventStats
+			ok bool
+		)
+		select {
+		case st, ok = <-cfg.StatChan:
+		case <-flushTick:
+			for _, oneSt := range statsPrintArr {
+				cfg.StatFH.WriteString(GetStatsPrintContentLine(oneSt))
+			}
+			statsPrintArr = map[string]*BinEventStatsPrint{}
+			lastPrintTime = 0
+			continue
+		}
+		if !ok {
+			break
+		}
+		if resumed != nil {
+			// it has been written into the stats files before the checkpoint
+			if (mysql.Position{Name: st.Binlog, Pos: st.StopPos}).Compare(resumed.Position()) <= 0 {
+				continue
+			}
+			resumed = nil
+		}
+		isTrxEnd = false
 
 		if lastBinlog != st.Binlog {
 			// new binlog
@@ -187,8 +238,9 @@ func ProcessBinEventStats(cfg *ConfCmd, wg *sync.WaitGroup) {
 
 			// trx cannot spreads in different binlogs
 			if querySql == "begin" {
-				oneBigLong = BigLongTrxInfo{Binlog: st.Binlog, StartPos: st.StartPos, StartTime: 0, RowCnt: 0, Statements: map[string]map[string]uint32{}}
+				oneBigLong = BigLongTrxInfo{Binlog: st.Binlog, StartPos: st.StartPos, StartTime: 0, RowCnt: 0, Gtid: st.Gtid, Statements: map[string]map[string]uint32{}}
 			} else if querySql == "commit" || querySql == "rollback" {
+				isTrxEnd = true
 				if oneBigLong.StartTime > 0 { // the rows event may be skipped by --databases --tables
 					//big and long trx
 					oneBigLong.StopPos = st.StopPos
@@ -237,6 +289,7 @@ func ProcessBinEventStats(cfg *ConfCmd, wg *sync.WaitGroup) {
 				statsPrintArr[oneTbKey].Deletes += st.RowCnt
 			}
 			statsPrintArr[oneTbKey].StopTime = st.Timestamp
+			statsPrintArr[oneTbKey].Gtids = AddGtidToSet(cfg.MysqlType, statsPrintArr[oneTbKey].Gtids, st.Gtid)
 			statsPrintArr[oneTbKey].StopPos = st.StopPos
 		}
 
@@ -253,6 +306,17 @@ func ProcessBinEventStats(cfg *ConfCmd, wg *sync.WaitGroup) {
 		}
 
 		lastBinlog = st.Binlog
+		if cfg.WorkType == "stats" {
+			cfg.SetProgress(mysql.Position{Name: st.Binlog, Pos: st.StopPos})
+		}
+
+		if isTrxEnd && time.Since(lastCheckpoint) >= CheckpointInterval {
+			// the stats not printed yet are saved in the checkpoint instead of being printed now, not to split the print interval
+			if err := SaveStatsCheckpoint(cfg, st, lastPrintTime, statsPrintArr); err != nil {
+				cfg.SetJobError(err)
+			}
+			lastCheckpoint = time.Now()
+		}
 
 	}
 	//print stats
@@ -263,21 +327,40 @@ func ProcessBinEventStats(cfg *ConfCmd, wg *sync.WaitGroup) {
 
 }
 
+// SaveStatsCheckpoint saves the stats part of the checkpoint at the end of the transaction of st,
+// with the time to print stats next and the stats waiting for it
+func SaveStatsCheckpoint(cfg *ConfCmd, st BinEventStats, printTime uint32, statsPrintArr map[string]*BinEventStatsPrint) error {
+	part := &CheckpointPart{Binlog: st.Binlog, Pos: st.StopPos, TrxIndex: st.TrxIndex, PrintTime: printTime}
+	part.SetStatsToPrint(statsPrintArr)
+	for _, fh := range []*os.File{cfg.StatFH, cfg.BiglongFH} {
+		size, err := fh.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return NewEngineError(ErrCategoryOutput, part.Position(), "fail to get size of %s %v", fh.Name(), err)
+		}
+		part.Files = append(part.Files, CheckpointFile{Name: fh.Name(), Binlog: st.Binlog, Size: size})
+	}
+	return cfg.SaveCheckpoint(false, part)
+}
+
 func GetStatsPrintContentLine(st *BinEventStatsPrint) string {
-	//[binlog, starttime, stoptime, startpos, stoppos, inserts, updates, deletes, database, table]
-	return fmt.Sprintf("%-17s %-19s %-19s %-10d %-10d %-8d %-8d %-8d %-15s %-20s\n",
+	//[binlog, starttime, stoptime, startpos, stoppos, inserts, updates, deletes, database, table, gtids]
+	var gtids string
+	if st.Gtids != nil {
+		gtids = st.Gtids.String()
+	}
+	return fmt.Sprintf("%-17s %-19s %-19s %-10d %-10d %-8d %-8d %-8d %-15s %-20s %s\n",
 		st.Binlog, GetDatetimeStr(int64(st.StartTime), int64(0), constvar.DATETIME_FORMAT_NOSPACE),
 		GetDatetimeStr(int64(st.StopTime), int64(0), constvar.DATETIME_FORMAT_NOSPACE),
-		st.StartPos, st.StopPos, st.Inserts, st.Updates, st.Deletes, st.Database, st.Table)
+		st.StartPos, st.StopPos, st.Inserts, st.Updates, st.Deletes, st.Database, st.Table, gtids)
 }
 
 func GetBigLongTrxContentLine(blTrx BigLongTrxInfo) string {
-	//{"binlog", "starttime", "stoptime", "startpos", "stoppos", "rows", "duration", "tables"}
-	return fmt.Sprintf("%-17s %-19s %-19s %-10d %-10d %-8d %-10d %s\n", blTrx.Binlog,
+	//{"binlog", "starttime", "stoptime", "startpos", "stoppos", "rows", "duration", "gtid", "tables"}
+	return fmt.Sprintf("%-17s %-19s %-19s %-10d %-10d %-8d %-10d %-40s %s\n", blTrx.Binlog,
 		GetDatetimeStr(int64(blTrx.StartTime), int64(0), constvar.DATETIME_FORMAT_NOSPACE),
 		GetDatetimeStr(int64(blTrx.StopTime), int64(0), constvar.DATETIME_FORMAT_NOSPACE),
 		blTrx.StartPos, blTrx.StopPos,
-		blTrx.RowCnt, blTrx.Duration, GetBigLongTrxStatementsStr(blTrx.Statements))
+		blTrx.RowCnt, blTrx.Duration, blTrx.Gtid, GetBigLongTrxStatementsStr(blTrx.Statements))
 }
 
 func GetBigLongTrxStatementsStr(st map[string]map[string]uint32) string {
@@ -0,0 +1,42 @@
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProcessBinEventStatsFollow(t *testing.T) {
+	dir := t.TempDir()
+	statFH, err := os.Create(filepath.Join(dir, "binlog_status.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer statFH.Close()
+	cfg := &ConfCmd{Follow: true, PrintInterval: 1, BigTrxRowLimit: 10, LongTrxSeconds: 1,
+		StatChan: make(chan BinEventStats), StatFH: statFH}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go ProcessBinEventStats(cfg, &wg)
+
+	cfg.StatChan <- BinEventStats{Timestamp: 1700000000, Binlog: "mysql-bin.000001", StartPos: 100, StopPos: 200,
+		Database: "db", Table: "tb", RowCnt: 3, QueryType: "insert"}
+	// no more event comes, the stats are printed by the ticker
+	var content []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if content, err = os.ReadFile(statFH.Name()); err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > 0 {
+			break
+		}
+	}
+	close(cfg.StatChan)
+	wg.Wait()
+	if !strings.Contains(string(content), "mysql-bin.000001") {
+		t.Errorf("stats of the quiet period are not printed while following, got %q", content)
+	}
+}
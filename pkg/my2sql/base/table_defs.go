@@ -0,0 +1,155 @@
+package base
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/siddontang/go-log/log"
+)
+
+// offline table definitions: the definitions of the selected tables are dumped into a json file,
+// a json array of TblInfoJson. it is loaded as the snapshot of the table definitions at the start position,
+// the ddls after it are applied as they are read and are not undone from it like the definitions in mysql.
+// with -only-col-from-file the definitions are only taken from it, binlog files can be parsed without mysql
+
+var systemDatabases = []string{"information_schema", "mysql", "performance_schema", "sys"}
+
+// ListTargetTables returns the selected tables in mysql, [database, table] sorted by name
+func (this *ConfCmd) ListTargetTables() ([][2]string, error) {
+	var (
+		args  []interface{}
+		query string = "SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE = 'BASE TABLE'"
+	)
+	if len(this.Databases) > 0 {
+		query += " AND TABLE_SCHEMA IN (?" + strings.Repeat(",?", len(this.Databases)-1) + ")"
+		for _, db := range this.Databases {
+			args = append(args, db)
+		}
+	} else {
+		query += " AND TABLE_SCHEMA NOT IN (?" + strings.Repeat(",?", len(systemDatabases)-1) + ")"
+		for _, db := range systemDatabases {
+			args = append(args, db)
+		}
+	}
+	query += " ORDER BY TABLE_SCHEMA, TABLE_NAME"
+	rows, err := this.FromDB.Query(query, args...)
+	if err != nil {
+		return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to list tables %v", err)
+	}
+	defer rows.Close()
+	var tables [][2]string
+	for rows.Next() {
+		var db, tb string
+		if err = rows.Scan(&db, &tb); err != nil {
+			return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to list tables %v", err)
+		}
+		if this.IsTargetTable(db, tb) {
+			tables = append(tables, [2]string{db, tb})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to list tables %v", err)
+	}
+	return tables, nil
+}
+
+// DumpTableDefs writes the definitions of the selected tables in mysql into DumpTblDefToFile,
+// it returns the count of the tables dumped
+func (this *ConfCmd) DumpTableDefs() (int, error) {
+	if _, err := this.GetFromDB(); err != nil {
+		return 0, err
+	}
+	tables, err := this.ListTargetTables()
+	if err != nil {
+		return 0, err
+	}
+	tbDefs := &TablesColumnsInfo{}
+	var databases []string
+	for _, t := range tables {
+		if len(databases) == 0 || databases[len(databases)-1] != t[0] {
+			databases = append(databases, t[0])
+		}
+	}
+	if _, err = tbDefs.PreloadTableDefs(this, databases); err != nil {
+		return 0, err
+	}
+	defs := make([]*TblInfoJson, 0, len(tables))
+	for _, t := range tables {
+		tb, err := tbDefs.GetTableInfoJson(this, t[0], t[1])
+		if err != nil {
+			// dropped after it is listed
+			log.Warnf("skip table %s: %v", GetAbsTableName(t[0], t[1]), err)
+			continue
+		}
+		defs = append(defs, tb)
+	}
+	if err = WriteTableDefsFile(this.DumpTblDefToFile, defs); err != nil {
+		return 0, err
+	}
+	log.Infof("definitions of %d tables are dumped into %s", len(defs), this.DumpTblDefToFile)
+	return len(defs), nil
+}
+
+// WriteTableDefsFile writes the table definitions into a tmp file then renames it to fileName
+func WriteTableDefsFile(fileName string, defs []*TblInfoJson) error {
+	data, err := json.MarshalIndent(defs, "", "  ")
+	if err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to dump table definitions %v", err)
+	}
+	tmpFile := fileName + ".tmp"
+	if err = os.WriteFile(tmpFile, data, 0644); err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to write file %s %v", tmpFile, err)
+	}
+	if err = os.Rename(tmpFile, fileName); err != nil {
+		return NewEngineError(ErrCategoryOutput, mysql.Position{}, "fail to write file %s %v", fileName, err)
+	}
+	return nil
+}
+
+// ReadTableDefsFile reads the table definitions dumped by DumpTableDefs
+func ReadTableDefsFile(fileName string) ([]*TblInfoJson, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, NewConfigError("fail to read table definition file %s %v", fileName, err)
+	}
+	var defs []*TblInfoJson
+	if err = json.Unmarshal(data, &defs); err != nil {
+		return nil, NewConfigError("invalid table definition file %s %v", fileName, err)
+	}
+	for i, tb := range defs {
+		if tb == nil || tb.Database == "" || tb.Table == "" || len(tb.Columns) == 0 {
+			return nil, NewConfigError("invalid table definition file %s, database, table or columns of definition %d is empty", fileName, i)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return GetAbsTableName(defs[i].Database, defs[i].Table) < GetAbsTableName(defs[j].Database, defs[j].Table)
+	})
+	return defs, nil
+}
+
+// LoadTableDefs loads the table definitions of ReadTblDefJsonFile as the snapshot, nothing is done if it is not set
+func (this *ConfCmd) LoadTableDefs() error {
+	if this.ReadTblDefJsonFile == "" {
+		return nil
+	}
+	defs, err := ReadTableDefsFile(this.ReadTblDefJsonFile)
+	if err != nil {
+		return err
+	}
+	this.TablesColumnsInfo.lock.Lock()
+	defer this.TablesColumnsInfo.lock.Unlock()
+	for _, tb := range defs {
+		if tb.PrimaryKey == nil {
+			tb.PrimaryKey = KeyInfo{}
+		}
+		if tb.UniqueKeys == nil {
+			tb.UniqueKeys = []KeyInfo{}
+		}
+		this.TablesColumnsInfo.setTableVersion(GetAbsTableName(tb.Database, tb.Table), tb)
+	}
+	log.Infof("definitions of %d tables are loaded from %s", len(defs), this.ReadTblDefJsonFile)
+	return nil
+}
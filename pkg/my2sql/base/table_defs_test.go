@@ -0,0 +1,220 @@
+package base
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is mysql for the tests, a query is answered by the result of the longest prefix of it after delay
+type fakeDB struct {
+	lock    sync.Mutex
+	results map[string]fakeResult
+	queries []string
+	delay   time.Duration
+}
+
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (this *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{this}, nil }
+func (this *fakeDB) Driver() driver.Driver                        { return nil }
+
+// open returns the sql.DB of the fake
+func (this *fakeDB) open() *sql.DB {
+	return sql.OpenDB(this)
+}
+
+// queried returns the count of the queries starting with prefix
+func (this *fakeDB) queried(prefix string) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	var cnt int
+	for _, q := range this.queries {
+		if strings.HasPrefix(q, prefix) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (this fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (this fakeConn) Close() error                        { return nil }
+func (this fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (this fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	time.Sleep(this.db.delay)
+	this.db.lock.Lock()
+	defer this.db.lock.Unlock()
+	this.db.queries = append(this.db.queries, query)
+	prefix := ""
+	for p := range this.db.results {
+		if strings.HasPrefix(query, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return nil, errors.New("unknown query " + query)
+	}
+	return &fakeRows{result: this.db.results[prefix]}, nil
+}
+
+type fakeRows struct {
+	result fakeResult
+	next   int
+}
+
+func (this *fakeRows) Columns() []string { return this.result.columns }
+func (this *fakeRows) Close() error      { return nil }
+
+func (this *fakeRows) Next(dest []driver.Value) error {
+	if this.next >= len(this.result.rows) {
+		return io.EOF
+	}
+	copy(dest, this.result.rows[this.next])
+	this.next++
+	return nil
+}
+
+var (
+	showColumnsColumns = []string{"Field", "Type", "Collation", "Null", "Key", "Default", "Extra"}
+	showIndexColumns   = []string{"Table", "Non_unique", "Key_name", "Seq_in_index", "Column_name"}
+	preloadColumns     = []string{"kind", "tb", "col", "col_type", "seq", "idx", "cs", "tb_collation", "extra"}
+)
+
+// fakeMysqlOfT1 is mysql with db.t1: id int unsigned primary key, b varchar(20) unique key uk_b, the charset is utf8mb4
+func fakeMysqlOfT1() *fakeDB {
+	return &fakeDB{results: map[string]fakeResult{
+		"SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES": {columns: []string{"TABLE_SCHEMA", "TABLE_NAME"},
+			rows: [][]driver.Value{{"db", "t1"}}},
+		"SHOW FULL COLUMNS FROM `db`.`t1`": {columns: showColumnsColumns, rows: [][]driver.Value{
+			{"id", "int(10) unsigned", nil, "NO", "PRI", nil, ""},
+			{"b", "varchar(20)", "utf8mb4_general_ci", "YES", "UNI", nil, ""}}},
+		"SELECT IFNULL(TABLE_COLLATION, '')": {columns: []string{"TABLE_COLLATION"}, rows: [][]driver.Value{{"utf8mb4_general_ci"}}},
+		"SHOW INDEX FROM `db`.`t1`": {columns: showIndexColumns, rows: [][]driver.Value{
+			{"t1", "0", "PRIMARY", "1", "id"},
+			{"t1", "0", "uk_b", "1", "b"}}},
+		preloadTableDefsSql: {columns: preloadColumns, rows: [][]driver.Value{
+			{"C", "t1", "id", "int(10) unsigned", "1", "", "", "utf8mb4_general_ci", ""},
+			{"C", "t1", "b", "varchar(20)", "2", "", "utf8mb4", "utf8mb4_general_ci", ""},
+			{"K", "t1", "b", "", "1", "uk_b", "", "", ""},
+			{"K", "t1", "id", "", "1", "PRIMARY", "", "", ""}}},
+	}}
+}
+
+func TestDumpTableDefs(t *testing.T) {
+	fake := fakeMysqlOfT1()
+	fileName := filepath.Join(t.TempDir(), "defs.json")
+	cfg := &ConfCmd{FromDB: fake.open(), DumpTblDefToFile: fileName}
+	cnt, err := cfg.DumpTableDefs()
+	if err != nil || cnt != 1 {
+		t.Fatalf("DumpTableDefs() = %d, %v, want 1 table", cnt, err)
+	}
+	if n := fake.queried("SHOW COLUMNS"); n != 0 {
+		t.Errorf("DumpTableDefs() queries SHOW COLUMNS %d times, want the definitions preloaded", n)
+	}
+	defs, err := ReadTableDefsFile(fileName)
+	if err != nil {
+		t.Fatalf("ReadTableDefsFile() error = %v", err)
+	}
+	want := &TblInfoJson{Database: "db", Table: "t1",
+		Columns:    []FieldInfo{{FieldName: "id", FieldType: "int", IsUnsigned: true}, {FieldName: "b", FieldType: "varchar", Charset: "utf8mb4"}},
+		PrimaryKey: KeyInfo{"id"}, UniqueKeys: []KeyInfo{{"b"}}, UniqueKeyNames: []string{"uk_b"}, Charset: "utf8mb4"}
+	if len(defs) != 1 || !reflect.DeepEqual(defs[0], want) {
+		t.Errorf("definitions read = %+v, want %+v", defs, want)
+	}
+
+	// loaded as the snapshot at the start position
+	loaded := &ConfCmd{ReadTblDefJsonFile: fileName}
+	if err = loaded.LoadTableDefs(); err != nil {
+		t.Fatalf("LoadTableDefs() error = %v", err)
+	}
+	if history := loaded.TablesColumnsInfo.GetTableHistory("db", "t1"); len(history) != 1 || !reflect.DeepEqual(history[0], want) {
+		t.Errorf("history after LoadTableDefs() = %+v", history)
+	}
+}
+
+func TestReadTableDefsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "sorted by name",
+			content: `[{"database":"db","table":"t2","columns":[{"column_name":"a","column_type":"int"}]},
+				{"database":"db","table":"t1","columns":[{"column_name":"a","column_type":"int"}],"primary_key":["a"],"unique_keys":null}]`,
+			want: []string{"db.t1", "db.t2"},
+		},
+		{name: "not json", content: "db.t1", wantErr: true},
+		{name: "no columns", content: `[{"database":"db","table":"t1","columns":[]}]`, wantErr: true},
+		{name: "no table", content: `[{"database":"db","columns":[{"column_name":"a","column_type":"int"}]}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := filepath.Join(t.TempDir(), "defs.json")
+			if err := os.WriteFile(fileName, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			defs, err := ReadTableDefsFile(fileName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadTableDefsFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, tb := range defs {
+				names = append(names, GetAbsTableName(tb.Database, tb.Table))
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("tables = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnlyColFromFile(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "defs.json")
+	def := &TblInfoJson{Database: "db", Table: "t1", Columns: []FieldInfo{{FieldName: "id", FieldType: "int"}}, PrimaryKey: KeyInfo{"id"}}
+	if err := WriteTableDefsFile(fileName, []*TblInfoJson{def}); err != nil {
+		t.Fatal(err)
+	}
+	binlog := filepath.Join(dir, "mysql-bin.000001")
+	if err := os.WriteFile(binlog, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// mysql is not there, a connection to it fails as a connection error instead of the schema error
+	cfg := &ConfCmd{}
+	done, err := cfg.ParseCmdOptions([]string{"-mode", "file", "-start-file", binlog, "-local-binlog-file", binlog, "-output-dir", dir,
+		"-host", "127.0.0.1", "-port", "1", "-read-tbl-def-file", fileName, "-only-col-from-file"})
+	defer cfg.CloseFH()
+	if done || err != nil {
+		t.Fatalf("ParseCmdOptions() = %v, %v", done, err)
+	}
+	if cfg.FromDB != nil {
+		t.Fatalf("ParseCmdOptions() connects to mysql with -only-col-from-file")
+	}
+	if tb, err := cfg.TablesColumnsInfo.GetTableInfoJson(cfg, "db", "t1"); err != nil || !reflect.DeepEqual(tb.Columns, def.Columns) {
+		t.Errorf("GetTableInfoJson(db.t1) = %+v, %v, want the definition in the file", tb, err)
+	}
+	var ee *EngineError
+	if _, err := cfg.TablesColumnsInfo.GetTableInfoJson(cfg, "db", "t2"); !errors.As(err, &ee) || ee.Category != ErrCategorySchema {
+		t.Errorf("GetTableInfoJson(db.t2) error = %v, want a schema error", err)
+	}
+	if cfg.FromDB != nil {
+		t.Errorf("GetTableInfoJson() connects to mysql with -only-col-from-file")
+	}
+}
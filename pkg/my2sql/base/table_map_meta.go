@@ -0,0 +1,195 @@
+package base
+
+import (
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// with binlog_row_metadata=FULL(mysql 8.0.1+, mariadb 10.5+), the table map event has the column names, signedness,
+// charsets, enum/set values and the primary key of the table when the event is written.
+// the table definition is taken from it, mysql is queried only if it is not there
+
+// binaryCollationId is the collation of binary strings, blob and varbinary
+const binaryCollationId = 63
+
+// tableMapInfo is the table definition taken from a table map event, the event is reused by the rows events of the table
+type tableMapInfo struct {
+	tbMap *replication.TableMapEvent
+	info  *TblInfoJson
+}
+
+// HasColumnNames returns true if the table map event has the column names, binlog_row_metadata=FULL
+func HasColumnNames(tbMap *replication.TableMapEvent) bool {
+	return tbMap != nil && len(tbMap.ColumnName) == int(tbMap.ColumnCount) && tbMap.ColumnCount > 0
+}
+
+// GetColumnTypeFromTableMap returns the type of column i like SHOW COLUMNS without length, ex: int, varchar, text.
+// collations is returned by tbMap.CollationMap, nil if it is not in the event
+func GetColumnTypeFromTableMap(tbMap *replication.TableMapEvent, i int, collations map[int]uint64) string {
+	tp := tbMap.ColumnType[i]
+	if tp == mysql.MYSQL_TYPE_STRING && tbMap.ColumnMeta[i] >= 256 {
+		// enum and set are logged as string, the real type is in meta
+		if realTp := byte(tbMap.ColumnMeta[i] >> 8); realTp == mysql.MYSQL_TYPE_ENUM || realTp == mysql.MYSQL_TYPE_SET {
+			tp = realTp
+		}
+	}
+	collation, hasCollation := collations[i]
+	isBinary := hasCollation && collation == binaryCollationId
+	switch tp {
+	case mysql.MYSQL_TYPE_TINY:
+		return "tinyint"
+	case mysql.MYSQL_TYPE_SHORT:
+		return "smallint"
+	case mysql.MYSQL_TYPE_INT24:
+		return "mediumint"
+	case mysql.MYSQL_TYPE_LONG:
+		return "int"
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return "bigint"
+	case mysql.MYSQL_TYPE_NEWDECIMAL, mysql.MYSQL_TYPE_DECIMAL:
+		return "decimal"
+	case mysql.MYSQL_TYPE_FLOAT:
+		return "float"
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return "double"
+	case mysql.MYSQL_TYPE_BIT:
+		return "bit"
+	case mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_TIMESTAMP2:
+		return "timestamp"
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_DATETIME2:
+		return "datetime"
+	case mysql.MYSQL_TYPE_TIME, mysql.MYSQL_TYPE_TIME2:
+		return "time"
+	case mysql.MYSQL_TYPE_DATE, mysql.MYSQL_TYPE_NEWDATE:
+		return "date"
+	case mysql.MYSQL_TYPE_YEAR:
+		return "year"
+	case mysql.MYSQL_TYPE_ENUM:
+		return "enum"
+	case mysql.MYSQL_TYPE_SET:
+		return "set"
+	case mysql.MYSQL_TYPE_BLOB:
+		// meta is the bytes of the length: tinyblob 1, blob 2, mediumblob 3, longblob 4
+		prefix := map[uint16]string{1: "tiny", 3: "medium", 4: "long"}[tbMap.ColumnMeta[i]]
+		if isBinary || !hasCollation {
+			return prefix + "blob"
+		}
+		return prefix + "text"
+	case mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VAR_STRING:
+		if isBinary {
+			return "varbinary"
+		}
+		return "varchar"
+	case mysql.MYSQL_TYPE_STRING:
+		if isBinary {
+			return "binary"
+		}
+		return "char"
+	case mysql.MYSQL_TYPE_JSON:
+		return "json"
+	case mysql.MYSQL_TYPE_GEOMETRY:
+		return "geometry"
+	case mysql.MYSQL_TYPE_VECTOR:
+		return "vector"
+	default:
+		return C_unknownColType
+	}
+}
+
+// GetTblInfoFromTableMap returns the table definition in the table map event, false if there is no column names in it.
+// the unique keys and the generated columns are not in the event, they are taken from the known definition of the same columns if there is one
+func GetTblInfoFromTableMap(tbMap *replication.TableMapEvent, known *TblInfoJson) (*TblInfoJson, bool) {
+	if !HasColumnNames(tbMap) {
+		return nil, false
+	}
+	var (
+		names      []string         = tbMap.ColumnNameString()
+		unsigned   map[int]bool     = tbMap.UnsignedMap()
+		collations map[int]uint64   = tbMap.CollationMap()
+		enumValues map[int][]string = tbMap.EnumStrValueMap()
+		setValues  map[int][]string = tbMap.SetStrValueMap()
+		enumSetCol map[int]uint64   = tbMap.EnumSetCollationMap()
+		visibility map[int]bool     = tbMap.VisibilityMap() // mysql 8.0.23+
+		tb         *TblInfoJson     = &TblInfoJson{Database: string(tbMap.Schema), Table: string(tbMap.Table), FromTableMap: true}
+	)
+	tb.Columns = make([]FieldInfo, len(names))
+	for i, name := range names {
+		tb.Columns[i] = FieldInfo{FieldName: name, FieldType: GetColumnTypeFromTableMap(tbMap, i, collations), IsUnsigned: unsigned[i]}
+		if visible, ok := visibility[i]; ok {
+			tb.Columns[i].IsInvisible = !visible
+		}
+		if collation, ok := collations[i]; ok && collation != binaryCollationId {
+			tb.Columns[i].Charset = GetCharsetOfCollationId(collation)
+		}
+		labels, ok := enumValues[i]
+		if !ok {
+			labels, ok = setValues[i]
+		}
+		if ok {
+			// the labels are in the charset of the column, they are kept in utf8 like SHOW COLUMNS
+			cs := GetCharsetOfCollationId(enumSetCol[i])
+			tb.Columns[i].Charset = cs
+			tb.Columns[i].EnumSetValues = make([]string, len(labels))
+			for li, label := range labels {
+				if str, isStr := ConvertCharsetValue(label, cs).(string); isStr {
+					label = str
+				}
+				tb.Columns[i].EnumSetValues[li] = label
+			}
+		}
+	}
+	tb.PrimaryKey = KeyInfo{}
+	for _, idx := range tbMap.PrimaryKey {
+		if int(idx) < len(names) {
+			tb.PrimaryKey = append(tb.PrimaryKey, names[idx])
+		}
+	}
+	tb.UniqueKeys = []KeyInfo{}
+	tb.UniqueKeyNames = []string{}
+	if known != nil && sameColumnNames(known, names) {
+		for i, f := range known.Columns {
+			tb.Columns[i].IsGenerated = f.IsGenerated
+			tb.Columns[i].IsVirtual = f.IsVirtual
+		}
+		for i, k := range known.UniqueKeys {
+			tb.UniqueKeys = append(tb.UniqueKeys, append(KeyInfo{}, k...))
+			if i < len(known.UniqueKeyNames) {
+				tb.UniqueKeyNames = append(tb.UniqueKeyNames, known.UniqueKeyNames[i])
+			}
+		}
+	}
+	return tb, true
+}
+
+func sameColumnNames(tb *TblInfoJson, names []string) bool {
+	if len(tb.Columns) != len(names) {
+		return false
+	}
+	for i, f := range tb.Columns {
+		if f.FieldName != names[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetTableInfoForRowsEvent returns the definition of the table of the rows event,
+// from its table map event if binlog_row_metadata=FULL, otherwise from GetTableInfoJson
+func (this *TablesColumnsInfo) GetTableInfoForRowsEvent(cfg *ConfCmd, rEv *replication.RowsEvent) (*TblInfoJson, error) {
+	schema, table := string(rEv.Table.Schema), string(rEv.Table.Table)
+	if !HasColumnNames(rEv.Table) {
+		return this.GetTableInfoJson(cfg, schema, table)
+	}
+	tbKey := GetAbsTableName(schema, table)
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if cached, ok := this.tableMapInfos[tbKey]; ok && cached.tbMap == rEv.Table {
+		return cached.info, nil
+	}
+	tb, _ := GetTblInfoFromTableMap(rEv.Table, this.tableInfos[tbKey])
+	if this.tableMapInfos == nil {
+		this.tableMapInfos = map[string]*tableMapInfo{}
+	}
+	this.tableMapInfos[tbKey] = &tableMapInfo{tbMap: rEv.Table, info: tb}
+	return tb, nil
+}
@@ -0,0 +1,124 @@
+package base
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// fullMetadataTableMap is the table map event of db.t2 logged with binlog_row_metadata=FULL:
+// id bigint unsigned primary key, amount int, name varchar utf8mb4, data varbinary, body text gbk, img longblob,
+// st enum('a','b'), tags set('x','y'), hidden int invisible
+func fullMetadataTableMap() *replication.TableMapEvent {
+	return &replication.TableMapEvent{
+		Schema: []byte("db"), Table: []byte("t2"), ColumnCount: 9,
+		ColumnType: []byte{mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR,
+			mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_BLOB, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_STRING, mysql.MYSQL_TYPE_LONG},
+		ColumnMeta: []uint16{0, 0, 80, 20, 2, 4, uint16(mysql.MYSQL_TYPE_ENUM)<<8 | 1, uint16(mysql.MYSQL_TYPE_SET)<<8 | 1, 0},
+		ColumnName: [][]byte{[]byte("id"), []byte("amount"), []byte("name"), []byte("data"), []byte("body"), []byte("img"),
+			[]byte("st"), []byte("tags"), []byte("hidden")},
+		SignednessBitmap:     []byte{0x80},
+		ColumnCharset:        []uint64{255, 63, 28, 63},
+		EnumStrValue:         [][][]byte{{[]byte("a"), []byte("b")}},
+		SetStrValue:          [][][]byte{{[]byte("x"), []byte("y")}},
+		EnumSetColumnCharset: []uint64{255, 255},
+		VisibilityBitmap:     []byte{0xff, 0x00},
+		PrimaryKey:           []uint64{0},
+	}
+}
+
+func TestGetColumnTypeFromTableMap(t *testing.T) {
+	tbMap := fullMetadataTableMap()
+	want := []string{"bigint", "int", "varchar", "varbinary", "text", "longblob", "enum", "set", "int"}
+	collations := tbMap.CollationMap()
+	for i := range want {
+		if got := GetColumnTypeFromTableMap(tbMap, i, collations); got != want[i] {
+			t.Errorf("column %d type = %s, want %s", i, got, want[i])
+		}
+	}
+	// without the collations the character columns are not told from the binary ones
+	withoutCollations := []string{"bigint", "int", "varchar", "varchar", "blob", "longblob", "enum", "set", "int"}
+	for i := range withoutCollations {
+		if got := GetColumnTypeFromTableMap(tbMap, i, nil); got != withoutCollations[i] {
+			t.Errorf("column %d type without collations = %s, want %s", i, got, withoutCollations[i])
+		}
+	}
+}
+
+func TestGetTblInfoFromTableMap(t *testing.T) {
+	tbMap := fullMetadataTableMap()
+	tb, ok := GetTblInfoFromTableMap(tbMap, nil)
+	if !ok {
+		t.Fatal("table map event with column names is not taken")
+	}
+	if !tb.FromTableMap || tb.Database != "db" || tb.Table != "t2" {
+		t.Errorf("table = %s.%s, FromTableMap = %v", tb.Database, tb.Table, tb.FromTableMap)
+	}
+	want := []FieldInfo{
+		{FieldName: "id", FieldType: "bigint", IsUnsigned: true},
+		{FieldName: "amount", FieldType: "int"},
+		{FieldName: "name", FieldType: "varchar", Charset: "utf8mb4"},
+		{FieldName: "data", FieldType: "varbinary"},
+		{FieldName: "body", FieldType: "text", Charset: "gbk"},
+		{FieldName: "img", FieldType: "longblob"},
+		{FieldName: "st", FieldType: "enum", Charset: "utf8mb4", EnumSetValues: []string{"a", "b"}},
+		{FieldName: "tags", FieldType: "set", Charset: "utf8mb4", EnumSetValues: []string{"x", "y"}},
+		{FieldName: "hidden", FieldType: "int", IsInvisible: true},
+	}
+	if !reflect.DeepEqual(tb.Columns, want) {
+		t.Errorf("columns = %+v, want %+v", tb.Columns, want)
+	}
+	if !reflect.DeepEqual(tb.PrimaryKey, KeyInfo{"id"}) {
+		t.Errorf("primary key = %v", tb.PrimaryKey)
+	}
+	if len(tb.UniqueKeys) != 0 {
+		t.Errorf("unique keys = %v without a known definition", tb.UniqueKeys)
+	}
+}
+
+func TestGetTblInfoFromTableMapWithKnown(t *testing.T) {
+	names := []string{"id", "amount", "name", "data", "body", "img", "st", "tags", "hidden"}
+	known := &TblInfoJson{UniqueKeys: []KeyInfo{{"name"}}, UniqueKeyNames: []string{"uk_name"}}
+	for _, name := range names {
+		known.Columns = append(known.Columns, FieldInfo{FieldName: name})
+	}
+	known.Columns[1].IsGenerated, known.Columns[1].IsVirtual = true, true
+
+	tests := []struct {
+		name          string
+		known         *TblInfoJson
+		wantUks       []KeyInfo
+		wantGenerated bool
+	}{
+		{name: "same columns", known: known, wantUks: []KeyInfo{{"name"}}, wantGenerated: true},
+		{name: "columns changed", known: &TblInfoJson{Columns: known.Columns[:8], UniqueKeys: known.UniqueKeys}, wantUks: []KeyInfo{}},
+		{name: "no known definition", wantUks: []KeyInfo{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb, _ := GetTblInfoFromTableMap(fullMetadataTableMap(), tt.known)
+			if !reflect.DeepEqual(tb.UniqueKeys, tt.wantUks) {
+				t.Errorf("unique keys = %v, want %v", tb.UniqueKeys, tt.wantUks)
+			}
+			if tb.Columns[1].IsGenerated != tt.wantGenerated || tb.Columns[1].IsVirtual != tt.wantGenerated {
+				t.Errorf("generated = %v, virtual = %v, want %v", tb.Columns[1].IsGenerated, tb.Columns[1].IsVirtual, tt.wantGenerated)
+			}
+		})
+	}
+	// the unique keys of the new version are not shared with the known one
+	tb, _ := GetTblInfoFromTableMap(fullMetadataTableMap(), known)
+	tb.UniqueKeys[0][0] = "changed"
+	if known.UniqueKeys[0][0] != "name" {
+		t.Errorf("unique keys of the known definition are changed")
+	}
+}
+
+func TestGetTblInfoFromTableMapWithoutNames(t *testing.T) {
+	tbMap := fullMetadataTableMap()
+	tbMap.ColumnName = nil
+	if tb, ok := GetTblInfoFromTableMap(tbMap, nil); ok || tb != nil {
+		t.Errorf("table map event without column names is taken: %+v", tb)
+	}
+}
@@ -1,11 +1,916 @@
 package base
 
 import (
-//	"github.com/openark/golib/log"
- // "github.com/siddontang/go-log/log"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
+	"github.com/siddontang/go-log/log"
 )
 
+// schema history: the table definitions start from a snapshot, which is taken from mysql when a table is met for the first time,
+// then the ddls in the binlogs are applied as they are read. a new version of the definition is created for every ddl,
+// the rows events take the version at their positions when they are dispatched, see MyBinEvent.TbInfo.
+// the definition in mysql is the one after all the ddls in the binlogs, not the one at the position the table is met.
+// so the binlogs are read ahead for the ddls before the job reads them, see ScanDdlsInFiles and ScanDdlsFromRepl,
+// and the ddls after the position are undone from the definition in mysql to make the snapshot, see snapshotTable.
+// a ddl losing what it changes, ex: drop column, can not be undone, the snapshot is the definition after it then.
+// every rows event is checked with its table map event by CheckTableMapWithDefinition, the job fails with ErrCategorySchema
+// if the column count or a column type differs instead of taking the values by the wrong names
+
+const PRIMARY_KEY_NAME = "PRIMARY"
+
+var schemaChangeSqlRegexp = regexp.MustCompile(`(?is)^(create|alter|drop|rename)\b[^(]*?\b(table|index|database|schema)\b`)
+
+// leadingCommentRegexp matches the comments before the sql, ex: /* ApplicationName=DBeaver */ alter table
+var leadingCommentRegexp = regexp.MustCompile(`^(\s*(/\*.*?\*/|--[^\n]*\n|#[^\n]*\n))*\s*`)
+
+// isSchemaChangeSql returns true if sql may change table definitions
+func isSchemaChangeSql(sql string) bool {
+	return schemaChangeSqlRegexp.MatchString(leadingCommentRegexp.ReplaceAllString(sql, ""))
+}
+
+func (this *TblInfoJson) clone() *TblInfoJson {
+	tb := &TblInfoJson{Database: this.Database, Table: this.Table, DdlInfo: this.DdlInfo, Charset: this.Charset}
+	tb.Columns = append([]FieldInfo{}, this.Columns...)
+	tb.PrimaryKey = append(KeyInfo{}, this.PrimaryKey...)
+	tb.UniqueKeys = make([]KeyInfo, len(this.UniqueKeys))
+	for i, k := range this.UniqueKeys {
+		tb.UniqueKeys[i] = append(KeyInfo{}, k...)
+	}
+	tb.UniqueKeyNames = append([]string{}, this.UniqueKeyNames...)
+	return tb
+}
+
+// VersionString tells where the version of the table definition comes from
+func (this *TblInfoJson) VersionString() string {
+	if this.FromTableMap {
+		return "the table structure is taken from the table map event"
+	}
+	if this.DdlInfo == nil && this.notUndone != nil {
+		return fmt.Sprintf("the table structure is taken from mysql, the ddl after the event at %s/%d can not be undone from it: %s",
+			this.notUndone.Binlog, this.notUndone.StartPos, this.notUndone.DdlSql)
+	}
+	if this.DdlInfo == nil {
+		return "the table structure is taken from mysql, it may be changed by ddl after the event"
+	}
+	return fmt.Sprintf("the table structure is changed by ddl at %s/%d: %s", this.DdlInfo.Binlog, this.DdlInfo.StartPos, this.DdlInfo.DdlSql)
+}
+
+func (this *TblInfoJson) columnIndex(name string) int {
+	for i, f := range this.Columns {
+		if strings.EqualFold(f.FieldName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (this *TblInfoJson) uniqueKeyIndex(name string) int {
+	for i, kName := range this.UniqueKeyNames {
+		if strings.EqualFold(kName, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertColumn inserts col at pos, at the end if pos is nil. it returns false if the column after which col is inserted is not found
+func (this *TblInfoJson) insertColumn(col FieldInfo, pos *ast.ColumnPosition) bool {
+	idx := len(this.Columns)
+	if pos != nil {
+		switch pos.Tp {
+		case ast.ColumnPositionFirst:
+			idx = 0
+		case ast.ColumnPositionAfter:
+			idx = this.columnIndex(pos.RelativeColumn.Name.O)
+			if idx < 0 {
+				return false
+			}
+			idx++
+		}
+	}
+	this.Columns = append(this.Columns, FieldInfo{})
+	copy(this.Columns[idx+1:], this.Columns[idx:])
+	this.Columns[idx] = col
+	return true
+}
+
+// renameKeyColumn renames or removes(newName is "") the column in the keys, the keys without columns are removed
+func (this *TblInfoJson) renameKeyColumn(oldName string, newName string) {
+	rename := func(k KeyInfo) KeyInfo {
+		var arr KeyInfo = KeyInfo{}
+		for _, colName := range k {
+			if !strings.EqualFold(colName, oldName) {
+				arr = append(arr, colName)
+			} else if newName != "" {
+				arr = append(arr, newName)
+			}
+		}
+		return arr
+	}
+	this.PrimaryKey = rename(this.PrimaryKey)
+	var (
+		keys  []KeyInfo = []KeyInfo{}
+		names []string  = []string{}
+	)
+	for i, k := range this.UniqueKeys {
+		if k = rename(k); len(k) == 0 {
+			continue
+		}
+		keys = append(keys, k)
+		if i < len(this.UniqueKeyNames) {
+			names = append(names, this.UniqueKeyNames[i])
+		} else {
+			names = append(names, "")
+		}
+	}
+	this.UniqueKeys = keys
+	this.UniqueKeyNames = names
+}
+
+// addKey adds the primary or unique key, the unnamed unique key is named by its first column like mysql
+func (this *TblInfoJson) addKey(name string, isPrimary bool, parts []*ast.IndexPartSpecification) {
+	var key KeyInfo = KeyInfo{}
+	for _, part := range parts {
+		if part.Column == nil {
+			// functional key part, it can not locate rows
+			return
+		}
+		key = append(key, part.Column.Name.O)
+	}
+	if isPrimary {
+		this.PrimaryKey = key
+		return
+	}
+	if name == "" && len(key) > 0 {
+		name = key[0]
+		for i := 2; this.uniqueKeyIndex(name) >= 0; i++ {
+			name = fmt.Sprintf("%s_%d", key[0], i)
+		}
+	}
+	this.UniqueKeys = append(this.UniqueKeys, key)
+	this.UniqueKeyNames = append(this.UniqueKeyNames, name)
+}
+
+func (this *TblInfoJson) dropKey(name string) {
+	if strings.EqualFold(name, PRIMARY_KEY_NAME) {
+		this.PrimaryKey = KeyInfo{}
+		return
+	}
+	if i := this.uniqueKeyIndex(name); i >= 0 {
+		this.UniqueKeys = append(this.UniqueKeys[:i], this.UniqueKeys[i+1:]...)
+		this.UniqueKeyNames = append(this.UniqueKeyNames[:i], this.UniqueKeyNames[i+1:]...)
+	}
+}
+
+// addColumnDef adds the column with its PRIMARY KEY or UNIQUE option
+func (this *TblInfoJson) addColumnDef(colDef *ast.ColumnDef, pos *ast.ColumnPosition) bool {
+	if !this.insertColumn(this.fieldInfoOf(colDef), pos) {
+		return false
+	}
+	this.addColumnKeys(colDef)
+	return true
+}
+
+func (this *TblInfoJson) addColumnKeys(colDef *ast.ColumnDef) {
+	parts := []*ast.IndexPartSpecification{{Column: colDef.Name}}
+	for _, opt := range colDef.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionPrimaryKey:
+			this.addKey(PRIMARY_KEY_NAME, true, parts)
+		case ast.ColumnOptionUniqKey:
+			this.addKey("", false, parts)
+		}
+	}
+}
+
+func (this *TblInfoJson) addConstraint(cons *ast.Constraint) {
+	switch cons.Tp {
+	case ast.ConstraintPrimaryKey:
+		this.addKey(PRIMARY_KEY_NAME, true, cons.Keys)
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		this.addKey(cons.Name, false, cons.Keys)
+	}
+}
+
+// GetFieldInfoFromColumnDef returns the column in the form of SHOW COLUMNS,
+// the charset is empty if it is not in the definition, it is the default charset of the table
+func GetFieldInfoFromColumnDef(colDef *ast.ColumnDef) FieldInfo {
+	tpStr := colDef.Tp.InfoSchemaStr()
+	f := FieldInfo{FieldName: colDef.Name.Name.O, FieldType: GetFiledType(tpStr), IsUnsigned: IsUnsigned(tpStr),
+		EnumSetValues: colDef.Tp.GetElems()}
+	for _, opt := range colDef.Options {
+		if opt.Tp == ast.ColumnOptionGenerated {
+			f.IsGenerated = true
+			f.IsVirtual = !opt.Stored
+		}
+	}
+	if !IsCharacterType(f.FieldType) {
+		return f
+	}
+	f.Charset = colDef.Tp.GetCharset()
+	if f.Charset == "" {
+		f.Charset = GetCharsetOfCollation(colDef.Tp.GetCollate())
+	}
+	for _, opt := range colDef.Options {
+		if opt.Tp == ast.ColumnOptionCollate && f.Charset == "" {
+			f.Charset = GetCharsetOfCollation(opt.StrValue)
+		}
+	}
+	return f
+}
+
+// fieldInfoOf returns the column of colDef in the table, with the default charset of the table
+func (this *TblInfoJson) fieldInfoOf(colDef *ast.ColumnDef) FieldInfo {
+	f := GetFieldInfoFromColumnDef(colDef)
+	if f.Charset == "" && IsCharacterType(f.FieldType) {
+		f.Charset = this.Charset
+	}
+	return f
+}
+
+// setCharsetOption sets the default charset of the table by the table options, all the character columns
+// are converted to it by CONVERT TO CHARACTER SET
+func (this *TblInfoJson) setCharsetOption(options []*ast.TableOption) {
+	var cs string
+	convert := false
+	for _, opt := range options {
+		switch opt.Tp {
+		case ast.TableOptionCharset:
+			if !opt.Default {
+				cs = opt.StrValue
+			}
+			convert = convert || opt.UintValue == ast.TableOptionCharsetWithConvertTo
+		case ast.TableOptionCollate:
+			if cs == "" {
+				cs = GetCharsetOfCollation(opt.StrValue)
+			}
+		}
+	}
+	if cs == "" {
+		return
+	}
+	this.Charset = strings.ToLower(cs)
+	if !convert {
+		return
+	}
+	for i := range this.Columns {
+		if IsCharacterType(this.Columns[i].FieldType) {
+			this.Columns[i].Charset = this.Charset
+		}
+	}
+}
+
+// applyAlterSpec applies one change of alter table, it returns false if the change can not be applied to the definition
+func (this *TblInfoJson) applyAlterSpec(spec *ast.AlterTableSpec) bool {
+	switch spec.Tp {
+	case ast.AlterTableAddColumns:
+		for _, colDef := range spec.NewColumns {
+			if this.columnIndex(colDef.Name.Name.O) >= 0 {
+				log.Warnf("column %s to add is already in %s, the ddl may be applied to the table definition", colDef.Name.Name.O,
+					GetAbsTableName(this.Database, this.Table))
+				continue
+			}
+			if !this.addColumnDef(colDef, spec.Position) {
+				return false
+			}
+		}
+		for _, cons := range spec.NewConstraints {
+			this.addConstraint(cons)
+		}
+	case ast.AlterTableDropColumn:
+		idx := this.columnIndex(spec.OldColumnName.Name.O)
+		if idx < 0 {
+			log.Warnf("column %s to drop is not in %s, the ddl may be applied to the table definition", spec.OldColumnName.Name.O,
+				GetAbsTableName(this.Database, this.Table))
+			return true
+		}
+		this.Columns = append(this.Columns[:idx], this.Columns[idx+1:]...)
+		this.renameKeyColumn(spec.OldColumnName.Name.O, "")
+	case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+		if len(spec.NewColumns) == 0 {
+			return true
+		}
+		colDef := spec.NewColumns[0]
+		oldName := colDef.Name.Name.O
+		if spec.OldColumnName != nil {
+			oldName = spec.OldColumnName.Name.O
+		}
+		idx := this.columnIndex(oldName)
+		if idx < 0 {
+			if this.columnIndex(colDef.Name.Name.O) >= 0 {
+				log.Warnf("column %s to change is not in %s, the ddl may be applied to the table definition", oldName,
+					GetAbsTableName(this.Database, this.Table))
+				return true
+			}
+			return false
+		}
+		if spec.Position == nil || spec.Position.Tp == ast.ColumnPositionNone {
+			this.Columns[idx] = this.fieldInfoOf(colDef)
+		} else {
+			this.Columns = append(this.Columns[:idx], this.Columns[idx+1:]...)
+			if !this.insertColumn(this.fieldInfoOf(colDef), spec.Position) {
+				return false
+			}
+		}
+		if !strings.EqualFold(oldName, colDef.Name.Name.O) {
+			this.renameKeyColumn(oldName, colDef.Name.Name.O)
+		}
+		this.addColumnKeys(colDef)
+	case ast.AlterTableRenameColumn:
+		idx := this.columnIndex(spec.OldColumnName.Name.O)
+		if idx < 0 {
+			return this.columnIndex(spec.NewColumnName.Name.O) >= 0
+		}
+		this.Columns[idx].FieldName = spec.NewColumnName.Name.O
+		this.renameKeyColumn(spec.OldColumnName.Name.O, spec.NewColumnName.Name.O)
+	case ast.AlterTableAddConstraint:
+		this.addConstraint(spec.Constraint)
+	case ast.AlterTableDropPrimaryKey:
+		this.dropKey(PRIMARY_KEY_NAME)
+	case ast.AlterTableDropIndex:
+		this.dropKey(spec.Name)
+	case ast.AlterTableRenameIndex:
+		if i := this.uniqueKeyIndex(spec.FromKey.O); i >= 0 {
+			this.UniqueKeyNames[i] = spec.ToKey.O
+		}
+	case ast.AlterTableOption:
+		this.setCharsetOption(spec.Options)
+	}
+	return true
+}
+
+// setTableVersion, dropTableVersion and forgetTable are called with this.lock held
+func (this *TablesColumnsInfo) setTableVersion(tbKey string, tb *TblInfoJson) {
+	if this.tableInfos == nil {
+		this.tableInfos = map[string]*TblInfoJson{}
+	}
+	if this.history == nil {
+		this.history = map[string][]*TblInfoJson{}
+	}
+	this.tableInfos[tbKey] = tb
+	this.history[tbKey] = append(this.history[tbKey], tb)
+	delete(this.dropped, tbKey)
+}
+
+func (this *TablesColumnsInfo) dropTableVersion(tbKey string, ddlInfo *DdlPosInfo) {
+	if this.dropped == nil {
+		this.dropped = map[string]*DdlPosInfo{}
+	}
+	delete(this.tableInfos, tbKey)
+	this.dropped[tbKey] = ddlInfo
+}
+
+// forgetTable removes the definition, it is taken from mysql again when the table is met
+func (this *TablesColumnsInfo) forgetTable(tbKey string) {
+	delete(this.tableInfos, tbKey)
+	delete(this.dropped, tbKey)
+	delete(this.fetches, tbKey)
+}
+
+// GetTableHistory returns the versions of the table definition from the oldest,
+// the first one is the snapshot if the table is not created in the binlogs
+func (this *TablesColumnsInfo) GetTableHistory(schema string, table string) []*TblInfoJson {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	return this.history[GetAbsTableName(schema, table)]
+}
+
+// parseDdl parses the sql of the query event, tbKeyOf returns db.tb of a table in it, the database of the event is the default one
+func parseDdl(qEv *replication.QueryEvent) ([]ast.StmtNode, func(*ast.TableName) string, error) {
+	stmts, _, err := parser.New().Parse(string(qEv.Query), "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defaultDb := string(qEv.Schema)
+	tbKeyOf := func(tn *ast.TableName) string {
+		if tn.Schema.O != "" {
+			return GetAbsTableName(tn.Schema.O, tn.Name.O)
+		}
+		return GetAbsTableName(defaultDb, tn.Name.O)
+	}
+	return stmts, tbKeyOf, nil
+}
+
+// ApplyQueryEvent applies the ddl of the query event to the table definitions, pos is the start position of the event
+func (this *TablesColumnsInfo) ApplyQueryEvent(qEv *replication.QueryEvent, pos mysql.Position, stopPos uint32) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.passPendingDdls(pos)
+	sql := string(qEv.Query)
+	if !isSchemaChangeSql(sql) {
+		return
+	}
+	stmts, tbKeyOf, err := parseDdl(qEv)
+	if err != nil {
+		log.Warnf("fail to parse ddl at %s, the table definitions are not changed by it: %v. %s", pos.String(), err, sql)
+		return
+	}
+	ddlInfo := &DdlPosInfo{Binlog: pos.Name, StartPos: pos.Pos, StopPos: stopPos, DdlSql: sql}
+	for _, stmt := range stmts {
+		switch st := stmt.(type) {
+		case *ast.CreateTableStmt:
+			this.applyCreateTable(st, tbKeyOf, ddlInfo)
+		case *ast.AlterTableStmt:
+			this.applyAlterTable(st, tbKeyOf, ddlInfo)
+		case *ast.RenameTableStmt:
+			for _, t2t := range st.TableToTables {
+				this.renameTable(tbKeyOf(t2t.OldTable), tbKeyOf(t2t.NewTable), ddlInfo)
+			}
+		case *ast.DropTableStmt:
+			if st.IsView || st.TemporaryKeyword != ast.TemporaryNone {
+				continue
+			}
+			for _, tn := range st.Tables {
+				this.dropTableVersion(tbKeyOf(tn), ddlInfo)
+				log.Infof("table %s is dropped at %s", tbKeyOf(tn), pos.String())
+			}
+		case *ast.DropDatabaseStmt:
+			for tbKey := range this.tableInfos {
+				if db, _ := GetDbTbFromAbsTbName(tbKey); db == st.Name.O {
+					this.dropTableVersion(tbKey, ddlInfo)
+				}
+			}
+		case *ast.CreateIndexStmt:
+			if st.KeyType != ast.IndexKeyTypeUnique {
+				continue
+			}
+			this.alterTable(tbKeyOf(st.Table), ddlInfo, func(tb *TblInfoJson) bool {
+				tb.addKey(st.IndexName, false, st.IndexPartSpecifications)
+				return true
+			})
+		case *ast.DropIndexStmt:
+			this.alterTable(tbKeyOf(st.Table), ddlInfo, func(tb *TblInfoJson) bool {
+				tb.dropKey(st.IndexName)
+				return true
+			})
+		}
+	}
+}
+
+func (this *TablesColumnsInfo) applyCreateTable(st *ast.CreateTableStmt, tbKeyOf func(*ast.TableName) string, ddlInfo *DdlPosInfo) {
+	if st.TemporaryKeyword != ast.TemporaryNone {
+		return
+	}
+	tbKey := tbKeyOf(st.Table)
+	if _, ok := this.tableInfos[tbKey]; ok && st.IfNotExists {
+		return
+	}
+	db, tbName := GetDbTbFromAbsTbName(tbKey)
+	var tb *TblInfoJson
+	if st.ReferTable != nil {
+		refer, ok := this.tableInfos[tbKeyOf(st.ReferTable)]
+		if !ok {
+			this.forgetTable(tbKey)
+			return
+		}
+		tb = refer.clone()
+		tb.Database, tb.Table = db, tbName
+	} else if st.Select != nil {
+		// the columns from the select are unknown
+		this.forgetTable(tbKey)
+		return
+	} else {
+		tb = &TblInfoJson{Database: db, Table: tbName, Columns: []FieldInfo{},
+			PrimaryKey: KeyInfo{}, UniqueKeys: []KeyInfo{}, UniqueKeyNames: []string{}}
+		tb.setCharsetOption(st.Options)
+		for _, colDef := range st.Cols {
+			tb.addColumnDef(colDef, nil)
+		}
+		for _, cons := range st.Constraints {
+			tb.addConstraint(cons)
+		}
+	}
+	tb.DdlInfo = ddlInfo
+	this.setTableVersion(tbKey, tb)
+	log.Infof("table %s is created at %s/%d", tbKey, ddlInfo.Binlog, ddlInfo.StartPos)
+}
+
+func (this *TablesColumnsInfo) applyAlterTable(st *ast.AlterTableStmt, tbKeyOf func(*ast.TableName) string, ddlInfo *DdlPosInfo) {
+	tbKey := tbKeyOf(st.Table)
+	var newTbKey string
+	ok := this.alterTable(tbKey, ddlInfo, func(tb *TblInfoJson) bool {
+		for _, spec := range st.Specs {
+			if spec.Tp == ast.AlterTableRenameTable {
+				newTbKey = tbKeyOf(spec.NewTable)
+				continue
+			}
+			if !tb.applyAlterSpec(spec) {
+				return false
+			}
+		}
+		return true
+	})
+	if !ok {
+		for _, spec := range st.Specs {
+			if spec.Tp == ast.AlterTableRenameTable {
+				newTbKey = tbKeyOf(spec.NewTable)
+			}
+		}
+	}
+	if newTbKey != "" {
+		this.renameTable(tbKey, newTbKey, ddlInfo)
+	}
+}
+
+// alterTable applies change to a copy of the table definition and makes it the new version,
+// the versions taken by the events dispatched before are not changed.
+// the table is forgotten if change fails, it returns false if the table is not known or forgotten
+func (this *TablesColumnsInfo) alterTable(tbKey string, ddlInfo *DdlPosInfo, change func(tb *TblInfoJson) bool) bool {
+	old, ok := this.tableInfos[tbKey]
+	if !ok {
+		// the definition is taken from mysql when the table is met, it has been changed by the ddl
+		return false
+	}
+	tb := old.clone()
+	if !change(tb) {
+		log.Warnf("fail to apply ddl at %s/%d to the table definition of %s, it is taken from mysql again. %s",
+			ddlInfo.Binlog, ddlInfo.StartPos, tbKey, ddlInfo.DdlSql)
+		this.forgetTable(tbKey)
+		return false
+	}
+	tb.DdlInfo = ddlInfo
+	this.setTableVersion(tbKey, tb)
+	log.Infof("table %s is altered at %s/%d", tbKey, ddlInfo.Binlog, ddlInfo.StartPos)
+	return true
+}
+
+func (this *TablesColumnsInfo) renameTable(oldTbKey string, newTbKey string, ddlInfo *DdlPosInfo) {
+	old, ok := this.tableInfos[oldTbKey]
+	if !ok {
+		this.forgetTable(newTbKey)
+		return
+	}
+	tb := old.clone()
+	tb.Database, tb.Table = GetDbTbFromAbsTbName(newTbKey)
+	tb.DdlInfo = ddlInfo
+	this.dropTableVersion(oldTbKey, ddlInfo)
+	this.setTableVersion(newTbKey, tb)
+	log.Infof("table %s is renamed to %s at %s/%d", oldTbKey, newTbKey, ddlInfo.Binlog, ddlInfo.StartPos)
+}
+
+// pendingDdl is a ddl after the events read so far, it is found by reading the binlogs ahead
+type pendingDdl struct {
+	pos     mysql.Position
+	ddlInfo *DdlPosInfo
+	stmts   []ast.StmtNode
+	tbKeyOf func(*ast.TableName) string
+}
+
+// tableChange is a statement of a pending ddl changing the definition of one table
+type tableChange struct {
+	ddl  *pendingDdl
+	stmt ast.StmtNode
+}
+
+// addPendingDdl keeps the ddl of the query event read ahead, pos is the start position of the event.
+// the ddls are added in the order of the binlogs before the job reads them, ApplyQueryEvent passes them as they are read
+func (this *TablesColumnsInfo) addPendingDdl(qEv *replication.QueryEvent, pos mysql.Position, stopPos uint32) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	sql := string(qEv.Query)
+	if !isSchemaChangeSql(sql) {
+		return
+	}
+	stmts, tbKeyOf, err := parseDdl(qEv)
+	if err != nil {
+		// ApplyQueryEvent warns about it when it is read
+		return
+	}
+	this.pendingDdls = append(this.pendingDdls, &pendingDdl{pos: pos, stmts: stmts, tbKeyOf: tbKeyOf,
+		ddlInfo: &DdlPosInfo{Binlog: pos.Name, StartPos: pos.Pos, StopPos: stopPos, DdlSql: sql}})
+}
+
+// passPendingDdls removes the pending ddls up to pos, they are read by the job. it is called with this.lock held
+func (this *TablesColumnsInfo) passPendingDdls(pos mysql.Position) {
+	for len(this.pendingDdls) > 0 && this.pendingDdls[0].pos.Compare(pos) <= 0 {
+		this.pendingDdls = this.pendingDdls[1:]
+	}
+}
+
+// isChangedByPendingDdls returns true if the table is named in one of the pending ddls, the definition in mysql
+// may not be the one at the position read so far then. it is called with this.lock held
+func (this *TablesColumnsInfo) isChangedByPendingDdls(tbKey string) bool {
+	db, _ := GetDbTbFromAbsTbName(tbKey)
+	for _, ddl := range this.pendingDdls {
+		var names []*ast.TableName
+		for _, stmt := range ddl.stmts {
+			switch st := stmt.(type) {
+			case *ast.AlterTableStmt:
+				names = append(names, st.Table)
+				for _, spec := range st.Specs {
+					if spec.Tp == ast.AlterTableRenameTable {
+						names = append(names, spec.NewTable)
+					}
+				}
+			case *ast.RenameTableStmt:
+				for _, t2t := range st.TableToTables {
+					names = append(names, t2t.OldTable, t2t.NewTable)
+				}
+			case *ast.CreateIndexStmt:
+				names = append(names, st.Table)
+			case *ast.DropTableStmt:
+				names = append(names, st.Tables...)
+			case *ast.CreateTableStmt:
+				names = append(names, st.Table)
+			case *ast.DropDatabaseStmt:
+				if st.Name.O == db {
+					return true
+				}
+			}
+		}
+		for _, tn := range names {
+			if ddl.tbKeyOf(tn) == tbKey {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pendingChangesOf returns the changes of the table by the pending ddls, the table is named liveKey after them.
+// dropped is the ddl the table is dropped by, the definition in mysql is not the one of the table then.
+// it is called with this.lock held
+func (this *TablesColumnsInfo) pendingChangesOf(tbKey string) (liveKey string, changes []tableChange, dropped *DdlPosInfo) {
+	liveKey = tbKey
+	for _, ddl := range this.pendingDdls {
+		for _, stmt := range ddl.stmts {
+			switch st := stmt.(type) {
+			case *ast.AlterTableStmt:
+				if ddl.tbKeyOf(st.Table) != liveKey {
+					continue
+				}
+				changes = append(changes, tableChange{ddl: ddl, stmt: st})
+				for _, spec := range st.Specs {
+					if spec.Tp == ast.AlterTableRenameTable {
+						liveKey = ddl.tbKeyOf(spec.NewTable)
+					}
+				}
+			case *ast.RenameTableStmt:
+				for _, t2t := range st.TableToTables {
+					if ddl.tbKeyOf(t2t.OldTable) == liveKey {
+						liveKey = ddl.tbKeyOf(t2t.NewTable)
+					}
+				}
+			case *ast.CreateIndexStmt:
+				if ddl.tbKeyOf(st.Table) == liveKey {
+					changes = append(changes, tableChange{ddl: ddl, stmt: st})
+				}
+			case *ast.DropTableStmt:
+				if st.IsView || st.TemporaryKeyword != ast.TemporaryNone {
+					continue
+				}
+				for _, tn := range st.Tables {
+					if ddl.tbKeyOf(tn) == liveKey {
+						return liveKey, changes, ddl.ddlInfo
+					}
+				}
+			case *ast.DropDatabaseStmt:
+				if db, _ := GetDbTbFromAbsTbName(liveKey); db == st.Name.O {
+					return liveKey, changes, ddl.ddlInfo
+				}
+			case *ast.CreateTableStmt:
+				if st.TemporaryKeyword == ast.TemporaryNone && !st.IfNotExists && ddl.tbKeyOf(st.Table) == liveKey {
+					// the table is dropped before, by a ddl not read ahead
+					return liveKey, changes, ddl.ddlInfo
+				}
+			}
+		}
+	}
+	return liveKey, changes, nil
+}
+
+// snapshotTable makes the first version of the table definition, the one at the position read so far.
+// fetch returns the definition in mysql, nil if the table is not there, it is called without this.lock held.
+// the changes of the pending ddls are undone from it from the latest, if one of them can not be undone,
+// the snapshot is the definition after it
+func (this *TablesColumnsInfo) snapshotTable(tbKey string, fetch func(schema string, table string) (*TblInfoJson, error)) (*TblInfoJson, error) {
+	// the pending ddls are passed by the reader, which meets the tables and takes their snapshots before the ddls after
+	this.lock.RLock()
+	liveKey, changes, dropped := this.pendingChangesOf(tbKey)
+	this.lock.RUnlock()
+	if dropped != nil {
+		// the table in mysql is another one, the definition before the drop is lost
+		liveKey, changes = tbKey, nil
+	}
+	live, err := fetch(GetDbTbFromAbsTbName(liveKey))
+	if err != nil {
+		return nil, err
+	}
+	if live == nil {
+		return nil, NewEngineError(ErrCategorySchema, mysql.Position{},
+			"table struct not found for %s, maybe it was dropped. Skip it", liveKey)
+	}
+	tb := live.clone()
+	tb.Database, tb.Table = GetDbTbFromAbsTbName(tbKey)
+	tb.DdlInfo = nil
+	tb.notUndone = dropped
+	undone := 0
+	for i := len(changes) - 1; i >= 0; i-- {
+		if !tb.undoTableChange(changes[i].stmt) {
+			tb.notUndone = changes[i].ddl.ddlInfo
+			break
+		}
+		undone++
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if known, ok := this.tableInfos[tbKey]; ok {
+		// created by a ddl while it is fetched
+		return known, nil
+	}
+	if ddlInfo, ok := this.dropped[tbKey]; ok {
+		return nil, NewEngineError(ErrCategorySchema, mysql.Position{},
+			"table %s was dropped or renamed at %s/%d by: %s", tbKey, ddlInfo.Binlog, ddlInfo.StartPos, ddlInfo.DdlSql)
+	}
+	if tb.notUndone != nil {
+		log.Warnf("the definition of %s before the ddl at %s/%d can not be taken from mysql, the one after it is used. %s",
+			tbKey, tb.notUndone.Binlog, tb.notUndone.StartPos, tb.notUndone.DdlSql)
+	} else if undone > 0 {
+		log.Infof("table %s is taken from mysql as %s, %d ddls after are undone", tbKey, liveKey, undone)
+	}
+	// the snapshot, the ddls after it make new versions
+	this.setTableVersion(tbKey, tb)
+	return tb, nil
+}
+
+// undoTableChange undoes the change of the table by the statement, it returns false if what is changed is lost, ex: drop column
+func (this *TblInfoJson) undoTableChange(stmt ast.StmtNode) bool {
+	switch st := stmt.(type) {
+	case *ast.AlterTableStmt:
+		for i := len(st.Specs) - 1; i >= 0; i-- {
+			if !this.undoAlterSpec(st.Specs[i]) {
+				return false
+			}
+		}
+	case *ast.CreateIndexStmt:
+		if st.KeyType == ast.IndexKeyTypeUnique {
+			this.undoUniqueKey(st.IndexName, st.IndexPartSpecifications)
+		}
+	}
+	return true
+}
+
+// undoAlterSpec undoes one change of alter table, see applyAlterSpec.
+// the keys dropped are unknown, they are left out, the rows are located by the other keys or all the columns then
+func (this *TblInfoJson) undoAlterSpec(spec *ast.AlterTableSpec) bool {
+	switch spec.Tp {
+	case ast.AlterTableAddColumns:
+		for i := len(spec.NewConstraints) - 1; i >= 0; i-- {
+			this.undoConstraint(spec.NewConstraints[i])
+		}
+		for i := len(spec.NewColumns) - 1; i >= 0; i-- {
+			name := spec.NewColumns[i].Name.Name.O
+			idx := this.columnIndex(name)
+			if idx < 0 {
+				return false
+			}
+			this.Columns = append(this.Columns[:idx], this.Columns[idx+1:]...)
+			this.renameKeyColumn(name, "")
+		}
+	case ast.AlterTableDropColumn:
+		// the column dropped is unknown
+		return false
+	case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+		if len(spec.NewColumns) == 0 {
+			return true
+		}
+		if spec.Position != nil && spec.Position.Tp != ast.ColumnPositionNone {
+			// where the column was is unknown
+			return false
+		}
+		colDef := spec.NewColumns[0]
+		idx := this.columnIndex(colDef.Name.Name.O)
+		if idx < 0 {
+			return false
+		}
+		this.undoColumnKeys(colDef)
+		// the type before is unknown, the one after is kept, CheckTableMapWithDefinition finds it if it is logged differently
+		if spec.OldColumnName != nil && !strings.EqualFold(spec.OldColumnName.Name.O, colDef.Name.Name.O) {
+			this.Columns[idx].FieldName = spec.OldColumnName.Name.O
+			this.renameKeyColumn(colDef.Name.Name.O, spec.OldColumnName.Name.O)
+		}
+	case ast.AlterTableRenameColumn:
+		idx := this.columnIndex(spec.NewColumnName.Name.O)
+		if idx < 0 {
+			return false
+		}
+		this.Columns[idx].FieldName = spec.OldColumnName.Name.O
+		this.renameKeyColumn(spec.NewColumnName.Name.O, spec.OldColumnName.Name.O)
+	case ast.AlterTableAddConstraint:
+		this.undoConstraint(spec.Constraint)
+	case ast.AlterTableRenameIndex:
+		if i := this.uniqueKeyIndex(spec.ToKey.O); i >= 0 {
+			this.UniqueKeyNames[i] = spec.FromKey.O
+		}
+	}
+	return true
+}
+
+// undoConstraint removes the primary or unique key added by cons
+func (this *TblInfoJson) undoConstraint(cons *ast.Constraint) {
+	switch cons.Tp {
+	case ast.ConstraintPrimaryKey:
+		this.PrimaryKey = KeyInfo{}
+	case ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		this.undoUniqueKey(cons.Name, cons.Keys)
+	}
+}
 
+// undoColumnKeys removes the keys added by the PRIMARY KEY or UNIQUE option of the column
+func (this *TblInfoJson) undoColumnKeys(colDef *ast.ColumnDef) {
+	for _, opt := range colDef.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionPrimaryKey:
+			this.PrimaryKey = KeyInfo{}
+		case ast.ColumnOptionUniqKey:
+			this.undoUniqueKey("", []*ast.IndexPartSpecification{{Column: colDef.Name}})
+		}
+	}
+}
 
+// undoUniqueKey removes the unique key added by name or, if it is not named, the last one of the columns
+func (this *TblInfoJson) undoUniqueKey(name string, parts []*ast.IndexPartSpecification) {
+	if name != "" {
+		this.dropKey(name)
+		return
+	}
+	var key KeyInfo = KeyInfo{}
+	for _, part := range parts {
+		if part.Column == nil {
+			// functional key part, the key is not added
+			return
+		}
+		key = append(key, part.Column.Name.O)
+	}
+	for i := len(this.UniqueKeys) - 1; i >= 0; i-- {
+		if strings.EqualFold(strings.Join(this.UniqueKeys[i], ","), strings.Join(key, ",")) {
+			this.UniqueKeys = append(this.UniqueKeys[:i], this.UniqueKeys[i+1:]...)
+			if i < len(this.UniqueKeyNames) {
+				this.UniqueKeyNames = append(this.UniqueKeyNames[:i], this.UniqueKeyNames[i+1:]...)
+			}
+			return
+		}
+	}
+}
 
+// columnTypeClass returns the type of column like SHOW COLUMNS in the way it is logged in binlog:
+// text and blob, char and binary, varchar and varbinary, the geometry types are the same there.
+// "" is returned for the types which are not known
+func columnTypeClass(tp string) string {
+	// mysql 8.0 has no display width, ex: int unsigned
+	if fields := strings.Fields(strings.ToLower(tp)); len(fields) > 0 {
+		tp = fields[0]
+	}
+	switch tp {
+	case "integer":
+		return "int"
+	case "numeric", "fixed":
+		return "decimal"
+	case "real":
+		return "double"
+	case "tinytext", "text", "mediumtext", "longtext":
+		return strings.Replace(tp, "text", "blob", 1)
+	case "varbinary":
+		return "varchar"
+	case "binary":
+		return "char"
+	case "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection", "geomcollection":
+		return "geometry"
+	case "tinyint", "smallint", "mediumint", "int", "bigint", "decimal", "float", "double", "bit",
+		"timestamp", "datetime", "time", "date", "year", "enum", "set",
+		"tinyblob", "blob", "mediumblob", "longblob", "varchar", "char", "json", "geometry", "vector":
+		return tp
+	default:
+		return ""
+	}
+}
 
+// CheckTableMapWithDefinition returns an error if the columns of the table map event are not the columns of tb:
+// the count of them or the type of one of them differs. the rows of the event can not be taken by the names of tb then,
+// ex: the ddl after the event is not undone from the definition in mysql. the definition taken from it is not checked
+func CheckTableMapWithDefinition(tbMap *replication.TableMapEvent, tb *TblInfoJson) error {
+	if tb.FromTableMap {
+		return nil
+	}
+	if int(tbMap.ColumnCount) != len(tb.Columns) {
+		return fmt.Errorf("column count %d in binlog != %d in table structure", tbMap.ColumnCount, len(tb.Columns))
+	}
+	for i := range tb.Columns {
+		logged := columnTypeClass(GetColumnTypeFromTableMap(tbMap, i, nil))
+		defined := columnTypeClass(GetFiledType(tb.Columns[i].FieldType))
+		if logged == "" || defined == "" || logged == defined {
+			continue
+		}
+		return fmt.Errorf("column %d %s is %s in binlog but %s in table structure",
+			i+1, tb.Columns[i].FieldName, GetColumnTypeFromTableMap(tbMap, i, nil), tb.Columns[i].FieldType)
+	}
+	return nil
+}
@@ -0,0 +1,555 @@
+package base
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+)
+
+// snapshotT1 is db.t1 taken from mysql: id int primary key, a int, b varchar(20) unique key uk_b
+func snapshotT1() *TblInfoJson {
+	return &TblInfoJson{Database: "db", Table: "t1", Charset: "utf8mb4",
+		Columns: []FieldInfo{
+			{FieldName: "id", FieldType: "int"},
+			{FieldName: "a", FieldType: "int"},
+			{FieldName: "b", FieldType: "varchar", Charset: "utf8mb4"},
+		},
+		PrimaryKey: KeyInfo{"id"}, UniqueKeys: []KeyInfo{{"b"}}, UniqueKeyNames: []string{"uk_b"}}
+}
+
+func columnNames(tb *TblInfoJson) []string {
+	names := []string{}
+	for _, f := range tb.Columns {
+		names = append(names, f.FieldName)
+	}
+	return names
+}
+
+func applyDdls(tc *TablesColumnsInfo, ddls ...string) {
+	for i, ddl := range ddls {
+		qEv := &replication.QueryEvent{Schema: []byte("db"), Query: []byte(ddl)}
+		tc.ApplyQueryEvent(qEv, mysql.Position{Name: "mysql-bin.000001", Pos: uint32(1000 * (i + 1))}, uint32(1000*(i+1)+500))
+	}
+}
+
+func TestApplyQueryEvent(t *testing.T) {
+	tests := []struct {
+		name        string
+		ddls        []string
+		table       string
+		wantColumns []string
+		wantTypes   []string
+		wantPk      KeyInfo
+		wantUks     []KeyInfo
+		wantDropped []string
+	}{
+		{
+			name:        "add column",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN c datetime"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b", "c"},
+			wantTypes:   []string{"int", "int", "varchar", "datetime"},
+		},
+		{
+			name:        "add column after",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN c bigint AFTER a"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "c", "b"},
+			wantTypes:   []string{"int", "int", "bigint", "varchar"},
+		},
+		{
+			name:        "add column first",
+			ddls:        []string{"ALTER TABLE db.t1 ADD COLUMN c int FIRST"},
+			table:       "t1",
+			wantColumns: []string{"c", "id", "a", "b"},
+		},
+		{
+			name:        "add columns",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN (c int, d text)"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b", "c", "d"},
+			wantTypes:   []string{"int", "int", "varchar", "int", "text"},
+		},
+		{
+			name:        "drop column",
+			ddls:        []string{"ALTER TABLE t1 DROP COLUMN a"},
+			table:       "t1",
+			wantColumns: []string{"id", "b"},
+		},
+		{
+			name:        "drop column of unique key",
+			ddls:        []string{"ALTER TABLE t1 DROP COLUMN b"},
+			table:       "t1",
+			wantColumns: []string{"id", "a"},
+			wantUks:     []KeyInfo{},
+		},
+		{
+			name:        "change column",
+			ddls:        []string{"ALTER TABLE t1 CHANGE COLUMN b bb varchar(40)"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "bb"},
+			wantUks:     []KeyInfo{{"bb"}},
+		},
+		{
+			name:        "change column after",
+			ddls:        []string{"ALTER TABLE t1 CHANGE a aa bigint AFTER b"},
+			table:       "t1",
+			wantColumns: []string{"id", "b", "aa"},
+			wantTypes:   []string{"int", "varchar", "bigint"},
+		},
+		{
+			name:        "modify column",
+			ddls:        []string{"ALTER TABLE t1 MODIFY COLUMN a decimal(10,2) FIRST"},
+			table:       "t1",
+			wantColumns: []string{"a", "id", "b"},
+			wantTypes:   []string{"decimal", "int", "varchar"},
+		},
+		{
+			name:        "rename column",
+			ddls:        []string{"ALTER TABLE t1 RENAME COLUMN id TO id2"},
+			table:       "t1",
+			wantColumns: []string{"id2", "a", "b"},
+			wantPk:      KeyInfo{"id2"},
+		},
+		{
+			name:        "add and drop keys",
+			ddls:        []string{"ALTER TABLE t1 DROP PRIMARY KEY, ADD PRIMARY KEY (id, a)", "ALTER TABLE t1 DROP INDEX uk_b", "CREATE UNIQUE INDEX uk_a ON t1 (a)"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+			wantPk:      KeyInfo{"id", "a"},
+			wantUks:     []KeyInfo{{"a"}},
+		},
+		{
+			name:        "rename table",
+			ddls:        []string{"RENAME TABLE t1 TO t2"},
+			table:       "t2",
+			wantColumns: []string{"id", "a", "b"},
+			wantDropped: []string{"db.t1"},
+		},
+		{
+			name:        "alter table rename to",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN c int, RENAME TO t2"},
+			table:       "t2",
+			wantColumns: []string{"id", "a", "b", "c"},
+			wantDropped: []string{"db.t1"},
+		},
+		{
+			name:        "create table",
+			ddls:        []string{"CREATE TABLE t3 (x int, y varchar(10), z json, PRIMARY KEY (x), UNIQUE KEY uk_y (y))"},
+			table:       "t3",
+			wantColumns: []string{"x", "y", "z"},
+			wantTypes:   []string{"int", "varchar", "json"},
+			wantPk:      KeyInfo{"x"},
+			wantUks:     []KeyInfo{{"y"}},
+		},
+		{
+			name:        "drop table",
+			ddls:        []string{"DROP TABLE t1"},
+			wantDropped: []string{"db.t1"},
+		},
+		{
+			name:        "comment before ddl",
+			ddls:        []string{"/* ApplicationName=DBeaver */ alter table t1 add column c int"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b", "c"},
+		},
+		{
+			name:        "not a ddl",
+			ddls:        []string{"BEGIN", "INSERT INTO t1 VALUES (1, 2, 'x')"},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &TablesColumnsInfo{}
+			tc.setTableVersion("db.t1", snapshotT1())
+			applyDdls(tc, tt.ddls...)
+			for _, tbKey := range tt.wantDropped {
+				if _, ok := tc.tableInfos[tbKey]; ok {
+					t.Errorf("table %s is not dropped", tbKey)
+				}
+				if _, ok := tc.dropped[tbKey]; !ok {
+					t.Errorf("table %s is not in the dropped tables", tbKey)
+				}
+			}
+			if tt.table == "" {
+				return
+			}
+			tb, ok := tc.tableInfos[GetAbsTableName("db", tt.table)]
+			if !ok {
+				t.Fatalf("table db.%s is not known", tt.table)
+			}
+			if got := columnNames(tb); !reflect.DeepEqual(got, tt.wantColumns) {
+				t.Errorf("columns = %v, want %v", got, tt.wantColumns)
+			}
+			if tt.wantTypes != nil {
+				types := []string{}
+				for _, f := range tb.Columns {
+					types = append(types, f.FieldType)
+				}
+				if !reflect.DeepEqual(types, tt.wantTypes) {
+					t.Errorf("types = %v, want %v", types, tt.wantTypes)
+				}
+			}
+			if tt.wantPk != nil && !reflect.DeepEqual(tb.PrimaryKey, tt.wantPk) {
+				t.Errorf("primary key = %v, want %v", tb.PrimaryKey, tt.wantPk)
+			}
+			if tt.wantUks != nil && !reflect.DeepEqual(tb.UniqueKeys, tt.wantUks) {
+				t.Errorf("unique keys = %v, want %v", tb.UniqueKeys, tt.wantUks)
+			}
+		})
+	}
+}
+
+func TestApplyQueryEventHistory(t *testing.T) {
+	tc := &TablesColumnsInfo{}
+	snapshot := snapshotT1()
+	tc.setTableVersion("db.t1", snapshot)
+	applyDdls(tc, "ALTER TABLE t1 ADD COLUMN c int", "ALTER TABLE t1 DROP COLUMN a")
+
+	history := tc.GetTableHistory("db", "t1")
+	if len(history) != 3 {
+		t.Fatalf("got %d versions, want 3", len(history))
+	}
+	want := [][]string{{"id", "a", "b"}, {"id", "a", "b", "c"}, {"id", "b", "c"}}
+	for i, tb := range history {
+		if got := columnNames(tb); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("version %d columns = %v, want %v", i, got, want[i])
+		}
+	}
+	// the versions taken by the events before the ddls are not changed
+	if history[0] != snapshot || history[0].DdlInfo != nil {
+		t.Errorf("snapshot is changed")
+	}
+	if ddl := history[2].DdlInfo; ddl == nil || ddl.StartPos != 2000 || ddl.StopPos != 2500 || ddl.DdlSql != "ALTER TABLE t1 DROP COLUMN a" {
+		t.Errorf("ddl info of the last version = %+v", ddl)
+	}
+}
+
+// tableMapOf returns the table map event of db.t1 with the column types
+func tableMapOf(types ...byte) *replication.TableMapEvent {
+	meta := make([]uint16, len(types))
+	for i, tp := range types {
+		if tp == mysql.MYSQL_TYPE_VARCHAR {
+			meta[i] = 80
+		}
+	}
+	return &replication.TableMapEvent{Schema: []byte("db"), Table: []byte("t1"),
+		ColumnCount: uint64(len(types)), ColumnType: types, ColumnMeta: meta}
+}
+
+// liveT1 is db.t1 in mysql after the ddl: snapshotT1 with c bigint after a
+func liveT1() *TblInfoJson {
+	tb := snapshotT1()
+	tb.Columns = []FieldInfo{tb.Columns[0], tb.Columns[1], {FieldName: "c", FieldType: "bigint"}, tb.Columns[2]}
+	return tb
+}
+
+// fetchOf returns the fetch of snapshotTable which finds the tables in mysql
+func fetchOf(tables ...*TblInfoJson) func(schema string, table string) (*TblInfoJson, error) {
+	return func(schema string, table string) (*TblInfoJson, error) {
+		for _, tb := range tables {
+			if tb.Database == schema && tb.Table == table {
+				return tb, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+func addPendingDdls(tc *TablesColumnsInfo, ddls ...string) {
+	for i, ddl := range ddls {
+		qEv := &replication.QueryEvent{Schema: []byte("db"), Query: []byte(ddl)}
+		tc.addPendingDdl(qEv, mysql.Position{Name: "mysql-bin.000001", Pos: uint32(1000 * (i + 1))}, uint32(1000*(i+1)+500))
+	}
+}
+
+func TestSnapshotTable(t *testing.T) {
+	tests := []struct {
+		name          string
+		ddls          []string
+		live          *TblInfoJson
+		table         string
+		wantColumns   []string
+		wantPk        KeyInfo
+		wantUks       []KeyInfo
+		wantNotUndone uint32 // start position of the ddl not undone, 0 if all are undone
+		wantErr       bool
+	}{
+		{
+			name:        "no ddl",
+			live:        snapshotT1(),
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+		},
+		{
+			name:        "add column after",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN c bigint AFTER a"},
+			live:        liveT1(),
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+		},
+		{
+			name:        "add column with unique key",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN c bigint UNIQUE AFTER a"},
+			live:        &TblInfoJson{Database: "db", Table: "t1", Columns: liveT1().Columns, PrimaryKey: KeyInfo{"id"}, UniqueKeys: []KeyInfo{{"b"}, {"c"}}, UniqueKeyNames: []string{"uk_b", "c"}},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+			wantUks:     []KeyInfo{{"b"}},
+		},
+		{
+			name:        "rename and change column",
+			ddls:        []string{"ALTER TABLE t1 RENAME COLUMN id TO id2", "ALTER TABLE t1 CHANGE COLUMN b bb varchar(40)"},
+			live:        &TblInfoJson{Database: "db", Table: "t1", Columns: []FieldInfo{{FieldName: "id2", FieldType: "int"}, {FieldName: "a", FieldType: "int"}, {FieldName: "bb", FieldType: "varchar"}}, PrimaryKey: KeyInfo{"id2"}, UniqueKeys: []KeyInfo{{"bb"}}, UniqueKeyNames: []string{"uk_b"}},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+			wantPk:      KeyInfo{"id"},
+			wantUks:     []KeyInfo{{"b"}},
+		},
+		{
+			name:        "add keys",
+			ddls:        []string{"ALTER TABLE t1 ADD UNIQUE KEY uk_a (a)", "CREATE UNIQUE INDEX uk_ab ON t1 (a, b)"},
+			live:        &TblInfoJson{Database: "db", Table: "t1", Columns: snapshotT1().Columns, PrimaryKey: KeyInfo{"id"}, UniqueKeys: []KeyInfo{{"b"}, {"a"}, {"a", "b"}}, UniqueKeyNames: []string{"uk_b", "uk_a", "uk_ab"}},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+			wantUks:     []KeyInfo{{"b"}},
+		},
+		{
+			name:          "drop column is not undone",
+			ddls:          []string{"ALTER TABLE t1 ADD COLUMN c int", "ALTER TABLE t1 DROP COLUMN a"},
+			live:          &TblInfoJson{Database: "db", Table: "t1", Columns: []FieldInfo{{FieldName: "id", FieldType: "int"}, {FieldName: "b", FieldType: "varchar"}, {FieldName: "c", FieldType: "int"}}},
+			table:         "t1",
+			wantColumns:   []string{"id", "b", "c"},
+			wantNotUndone: 2000,
+		},
+		{
+			name:        "renamed tables",
+			ddls:        []string{"ALTER TABLE t1 ADD COLUMN c bigint AFTER a, RENAME TO t2", "RENAME TABLE t2 TO t3"},
+			live:        &TblInfoJson{Database: "db", Table: "t3", Columns: liveT1().Columns},
+			table:       "t1",
+			wantColumns: []string{"id", "a", "b"},
+		},
+		{
+			name:          "dropped table",
+			ddls:          []string{"DROP TABLE t1", "CREATE TABLE t1 (x int)"},
+			live:          &TblInfoJson{Database: "db", Table: "t1", Columns: []FieldInfo{{FieldName: "x", FieldType: "int"}}},
+			table:         "t1",
+			wantColumns:   []string{"x"},
+			wantNotUndone: 1000,
+		},
+		{
+			name:    "not in mysql",
+			live:    snapshotT1(),
+			table:   "t9",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &TablesColumnsInfo{}
+			addPendingDdls(tc, tt.ddls...)
+			tb, err := tc.snapshotTable(GetAbsTableName("db", tt.table), fetchOf(tt.live))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("snapshotTable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tb.Database != "db" || tb.Table != tt.table || tb.DdlInfo != nil {
+				t.Errorf("snapshot is %s.%s, ddl info %+v", tb.Database, tb.Table, tb.DdlInfo)
+			}
+			if got := columnNames(tb); !reflect.DeepEqual(got, tt.wantColumns) {
+				t.Errorf("columns = %v, want %v", got, tt.wantColumns)
+			}
+			if tt.wantPk != nil && !reflect.DeepEqual(tb.PrimaryKey, tt.wantPk) {
+				t.Errorf("primary key = %v, want %v", tb.PrimaryKey, tt.wantPk)
+			}
+			if tt.wantUks != nil && !reflect.DeepEqual(tb.UniqueKeys, tt.wantUks) {
+				t.Errorf("unique keys = %v, want %v", tb.UniqueKeys, tt.wantUks)
+			}
+			var notUndone uint32
+			if tb.notUndone != nil {
+				notUndone = tb.notUndone.StartPos
+			}
+			if notUndone != tt.wantNotUndone {
+				t.Errorf("ddl not undone at %d, want %d", notUndone, tt.wantNotUndone)
+			}
+			if got := tc.tableInfos[GetAbsTableName("db", tt.table)]; got != tb {
+				t.Errorf("snapshot is not the current version")
+			}
+		})
+	}
+}
+
+func TestCheckTableMapWithDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		tbMap   *replication.TableMapEvent
+		tb      *TblInfoJson
+		wantErr bool
+	}{
+		{
+			name:  "same columns",
+			tbMap: tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR),
+			tb:    snapshotT1(),
+		},
+		{
+			// the definition in mysql after ALTER TABLE t1 ADD COLUMN c bigint AFTER a, the ddl is not undone
+			name:    "event before add column after",
+			tbMap:   tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR),
+			tb:      liveT1(),
+			wantErr: true,
+		},
+		{
+			name:    "column type changed",
+			tbMap:   tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR, mysql.MYSQL_TYPE_VARCHAR),
+			tb:      snapshotT1(),
+			wantErr: true,
+		},
+		{
+			name:  "same class of type",
+			tbMap: tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR),
+			tb: &TblInfoJson{Columns: []FieldInfo{
+				{FieldName: "id", FieldType: "integer"}, {FieldName: "a", FieldType: "int unsigned"}, {FieldName: "b", FieldType: "varbinary"}}},
+		},
+		{
+			name:  "text is logged as blob",
+			tbMap: tableMapOf(mysql.MYSQL_TYPE_BLOB),
+			tb:    &TblInfoJson{Columns: []FieldInfo{{FieldName: "t", FieldType: "text"}}},
+		},
+		{
+			name:  "from table map",
+			tbMap: tableMapOf(mysql.MYSQL_TYPE_LONG),
+			tb:    &TblInfoJson{FromTableMap: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTableMapWithDefinition(tt.tbMap, tt.tb)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckTableMapWithDefinition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// insertEventOf returns the insert rows event of db.t1 dispatched with the current version of the table
+func insertEventOf(tc *TablesColumnsInfo, pos uint32, tbMap *replication.TableMapEvent, row ...interface{}) *MyBinEvent {
+	return &MyBinEvent{MyPos: mysql.Position{Name: "mysql-bin.000001", Pos: pos + 100}, StartPos: pos, IfRowsEvent: true, SqlType: "insert",
+		BinEvent: &replication.RowsEvent{Table: tbMap, ColumnCount: tbMap.ColumnCount, Rows: [][]interface{}{row}},
+		TbInfo:   tc.tableInfos["db.t1"]}
+}
+
+func TestSchemaHistoryAcrossAddColumn(t *testing.T) {
+	// the binlogs have rows events of db.t1 before and after ALTER TABLE t1 ADD COLUMN c bigint AFTER a at 2000,
+	// without binlog_row_metadata=FULL. mysql has the definition after it
+	cfg := &ConfCmd{WorkType: "2sql"}
+	tc := &cfg.TablesColumnsInfo
+	addPendingDdls(tc, "BEGIN", "ALTER TABLE t1 ADD COLUMN c bigint AFTER a")
+	live := liveT1()
+	if _, err := tc.snapshotTable("db.t1", fetchOf(live)); err != nil {
+		t.Fatalf("snapshotTable() error = %v", err)
+	}
+	if got := columnNames(live); !reflect.DeepEqual(got, []string{"id", "a", "c", "b"}) {
+		t.Fatalf("the definition in mysql is changed: %v", got)
+	}
+	before := insertEventOf(tc, 1500, tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR),
+		int32(1), int32(2), "x")
+
+	tc.ApplyQueryEvent(&replication.QueryEvent{Schema: []byte("db"), Query: []byte("ALTER TABLE t1 ADD COLUMN c bigint AFTER a")},
+		mysql.Position{Name: "mysql-bin.000001", Pos: 2000}, 2500)
+	if len(tc.pendingDdls) != 0 {
+		t.Errorf("%d ddls are pending after they are read", len(tc.pendingDdls))
+	}
+	after := insertEventOf(tc, 3000, tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONGLONG, mysql.MYSQL_TYPE_VARCHAR),
+		int32(3), int32(4), int64(5), "y")
+
+	tests := []struct {
+		name string
+		ev   *MyBinEvent
+		want string
+	}{
+		{name: "before the ddl", ev: before, want: "INSERT INTO `t1` (`id`,`a`,`b`) VALUES (1,2,'x')"},
+		{name: "after the ddl", ev: after, want: "INSERT INTO `t1` (`id`,`a`,`c`,`b`) VALUES (3,4,5,'y')"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, sqls, err := GenSqlsForOneBinEvent(cfg, tt.ev)
+			if err != nil {
+				t.Fatalf("GenSqlsForOneBinEvent() error = %v", err)
+			}
+			if len(sqls) == 0 || !strings.Contains(sqls[0], tt.want) {
+				t.Errorf("sqls = %q, want %s", sqls, tt.want)
+			}
+		})
+	}
+
+	// the definition in mysql taken as the snapshot does not match the events before the ddl
+	tc2 := &TablesColumnsInfo{}
+	tc2.setTableVersion("db.t1", liveT1())
+	ev := insertEventOf(tc2, 1500, tableMapOf(mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_VARCHAR),
+		int32(1), int32(2), "x")
+	if _, _, _, err := GenSqlsForOneBinEvent(cfg, ev); err == nil || !strings.Contains(err.Error(), "[schema]") {
+		t.Errorf("GenSqlsForOneBinEvent() error = %v, want a schema error", err)
+	}
+}
+
+// queryEventData returns the raw data of a query event at the database db, without checksum
+func queryEventData(db string, query string, logPos uint32) []byte {
+	body := make([]byte, 13)
+	body[8] = byte(len(db))
+	body = append(body, db...)
+	body = append(body, 0)
+	body = append(body, query...)
+	data := binlogEvent(replication.QUERY_EVENT, body)
+	binary.LittleEndian.PutUint32(data[13:], logPos)
+	return data
+}
+
+func TestScanDdlsInFile(t *testing.T) {
+	data := append([]byte{}, replication.BinLogFileHeader...)
+	var poses []uint32
+	for _, query := range []string{"ALTER TABLE t1 ADD COLUMN c int", "BEGIN", "ALTER TABLE t1 ADD COLUMN d int", "DROP TABLE t2"} {
+		poses = append(poses, uint32(len(data)))
+		data = append(data, queryEventData("db", query, 0)...)
+	}
+	name := filepath.Join(t.TempDir(), "mysql-bin.000001")
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the first ddl is before the start position
+	cfg := &ConfCmd{IfSetStartFilePos: true, StartFilePos: mysql.Position{Name: "mysql-bin.000001", Pos: poses[1]}}
+	if err := scanDdlsInFile(context.Background(), cfg, replication.NewBinlogParser(), name); err != nil {
+		t.Fatalf("scanDdlsInFile() error = %v", err)
+	}
+	pending := cfg.TablesColumnsInfo.pendingDdls
+	if len(pending) != 2 {
+		t.Fatalf("%d ddls are read ahead, want 2", len(pending))
+	}
+	for i, want := range []struct {
+		pos uint32
+		sql string
+	}{{poses[2], "ALTER TABLE t1 ADD COLUMN d int"}, {poses[3], "DROP TABLE t2"}} {
+		if pending[i].pos.Name != "mysql-bin.000001" || pending[i].pos.Pos != want.pos || pending[i].ddlInfo.DdlSql != want.sql {
+			t.Errorf("ddl %d = %v %s, want %d %s", i, pending[i].pos, pending[i].ddlInfo.DdlSql, want.pos, want.sql)
+		}
+	}
+	if err := scanDdlsInFile(context.Background(), cfg, replication.NewBinlogParser(), name+".bad"); err == nil {
+		t.Errorf("scanDdlsInFile() of a missing file is nil")
+	}
+	if err := os.WriteFile(name, bytes.Repeat([]byte{0}, 8), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := scanDdlsInFile(context.Background(), cfg, replication.NewBinlogParser(), name); err == nil {
+		t.Errorf("scanDdlsInFile() of an invalid file is nil")
+	}
+}
@@ -0,0 +1,149 @@
+package base
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the named time zones are known without the zoneinfo of the os, ex: windows
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/siddontang/go-log/log"
+)
+
+// the time zone of the job is used to parse -start-datetime/-stop-datetime and to write the TIMESTAMP values.
+// the sql files set time_zone to it, so mysql takes the TIMESTAMP values back as the same time.
+// DATETIME, DATE and TIME values are written as they are in binlog with their fractional seconds,
+// the zero dates too, the sql files turn off NO_ZERO_DATE and NO_ZERO_IN_DATE for them
+
+// C_serverTimeZone is the time zone of mysql: @@time_zone, or @@system_time_zone if it is SYSTEM
+const C_serverTimeZone = "server"
+
+// zeroDateSqlMode removes NO_ZERO_IN_DATE and NO_ZERO_DATE from sql_mode, the rows in binlog may have zero dates
+const zeroDateSqlMode = "SET SESSION sql_mode = TRIM(BOTH ',' FROM REPLACE(REPLACE(CONCAT(',', @@SESSION.sql_mode, ','), " +
+	"',NO_ZERO_IN_DATE,', ','), ',NO_ZERO_DATE,', ','));\n"
+
+// the time zone in the form of mysql time_zone, ex: +08:00
+var offsetTimeZoneRegexp = regexp.MustCompile(`^([+-])(\d{1,2}):(\d{2})$`)
+
+// ParseTimeZone returns the location of the time zone: Local, UTC, the IANA name like Asia/Shanghai or the offset like +08:00
+func ParseTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if m := offsetTimeZoneRegexp.FindStringSubmatch(name); m != nil {
+		hour, _ := strconv.Atoi(m[2])
+		minute, _ := strconv.Atoi(m[3])
+		if hour > 14 || minute > 59 {
+			return nil, fmt.Errorf("time zone offset %s is out of range", name)
+		}
+		offset := hour*3600 + minute*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return fixedTimeZone(offset), nil
+	}
+	if name == "" {
+		name = "Local"
+	}
+	return time.LoadLocation(name)
+}
+
+// fixedTimeZone returns the location of the offset in seconds, it is named like mysql time_zone, ex: +08:00
+func fixedTimeZone(offset int) *time.Location {
+	sign, abs := "+", offset
+	if offset < 0 {
+		sign, abs = "-", -offset
+	}
+	return time.FixedZone(fmt.Sprintf("%s%02d:%02d", sign, abs/3600, abs%3600/60), offset)
+}
+
+// GetServerTimeZone returns the time zone of mysql. @@system_time_zone is the abbreviation of the os like CST which is ambiguous,
+// the current offset of mysql is returned if the time zone is not an offset or an IANA name
+func GetServerTimeZone(db *sql.DB) (*time.Location, error) {
+	var (
+		tz, systemTz string
+		offset       int
+	)
+	err := db.QueryRow("SELECT @@time_zone, @@system_time_zone, TIMESTAMPDIFF(SECOND, UTC_TIMESTAMP(), NOW())").Scan(&tz, &systemTz, &offset)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(tz, "SYSTEM") {
+		tz = systemTz
+	}
+	if tz == "UTC" || strings.Contains(tz, "/") || offsetTimeZoneRegexp.MatchString(tz) {
+		if loc, err := ParseTimeZone(tz); err == nil {
+			return loc, nil
+		}
+	}
+	return fixedTimeZone(offset), nil
+}
+
+// GetSqlTimeZone returns the time zone of loc for SET time_zone, the IANA names need the time zone tables of mysql.
+// Local is the name in TZ or /etc/localtime, it is the current offset if there is no name of it
+func GetSqlTimeZone(loc *time.Location) string {
+	name := loc.String()
+	if loc == time.Local {
+		name = localTimeZoneName()
+	}
+	if name == "UTC" {
+		return "+00:00"
+	}
+	if strings.Contains(name, "/") || offsetTimeZoneRegexp.MatchString(name) {
+		return name
+	}
+	_, offset := time.Now().In(loc).Zone()
+	return fixedTimeZone(offset).String()
+}
+
+// localTimeZoneName returns the IANA name of the local time zone, "" if it is unknown
+func localTimeZoneName() string {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err == nil {
+			return tz
+		}
+	}
+	if link, err := os.Readlink("/etc/localtime"); err == nil {
+		if i := strings.Index(link, "zoneinfo/"); i >= 0 {
+			return link[i+len("zoneinfo/"):]
+		}
+	}
+	return ""
+}
+
+// SetTimeZone sets the time zone of the job, C_serverTimeZone is queried from mysql
+func (this *ConfCmd) SetTimeZone(name string) error {
+	var (
+		loc *time.Location
+		err error
+	)
+	if name == C_serverTimeZone {
+		db, err := CreateMysqlCon(GetMysqlUrl(this))
+		if err != nil {
+			return NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to connect to mysql %v", err)
+		}
+		defer db.Close()
+		if loc, err = GetServerTimeZone(db); err != nil {
+			return NewEngineError(ErrCategoryConnection, mysql.Position{}, "fail to get the time zone of mysql %v", err)
+		}
+	} else if loc, err = ParseTimeZone(name); err != nil {
+		return NewConfigError("invalid time location %s %v", name, err)
+	}
+	this.BinlogTimeLocation = name
+	this.BinlogTimeLoc = loc
+	this.SqlTimeZone = GetSqlTimeZone(loc)
+	log.Infof("time zone of the job is %s, time_zone of the sql files is %s", loc.String(), this.SqlTimeZone)
+	return nil
+}
+
+// SqlFilePreamble returns the statements at the start of the sql files: the charset, the time zone of the TIMESTAMP values
+// and the sql_mode allowing the zero dates
+func (this *ConfCmd) SqlFilePreamble() string {
+	preamble := "SET NAMES utf8mb4;\n"
+	if this.SqlTimeZone != "" {
+		preamble += fmt.Sprintf("SET time_zone = '%s';\n", this.SqlTimeZone)
+	}
+	return preamble + zeroDateSqlMode
+}
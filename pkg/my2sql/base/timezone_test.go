@@ -0,0 +1,89 @@
+package base
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeZone(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantName   string
+		wantOffset int // at 1700000000
+		wantErr    bool
+	}{
+		{name: "+08:00", wantName: "+08:00", wantOffset: 8 * 3600},
+		{name: "+8:00", wantName: "+08:00", wantOffset: 8 * 3600},
+		{name: "-05:30", wantName: "-05:30", wantOffset: -(5*3600 + 30*60)},
+		{name: "+00:00", wantName: "+00:00"},
+		{name: "+14:00", wantName: "+14:00", wantOffset: 14 * 3600},
+		{name: "+15:00", wantErr: true},
+		{name: "+08:60", wantErr: true},
+		{name: "UTC", wantName: "UTC"},
+		{name: " Asia/Tokyo ", wantName: "Asia/Tokyo", wantOffset: 9 * 3600},
+		{name: "America/New_York", wantName: "America/New_York", wantOffset: -5 * 3600},
+		{name: "Mars/Olympus", wantErr: true},
+		{name: "08:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := ParseTimeZone(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTimeZone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if loc.String() != tt.wantName {
+				t.Errorf("name = %s, want %s", loc.String(), tt.wantName)
+			}
+			if _, offset := time.Unix(1700000000, 0).In(loc).Zone(); offset != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", offset, tt.wantOffset)
+			}
+		})
+	}
+	if loc, err := ParseTimeZone(""); err != nil || loc != time.Local {
+		t.Errorf("ParseTimeZone(\"\") = %v, %v, want Local", loc, err)
+	}
+}
+
+func TestGetSqlTimeZone(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	tests := []struct {
+		name string
+		loc  *time.Location
+		want string
+	}{
+		{name: "utc", loc: time.UTC, want: "+00:00"},
+		{name: "iana name", loc: tokyo, want: "Asia/Tokyo"},
+		{name: "offset", loc: fixedTimeZone(-(3*3600 + 30*60)), want: "-03:30"},
+		{name: "abbreviation", loc: time.FixedZone("CST", 8*3600), want: "+08:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetSqlTimeZone(tt.loc); got != tt.want {
+				t.Errorf("GetSqlTimeZone() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	t.Run("local from TZ", func(t *testing.T) {
+		t.Setenv("TZ", "Europe/Paris")
+		if got := GetSqlTimeZone(time.Local); got != "Europe/Paris" {
+			t.Errorf("GetSqlTimeZone(Local) = %s, want Europe/Paris", got)
+		}
+	})
+}
+
+func TestSqlFilePreamble(t *testing.T) {
+	cfg := &ConfCmd{SqlTimeZone: "+09:00"}
+	preamble := cfg.SqlFilePreamble()
+	for _, want := range []string{"SET NAMES utf8mb4;\n", "SET time_zone = '+09:00';\n", "NO_ZERO_DATE"} {
+		if !strings.Contains(preamble, want) {
+			t.Errorf("preamble does not have %q: %s", want, preamble)
+		}
+	}
+	if preamble = (&ConfCmd{}).SqlFilePreamble(); strings.Contains(preamble, "time_zone") {
+		t.Errorf("preamble without time zone sets it: %s", preamble)
+	}
+}
@@ -196,6 +196,60 @@ func DoubleColumn(name string, nullable NullableColumn) NonAliasColumn {
 	return ic
 }
 
+type bitColumn struct {
+	baseColumn
+	isExpression
+}
+
+// Representation of any bit column, the values are written as b'...'
+// This function will panic if name is not valid
+func BitColumn(name string, nullable NullableColumn) NonAliasColumn {
+	if !validIdentifierName(name) {
+		panic("Invalid column name in bit column")
+	}
+	bc := &bitColumn{}
+	bc.name = name
+	bc.nullable = nullable
+	return bc
+}
+
+type geometryColumn struct {
+	baseColumn
+	isExpression
+	geographicSrids map[uint32]bool
+}
+
+// Representation of any spatial column, the values are the mysql internal format, SRID + WKB.
+// geographicSrids are the SRIDs of the geographic spatial reference systems of the target mysql,
+// nil if it has none, ex: mysql 5.7. see GeomFromInternal
+// This function will panic if name is not valid
+func GeometryColumn(name string, nullable NullableColumn, geographicSrids map[uint32]bool) NonAliasColumn {
+	if !validIdentifierName(name) {
+		panic("Invalid column name in geometry column")
+	}
+	gc := &geometryColumn{geographicSrids: geographicSrids}
+	gc.name = name
+	gc.nullable = nullable
+	return gc
+}
+
+type decimalColumn struct {
+	baseColumn
+	isExpression
+}
+
+// Representation of any decimal column, the values are exact decimal.Decimal
+// This function will panic if name is not valid
+func DecimalColumn(name string, nullable NullableColumn) NonAliasColumn {
+	if !validIdentifierName(name) {
+		panic("Invalid column name in decimal column")
+	}
+	dc := &decimalColumn{}
+	dc.name = name
+	dc.nullable = nullable
+	return dc
+}
+
 type booleanColumn struct {
 	baseColumn
 	isExpression
@@ -3,6 +3,7 @@ package sqlbuilder
 
 import (
 	"bytes"
+	"encoding/binary"
 	"reflect"
 	"strconv"
 	"strings"
@@ -359,6 +360,42 @@ func Interval(duration time.Duration) Expression {
 	}
 }
 
+type castExpression struct {
+	isExpression
+	expression Expression
+	typeName   string
+}
+
+func (c *castExpression) SerializeSql(out *bytes.Buffer) (err error) {
+	if !validIdentifierName(c.typeName) {
+		return errors.Newf(
+			"Invalid cast type name: %s.  Generated sql: %s",
+			c.typeName,
+			out.String())
+	}
+	if c.expression == nil {
+		return errors.Newf(
+			"nil cast expression.  Generated sql: %s",
+			out.String())
+	}
+	_, _ = out.WriteString("CAST(")
+	if err = c.expression.SerializeSql(out); err != nil {
+		return
+	}
+	_, _ = out.WriteString(" AS ")
+	_, _ = out.WriteString(c.typeName)
+	_ = out.WriteByte(')')
+	return nil
+}
+
+// Returns a representation of "CAST(expression AS typeName)"
+func Cast(expression Expression, typeName string) Expression {
+	return &castExpression{
+		expression: expression,
+		typeName:   typeName,
+	}
+}
+
 var likeEscaper = strings.NewReplacer("_", "\\_", "%", "\\%")
 
 func EscapeForLike(s string) string {
@@ -374,6 +411,44 @@ func Literal(v interface{}) Expression {
 	return &literalExpression{value: value}
 }
 
+// Returns the literal of v written as the type of col, b'...' for bit column,
+// X'...' for bytes column, ST_GeomFromWKB(X'...', srid) for geometry column. Other columns are the same as Literal
+func ColumnLiteral(col NonAliasColumn, v interface{}) Expression {
+	switch c := col.(type) {
+	case *geometryColumn:
+		if b, ok := v.([]byte); ok && len(b) > 4 {
+			return GeomFromInternal(b, c.geographicSrids[binary.LittleEndian.Uint32(b[:4])])
+		}
+	case *bitColumn:
+		value, err := sqltypes.BuildBit(v)
+		if err != nil {
+			panic(errors.Wrap(err, "Invalid literal value"))
+		}
+		return &literalExpression{value: value}
+	case *bytesColumn:
+		// binary and varbinary are decoded as string from binlog
+		if s, ok := v.(string); ok {
+			return Literal([]byte(s))
+		}
+	}
+	return Literal(v)
+}
+
+// Returns a representation of "ST_GeomFromWKB(wkb, srid)" of the geometry in mysql internal format,
+// 4 bytes little endian SRID followed by WKB. the coordinates of the internal format are in longitude-latitude order,
+// ST_GeomFromWKB takes the order of the SRS by default, so the order is given if the SRID is geographic in mysql 8.0.
+// the options argument is not known by mysql 5.7, where there is no geographic SRS
+func GeomFromInternal(b []byte, geographic bool) Expression {
+	srid := binary.LittleEndian.Uint32(b[:4])
+	if srid == 0 {
+		return SqlFunc("ST_GeomFromWKB", Literal(b[4:]))
+	}
+	if !geographic {
+		return SqlFunc("ST_GeomFromWKB", Literal(b[4:]), Literal(srid))
+	}
+	return SqlFunc("ST_GeomFromWKB", Literal(b[4:]), Literal(srid), Literal("axis-order=long-lat"))
+}
+
 // Returns a representation of "c[0] AND ... AND c[n-1]" for c in clauses
 func And(expressions ...BoolExpression) BoolExpression {
 	return &conjunctExpression{
@@ -452,6 +527,11 @@ func EqL(lhs Expression, val interface{}) BoolExpression {
 	return Eq(lhs, Literal(val))
 }
 
+// Returns a representation of "a=b", where b is the literal of the column type, see ColumnLiteral
+func EqCL(col NonAliasColumn, val interface{}) BoolExpression {
+	return Eq(col, ColumnLiteral(col, val))
+}
+
 // Returns a representation of "a!=b"
 func Neq(lhs, rhs Expression) BoolExpression {
 	lit, ok := rhs.(*literalExpression)
@@ -0,0 +1,80 @@
+package sqlbuilder
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestColumnLiteral(t *testing.T) {
+	tests := []struct {
+		name string
+		col  NonAliasColumn
+		v    interface{}
+		want string
+	}{
+		{name: "bit", col: BitColumn("b", Nullable), v: int64(6), want: "b'110'"},
+		{name: "bit null", col: BitColumn("b", Nullable), v: nil, want: "null"},
+		{name: "binary decoded as string", col: BytesColumn("bin", Nullable), v: "a\x00\xff", want: "X'6100ff'"},
+		{name: "blob", col: BytesColumn("bin", Nullable), v: []byte("ab"), want: "X'6162'"},
+		{name: "int", col: IntColumn("i", Nullable), v: uint64(18446744073709551615), want: "18446744073709551615"},
+		{name: "float", col: DoubleColumn("f", Nullable), v: float32(1.1), want: "1.1"},
+		{name: "string", col: StrColumn("s", UTF8, UTF8CaseInsensitive, Nullable), v: "x", want: "'x'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := ColumnLiteral(tt.col, tt.v).SerializeSql(&out); err != nil {
+				t.Fatalf("SerializeSql() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("sql = %s, want %s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestEqCL(t *testing.T) {
+	var out bytes.Buffer
+	if err := EqCL(BitColumn("b", Nullable), int64(1)).SerializeSql(&out); err != nil {
+		t.Fatalf("SerializeSql() error = %v", err)
+	}
+	if want := "`b`=b'1'"; out.String() != want {
+		t.Errorf("sql = %s, want %s", out.String(), want)
+	}
+}
+
+func TestGeomFromInternal(t *testing.T) {
+	// POINT(1 2) in WKB
+	wkb := []byte{0x01, 0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf0, 0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40}
+	wkbHex := "X'0101000000000000000000f03f0000000000000040'"
+	withSrid := func(srid uint32) []byte {
+		return append([]byte{byte(srid), byte(srid >> 8), byte(srid >> 16), byte(srid >> 24)}, wkb...)
+	}
+	tests := []struct {
+		name string
+		col  NonAliasColumn
+		v    []byte
+		want string
+	}{
+		{name: "no srid", col: GeometryColumn("g", Nullable, nil), v: withSrid(0),
+			want: "ST_GeomFromWKB(" + wkbHex + ")"},
+		{name: "projected srid", col: GeometryColumn("g", Nullable, map[uint32]bool{4326: true}), v: withSrid(3857),
+			want: "ST_GeomFromWKB(" + wkbHex + ",3857)"},
+		{name: "geographic srid", col: GeometryColumn("g", Nullable, map[uint32]bool{4326: true}), v: withSrid(4326),
+			want: "ST_GeomFromWKB(" + wkbHex + ",4326,'axis-order=long-lat')"},
+		{name: "srids of mysql 5.7 unknown", col: GeometryColumn("g", Nullable, nil), v: withSrid(4326),
+			want: "ST_GeomFromWKB(" + wkbHex + ",4326)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := ColumnLiteral(tt.col, tt.v).SerializeSql(&out); err != nil {
+				t.Fatalf("SerializeSql() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("sql = %s, want %s", out.String(), tt.want)
+			}
+		})
+	}
+}
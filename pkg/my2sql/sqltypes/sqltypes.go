@@ -17,8 +17,11 @@ import (
 	"strings"
 	"time"
 
+	"my-wails-app/pkg/my2sql/constvar"
+
 	"github.com/dropbox/godropbox/encoding2"
 	"github.com/dropbox/godropbox/errors"
+	"github.com/shopspring/decimal"
 )
 
 var (
@@ -35,6 +38,9 @@ const (
 	FractionalType = ValueType(2)
 	StringType     = ValueType(3)
 	UTF8StringType = ValueType(4)
+	BitType        = ValueType(5)
+	// charset name, ':' and the bytes
+	CharsetStringType          = ValueType(6)
 	maxMediumintUnsigned int32 = 16777215
 )
 
@@ -57,6 +63,15 @@ type String struct {
 	isUtf8 bool
 }
 
+// Bit represents the value of bit column, the binary digits written as b'...'
+type Bit []byte
+
+// CharsetString represents the bytes in a charset, written as hex with the charset introducer, ex: _gbk X'C4E3'
+type CharsetString struct {
+	charset string
+	data    []byte
+}
+
 // MakeNumeric makes a Numeric from a []byte without validation.
 func MakeNumeric(b []byte) Value {
 	return Value{Numeric(b)}
@@ -72,6 +87,11 @@ func MakeString(b []byte) Value {
 	return Value{String{b, false}}
 }
 
+// MakeCharsetString makes a CharsetString value from the bytes in charset.
+func MakeCharsetString(charset string, b []byte) Value {
+	return Value{CharsetString{charset, b}}
+}
+
 // MakeUtf8String makes a String value from a []byte.
 func MakeUtf8String(s string) Value {
 	return Value{String{[]byte(s), true}}
@@ -162,6 +182,14 @@ func (v *Value) UnmarshalBinary(data []byte) error {
 		*v = Value{String{raw, false}}
 	case UTF8StringType:
 		*v = Value{String{raw, true}}
+	case BitType:
+		*v = Value{Bit(raw)}
+	case CharsetStringType:
+		parts := bytes.SplitN(raw, []byte(":"), 2)
+		if len(parts) != 2 {
+			return errors.Newf("Invalid charset string value")
+		}
+		*v = Value{CharsetString{string(parts[0]), parts[1]}}
 	default:
 		return errors.Newf("Unknown type %d", int(typ))
 	}
@@ -249,16 +277,24 @@ func BuildValue(goval interface{}) (v Value, err error) {
 		v = Value{Numeric(strconv.AppendUint(nil, uint64(bindVal), 10))}
 	//Momo added
 	case float32:
-		v = Value{Fractional(strconv.AppendFloat(nil, float64(bindVal), 'f', -1, 64))}
+		// the shortest form of float32, float64(bindVal) gains digits which are not in the column
+		v = Value{Fractional(strconv.AppendFloat(nil, float64(bindVal), 'f', -1, 32))}
 	case float64:
 		v = Value{Fractional(strconv.AppendFloat(nil, bindVal, 'f', -1, 64))}
+	case decimal.Decimal:
+		v = Value{Fractional(DecimalString(bindVal))}
 	case string:
 		v = Value{String{[]byte(bindVal), true}}
 	case []byte:
 		v = Value{String{bindVal, false}}
 	case time.Time:
-		v = Value{String{[]byte(bindVal.Format("2006-01-02 15:04:05.000000")), true}}
-	case Numeric, Fractional, String:
+		if bindVal.IsZero() {
+			// zero date of mysql instead of 0001-01-01
+			v = Value{String{[]byte(constvar.DATETIME_ZERO), true}}
+		} else {
+			v = Value{String{[]byte(bindVal.Format("2006-01-02 15:04:05.000000")), true}}
+		}
+	case Numeric, Fractional, String, Bit, CharsetString:
 		v = Value{bindVal.(InnerValue)}
 	case Value:
 		v = bindVal
@@ -295,7 +331,7 @@ func ConvertIntUnsigned(arg interface{}, columnType string) interface{} {
 		return uint32(i)
 	}
 	if i, ok := arg.(int64); ok {
-		return strconv.FormatUint(uint64(i), 10)
+		return uint64(i)
 	}
 	if i, ok := arg.(int); ok {
 		return uint(i)
@@ -303,6 +339,47 @@ func ConvertIntUnsigned(arg interface{}, columnType string) interface{} {
 	return arg
 }
 
+// BuildBit builds the value of bit column, it is decoded as int64 from binlog
+func BuildBit(goval interface{}) (v Value, err error) {
+	switch bindVal := goval.(type) {
+	case nil:
+		return NULL, nil
+	case int64:
+		return Value{Bit(strconv.AppendUint(nil, uint64(bindVal), 2))}, nil
+	case uint64:
+		return Value{Bit(strconv.AppendUint(nil, bindVal, 2))}, nil
+	case int:
+		return Value{Bit(strconv.AppendUint(nil, uint64(bindVal), 2))}, nil
+	}
+	return Value{}, errors.Newf("Unsupported bit value type %T: %v", goval, goval)
+}
+
+// ConvertDecimal converts the decimal column value decoded as string into decimal.Decimal,
+// so it is written as an exact number instead of a quoted string
+func ConvertDecimal(arg interface{}) interface{} {
+	var str string
+	switch d := arg.(type) {
+	case string:
+		str = d
+	case []byte:
+		str = string(d)
+	default:
+		return arg
+	}
+	if d, err := decimal.NewFromString(str); err == nil {
+		return d
+	}
+	return arg
+}
+
+// DecimalString returns the decimal with the digits after the point as they are stored, ex: 1.500000 of decimal(20,6)
+func DecimalString(d decimal.Decimal) string {
+	if d.Exponent() < 0 {
+		return d.StringFixed(-d.Exponent())
+	}
+	return d.String()
+}
+
 // ConverAssignRowNullable is the same as ConvertAssignRow except that it allows
 // nil as a value for the row or any of the row values. In thoses cases, the
 // corresponding values are ignored.
@@ -541,6 +618,44 @@ func (f Fractional) MarshalBinary() ([]byte, error) {
 	return writeBinary(FractionalType, f.raw())
 }
 
+func (bt Bit) raw() []byte {
+	return []byte(bt)
+}
+
+func (bt Bit) encodeSql(b encoding2.BinaryWriter) {
+	b.Write([]byte("b'"))
+	if _, err := b.Write(bt.raw()); err != nil {
+		panic(err)
+	}
+	writebyte(b, '\'')
+}
+
+func (bt Bit) encodeAscii(b encoding2.BinaryWriter) {
+	bt.encodeSql(b)
+}
+
+func (bt Bit) MarshalBinary() ([]byte, error) {
+	return writeBinary(BitType, bt.raw())
+}
+
+func (cs CharsetString) raw() []byte {
+	return cs.data
+}
+
+func (cs CharsetString) encodeSql(b encoding2.BinaryWriter) {
+	b.Write([]byte("_" + cs.charset + " X'"))
+	encoding2.HexEncodeToWriter(b, cs.raw())
+	writebyte(b, '\'')
+}
+
+func (cs CharsetString) encodeAscii(b encoding2.BinaryWriter) {
+	cs.encodeSql(b)
+}
+
+func (cs CharsetString) MarshalBinary() ([]byte, error) {
+	return writeBinary(CharsetStringType, append([]byte(cs.charset+":"), cs.data...))
+}
+
 func (s String) raw() []byte {
 	return []byte(s.data)
 }
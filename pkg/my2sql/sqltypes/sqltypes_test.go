@@ -0,0 +1,127 @@
+package sqltypes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// sqlOf returns v as it is written in the sql
+func sqlOf(v Value) string {
+	var b bytes.Buffer
+	v.EncodeSql(&b)
+	return b.String()
+}
+
+func TestConvertDecimal(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg     interface{}
+		want    string
+		decimal bool
+	}{
+		{name: "scale kept", arg: "1.500000", want: "1.500000", decimal: true},
+		{name: "integer", arg: "42", want: "42", decimal: true},
+		{name: "negative", arg: "-0.01", want: "-0.01", decimal: true},
+		{name: "beyond float64", arg: "12345678901234567890.123456789", want: "12345678901234567890.123456789", decimal: true},
+		{name: "max decimal(65,30)", arg: "99999999999999999999999999999999999.999999999999999999999999999999",
+			want: "99999999999999999999999999999999999.999999999999999999999999999999", decimal: true},
+		{name: "bytes", arg: []byte("0.10"), want: "0.10", decimal: true},
+		{name: "not a number", arg: "abc", want: "'abc'"},
+		{name: "float64 unchanged", arg: float64(1.25), want: "1.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ConvertDecimal(tt.arg)
+			if _, ok := got.(decimal.Decimal); ok != tt.decimal {
+				t.Fatalf("ConvertDecimal(%v) = %T, want decimal %v", tt.arg, got, tt.decimal)
+			}
+			v, err := BuildValue(got)
+			if err != nil {
+				t.Fatalf("BuildValue() error = %v", err)
+			}
+			if s := sqlOf(v); s != tt.want {
+				t.Errorf("sql = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	tests := []struct {
+		d    decimal.Decimal
+		want string
+	}{
+		{d: decimal.New(15, -1), want: "1.5"},
+		{d: decimal.New(1500000, -6), want: "1.500000"},
+		{d: decimal.New(0, -2), want: "0.00"},
+		{d: decimal.New(12, 3), want: "12000"},
+		{d: decimal.New(-5, -3), want: "-0.005"},
+	}
+	for _, tt := range tests {
+		if got := DecimalString(tt.d); got != tt.want {
+			t.Errorf("DecimalString(%v) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestBuildBit(t *testing.T) {
+	tests := []struct {
+		name    string
+		v       interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "bit(3)", v: int64(5), want: "b'101'"},
+		{name: "zero", v: int64(0), want: "b'0'"},
+		{name: "bit(64) all ones", v: int64(-1), want: "b'" + strings.Repeat("1", 64) + "'"},
+		{name: "uint64", v: uint64(1 << 63), want: "b'1" + strings.Repeat("0", 63) + "'"},
+		{name: "int", v: 2, want: "b'10'"},
+		{name: "null", v: nil, want: "null"},
+		{name: "string", v: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := BuildBit(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildBit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && sqlOf(v) != tt.want {
+				t.Errorf("sql = %s, want %s", sqlOf(v), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildValueNumbers(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{name: "float32 shortest form", v: float32(0.1), want: "0.1"},
+		{name: "float32 of 7 digits", v: float32(123.4567), want: "123.4567"},
+		{name: "float32 large", v: float32(3.4e38), want: "340000000000000000000000000000000000000"},
+		{name: "float64", v: float64(0.1), want: "0.1"},
+		{name: "float64 small", v: 1e-7, want: "0.0000001"},
+		{name: "unsigned bigint", v: ConvertIntUnsigned(int64(-1), "bigint unsigned"), want: "18446744073709551615"},
+		{name: "unsigned int", v: ConvertIntUnsigned(int32(-1), "int unsigned"), want: "4294967295"},
+		{name: "unsigned mediumint", v: ConvertIntUnsigned(int32(-1), "mediumint unsigned"), want: "16777215"},
+		{name: "unsigned tinyint", v: ConvertIntUnsigned(int8(-128), "tinyint unsigned"), want: "128"},
+		{name: "bytes", v: []byte{0x00, 0xff, 'a'}, want: "X'00ff61'"},
+		{name: "string", v: "it's", want: `'it\'s'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := BuildValue(tt.v)
+			if err != nil {
+				t.Fatalf("BuildValue() error = %v", err)
+			}
+			if got := sqlOf(v); got != tt.want {
+				t.Errorf("sql = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}